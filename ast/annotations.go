@@ -0,0 +1,251 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package ast
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/util"
+)
+
+const (
+	annotationsMarker = "METADATA"
+
+	annotationScopePackage = "package"
+	annotationScopeRule    = "rule"
+)
+
+// Annotations represents the metadata attached to a package or rule. The
+// metadata is declared in a YAML-formatted comment block that starts with a
+// "# METADATA" line and immediately precedes the package or rule, e.g.:
+//
+//	# METADATA
+//	# title: Deny privileged containers
+//	# custom:
+//	#   severity: high
+//	deny[msg] { ... }
+type Annotations struct {
+	Location         *Location              `json:"-"`
+	Scope            string                 `json:"scope"`
+	Title            string                 `json:"title,omitempty"`
+	Description      string                 `json:"description,omitempty"`
+	Authors          []string               `json:"authors,omitempty"`
+	Organizations    []string               `json:"organizations,omitempty"`
+	RelatedResources []string               `json:"related_resources,omitempty"`
+	Custom           map[string]interface{} `json:"custom,omitempty"`
+}
+
+// Copy returns a copy of a. The custom values are shared with a because they
+// are not modified after parsing.
+func (a *Annotations) Copy() *Annotations {
+	if a == nil {
+		return nil
+	}
+	cpy := *a
+	cpy.Authors = copyStrings(a.Authors)
+	cpy.Organizations = copyStrings(a.Organizations)
+	cpy.RelatedResources = copyStrings(a.RelatedResources)
+	return &cpy
+}
+
+// Value returns the annotations as an object value. The object is what
+// rego.metadata.rule() returns at evaluation time.
+func (a *Annotations) Value() Value {
+	if a == nil {
+		return NewObject()
+	}
+	// Annotations are constructed from JSON-compatible values so the
+	// conversion cannot fail.
+	return MustInterfaceToValue(util.MustUnmarshalJSON(util.MustMarshalJSON(a)))
+}
+
+func (a *Annotations) String() string {
+	return a.Value().String()
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	cpy := make([]string, len(s))
+	copy(cpy, s)
+	return cpy
+}
+
+// attachAnnotations parses the metadata blocks contained in the module's
+// comments and attaches them to the package or rule they precede.
+func attachAnnotations(mod *Module) Errors {
+
+	var errs Errors
+
+	comments := uniqueComments(mod.Comments)
+
+	for i := 0; i < len(comments); i++ {
+
+		c := comments[i]
+		if strings.TrimSpace(string(c.Text)) != annotationsMarker {
+			continue
+		}
+
+		// The block consists of all comments on consecutive lines following
+		// the marker.
+		lines := []string{}
+		last := c.Location.Row
+		for i+1 < len(comments) && comments[i+1].Location.Row == last+1 {
+			i++
+			lines = append(lines, string(comments[i].Text))
+			last = comments[i].Location.Row
+		}
+
+		a, err := parseAnnotations(c.Location, strings.Join(lines, "\n"))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if err := attachAnnotationsToNode(mod, a, last+1); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// uniqueComments returns the comments sorted by position. The parser may
+// record the same comment more than once when it backtracks so duplicates are
+// removed.
+func uniqueComments(comments []*Comment) []*Comment {
+	result := make([]*Comment, 0, len(comments))
+	for _, c := range comments {
+		if c.Location == nil {
+			continue
+		}
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i].Location, result[j].Location
+		if a.Row != b.Row {
+			return a.Row < b.Row
+		}
+		return a.Col < b.Col
+	})
+	n := 0
+	for i := range result {
+		if n > 0 && result[n-1].Location.Row == result[i].Location.Row {
+			continue
+		}
+		result[n] = result[i]
+		n++
+	}
+	return result[:n]
+}
+
+func attachAnnotationsToNode(mod *Module, a *Annotations, row int) *Error {
+
+	if mod.Package != nil && mod.Package.Location != nil && mod.Package.Location.Row == row {
+		return setAnnotations(&mod.Annotations, a, annotationScopePackage)
+	}
+
+	for _, rule := range mod.Rules {
+		if rule.Location != nil && rule.Location.Row == row {
+			return setAnnotations(&rule.Annotations, a, annotationScopeRule)
+		}
+	}
+
+	return NewError(ParseErr, a.Location, "metadata block must be followed by a package or rule")
+}
+
+func setAnnotations(dst **Annotations, a *Annotations, scope string) *Error {
+	if a.Scope == "" {
+		a.Scope = scope
+	} else if a.Scope != scope {
+		return NewError(ParseErr, a.Location, "metadata block with %v scope must be followed by a %v", a.Scope, a.Scope)
+	}
+	if *dst != nil {
+		return NewError(ParseErr, a.Location, "multiple metadata blocks for same %v", scope)
+	}
+	*dst = a
+	return nil
+}
+
+// parseAnnotations parses the YAML document contained in a metadata block and
+// validates the known keys.
+func parseAnnotations(loc *Location, doc string) (*Annotations, *Error) {
+
+	var raw map[string]interface{}
+
+	if err := util.Unmarshal([]byte(doc), &raw); err != nil {
+		return nil, NewError(ParseErr, loc, "invalid metadata block: %v", err)
+	}
+
+	a := &Annotations{Location: loc}
+	keys := make([]string, 0, len(raw))
+
+	for k := range raw {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		var err error
+		v := raw[k]
+		switch k {
+		case "scope":
+			a.Scope, err = annotationString(k, v)
+			if err == nil && a.Scope != annotationScopePackage && a.Scope != annotationScopeRule {
+				err = fmt.Errorf("invalid scope %q (must be %q or %q)", a.Scope, annotationScopePackage, annotationScopeRule)
+			}
+		case "title":
+			a.Title, err = annotationString(k, v)
+		case "description":
+			a.Description, err = annotationString(k, v)
+		case "authors":
+			a.Authors, err = annotationStrings(k, v)
+		case "organizations":
+			a.Organizations, err = annotationStrings(k, v)
+		case "related_resources":
+			a.RelatedResources, err = annotationStrings(k, v)
+		case "custom":
+			var ok bool
+			if a.Custom, ok = v.(map[string]interface{}); !ok {
+				err = fmt.Errorf("custom must be a map")
+			}
+		default:
+			err = fmt.Errorf("unknown key %q", k)
+		}
+		if err != nil {
+			return nil, NewError(ParseErr, loc, "invalid metadata block: %v", err)
+		}
+	}
+
+	return a, nil
+}
+
+func annotationString(key string, v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%v must be a string", key)
+	}
+	return s, nil
+}
+
+func annotationStrings(key string, v interface{}) ([]string, error) {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v must be a list of strings", key)
+	}
+	result := make([]string, len(arr))
+	for i := range arr {
+		s, ok := arr[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("%v must be a list of strings", key)
+		}
+		result[i] = s
+	}
+	return result, nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package ast
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnnotationsAttached(t *testing.T) {
+
+	module := MustParseModule(`# METADATA
+# title: Container policies
+# authors:
+# - alice
+package k8s
+
+# METADATA
+# title: Deny privileged containers
+# description: Privileged containers can escape the sandbox.
+# related_resources:
+# - https://kubernetes.io/docs/concepts/policy/pod-security-policy/
+# custom:
+#   severity: high
+deny[msg] { msg = "privileged" }
+
+# An ordinary comment.
+allow { true }
+`)
+
+	expPkg := &Annotations{
+		Scope:   "package",
+		Title:   "Container policies",
+		Authors: []string{"alice"},
+	}
+
+	expRule := &Annotations{
+		Scope:            "rule",
+		Title:            "Deny privileged containers",
+		Description:      "Privileged containers can escape the sandbox.",
+		RelatedResources: []string{"https://kubernetes.io/docs/concepts/policy/pod-security-policy/"},
+		Custom:           map[string]interface{}{"severity": "high"},
+	}
+
+	module.Annotations.Location = nil
+	module.Rules[0].Annotations.Location = nil
+
+	if !reflect.DeepEqual(module.Annotations, expPkg) {
+		t.Fatalf("Expected package annotations %v but got: %v", expPkg, module.Annotations)
+	}
+
+	if !reflect.DeepEqual(module.Rules[0].Annotations, expRule) {
+		t.Fatalf("Expected rule annotations %v but got: %v", expRule, module.Rules[0].Annotations)
+	}
+
+	if module.Rules[1].Annotations != nil {
+		t.Fatalf("Expected no annotations on allow but got: %v", module.Rules[1].Annotations)
+	}
+
+	if !reflect.DeepEqual(module.Copy().Rules[0].Annotations, expRule) {
+		t.Fatal("Expected annotations to be copied")
+	}
+
+	var buf bytes.Buffer
+	Pretty(&buf, module.Rules[0])
+
+	if !strings.Contains(buf.String(), `annotations {`) || !strings.Contains(buf.String(), `"title": "Deny privileged containers"`) {
+		t.Fatalf("Expected annotations in pretty output but got:\n%v", buf.String())
+	}
+}
+
+func TestAnnotationsErrors(t *testing.T) {
+
+	tests := []struct {
+		note     string
+		module   string
+		expected string
+	}{
+		{
+			note: "unknown key",
+			module: `package test
+
+# METADATA
+# severity: high
+p { true }`,
+			expected: `invalid metadata block: unknown key "severity"`,
+		},
+		{
+			note: "bad title",
+			module: `package test
+
+# METADATA
+# title: [a, b]
+p { true }`,
+			expected: "invalid metadata block: title must be a string",
+		},
+		{
+			note: "bad authors",
+			module: `package test
+
+# METADATA
+# authors: alice
+p { true }`,
+			expected: "invalid metadata block: authors must be a list of strings",
+		},
+		{
+			note: "bad custom",
+			module: `package test
+
+# METADATA
+# custom: [1]
+p { true }`,
+			expected: "invalid metadata block: custom must be a map",
+		},
+		{
+			note: "bad scope",
+			module: `package test
+
+# METADATA
+# scope: document
+p { true }`,
+			expected: `invalid metadata block: invalid scope "document" (must be "package" or "rule")`,
+		},
+		{
+			note: "scope mismatch",
+			module: `# METADATA
+# scope: rule
+package test`,
+			expected: "metadata block with rule scope must be followed by a rule",
+		},
+		{
+			note: "not attached",
+			module: `package test
+
+# METADATA
+# title: dangling
+
+p { true }`,
+			expected: "metadata block must be followed by a package or rule",
+		},
+		{
+			note: "bad yaml",
+			module: `package test
+
+# METADATA
+# title: "unterminated
+p { true }`,
+			expected: "invalid metadata block:",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			_, err := ParseModule("test.rego", tc.module)
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			errs, ok := err.(Errors)
+			if !ok || len(errs) != 1 || errs[0].Code != ParseErr || !strings.Contains(errs[0].Message, tc.expected) {
+				t.Fatalf("Expected parse error containing %q but got: %v", tc.expected, err)
+			}
+			if errs[0].Location == nil || errs[0].Location.File != "test.rego" {
+				t.Fatalf("Expected error location but got: %v", errs[0].Location)
+			}
+		})
+	}
+}
+
+func TestAnnotationsValue(t *testing.T) {
+
+	var a *Annotations
+
+	if a.Value().Compare(NewObject()) != 0 {
+		t.Fatalf("Expected empty object for nil annotations but got: %v", a.Value())
+	}
+
+	a = &Annotations{
+		Scope:  "rule",
+		Title:  "test",
+		Custom: map[string]interface{}{"severity": "high"},
+	}
+
+	exp := MustParseTerm(`{"scope": "rule", "title": "test", "custom": {"severity": "high"}}`).Value
+
+	if a.Value().Compare(exp) != 0 {
+		t.Fatalf("Expected %v but got: %v", exp, a.Value())
+	}
+}
@@ -50,6 +50,15 @@ var DefaultBuiltins = [...]*Builtin{
 	Round,
 	Abs,
 	Rem,
+	NumbersRange,
+
+	// Units
+	UnitsParse,
+	UnitsParseBytes,
+
+	// Semantic Versions
+	SemverIsValid,
+	SemverCompare,
 
 	// Binary
 	And,
@@ -61,14 +70,32 @@ var DefaultBuiltins = [...]*Builtin{
 	Product,
 	Max,
 	Min,
+	Any,
+	All,
+
+	// Arrays
+	ArrayConcat,
+	ArraySlice,
+	ArrayReverse,
 
 	// Casting
 	ToNumber,
+	CastArray,
+	CastSet,
+	CastString,
+	CastBoolean,
+	CastObject,
 
 	// Regular Expressions
 	RegexMatch,
+	RegexSplit,
+	RegexFindN,
+	RegexTemplateMatch,
 	GlobsMatch,
 
+	// Glob
+	GlobMatch,
+
 	// Sets
 	SetDiff,
 	Intersection,
@@ -86,9 +113,21 @@ var DefaultBuiltins = [...]*Builtin{
 	EndsWith,
 	Split,
 	Replace,
+	ReplaceN,
 	Trim,
 	Sprintf,
 
+	// Objects
+	ObjectGet,
+	ObjectRemove,
+	ObjectFilter,
+	ObjectUnion,
+
+	// JSON Object Manipulation
+	JSONFilter,
+	JSONRemove,
+	JSONPatch,
+
 	// Encoding
 	JSONMarshal,
 	JSONUnmarshal,
@@ -96,6 +135,14 @@ var DefaultBuiltins = [...]*Builtin{
 	Base64Decode,
 	Base64UrlEncode,
 	Base64UrlDecode,
+	Base64UrlEncodeNoPad,
+	URLQueryEncode,
+	URLQueryDecode,
+	URLQueryEncodeObject,
+	URLQueryDecodeObject,
+	HexEncode,
+	HexDecode,
+	ParseURL,
 	YAMLMarshal,
 	YAMLUnmarshal,
 
@@ -110,12 +157,31 @@ var DefaultBuiltins = [...]*Builtin{
 	ParseDurationNanos,
 	Date,
 	Clock,
+	Weekday,
+	AddDate,
+	Diff,
 
 	// Crypto
 	CryptoX509ParseCertificates,
+	CryptoX509ParseAndVerifyCertificates,
+	CryptoX509ParseCertificateRequest,
+	CryptoParsePrivateKeys,
+	CryptoMd5,
+	CryptoSha1,
+	CryptoSha256,
+	CryptoHmacMd5,
+	CryptoHmacSha1,
+	CryptoHmacSha256,
+	CryptoHmacSha512,
+	CryptoHmacEqual,
+
+	// UUIDs
+	UUIDRFC4122,
 
 	// Graphs
 	WalkBuiltin,
+	GraphReachable,
+	GraphReachablePaths,
 
 	// Sort
 	Sort,
@@ -135,6 +201,9 @@ var DefaultBuiltins = [...]*Builtin{
 
 	// Tracing
 	Trace,
+
+	// Metadata
+	RegoMetadataRule,
 }
 
 // BuiltinMap provides a convenient mapping of built-in names to
@@ -147,6 +216,8 @@ var BuiltinMap map[string]*Builtin
 var IgnoreDuringPartialEval = []*Builtin{
 	NowNanos,
 	HTTPSend,
+	UUIDRFC4122,
+	CryptoX509ParseAndVerifyCertificates,
 }
 
 /**
@@ -317,6 +388,69 @@ var Rem = &Builtin{
 	),
 }
 
+// NumbersRange returns an array of integers from the first operand to the
+// second operand (inclusive). If the first operand is greater than the second,
+// the array is in descending order.
+var NumbersRange = &Builtin{
+	Name: "numbers.range",
+	Decl: types.NewFunction(
+		types.Args(
+			types.N,
+			types.N,
+		),
+		types.NewArray(nil, types.N),
+	),
+}
+
+/**
+ * Units
+ */
+
+// UnitsParse converts a string with an optional SI or IEC unit suffix (e.g.,
+// "100m", "1.5G" or "512Mi") into an exact number.
+var UnitsParse = &Builtin{
+	Name: "units.parse",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.N,
+	),
+}
+
+// UnitsParseBytes converts a string with an optional SI or IEC byte unit suffix
+// (e.g., "10KB" or "512MiB") into an integer number of bytes.
+var UnitsParseBytes = &Builtin{
+	Name: "units.parse_bytes",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.N,
+	),
+}
+
+/**
+ * Semantic Versions
+ */
+
+// SemverIsValid returns true if the operand is a valid semantic version.
+var SemverIsValid = &Builtin{
+	Name: "semver.is_valid",
+	Decl: types.NewFunction(
+		types.Args(types.A),
+		types.B,
+	),
+}
+
+// SemverCompare compares two semantic versions and returns -1, 0, or 1.
+var SemverCompare = &Builtin{
+	Name: "semver.compare",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+		),
+		types.N,
+	),
+}
+
 /**
  * Binary
  */
@@ -425,13 +559,85 @@ var Min = &Builtin{
 	),
 }
 
+// All takes a list and returns true if all of the items
+// are true. A collection of length 0 returns true.
+var All = &Builtin{
+	Name: "all",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewAny(
+				types.NewSet(types.A),
+				types.NewArray(nil, types.A),
+			),
+		),
+		types.B,
+	),
+}
+
+// Any takes a collection and returns true if any of the items
+// is true. A collection of length 0 returns false.
+var Any = &Builtin{
+	Name: "any",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewAny(
+				types.NewSet(types.A),
+				types.NewArray(nil, types.A),
+			),
+		),
+		types.B,
+	),
+}
+
+/**
+ * Arrays
+ */
+
+// ArrayConcat returns the result of concatenating two arrays together.
+var ArrayConcat = &Builtin{
+	Name: "array.concat",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewArray(nil, types.A),
+			types.NewArray(nil, types.A),
+		),
+		types.NewArray(nil, types.A),
+	),
+}
+
+// ArraySlice returns a slice of a given array from the start index (inclusive)
+// to the stop index (exclusive). Indices outside of the array are clamped.
+var ArraySlice = &Builtin{
+	Name: "array.slice",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewArray(nil, types.A),
+			types.N,
+			types.N,
+		),
+		types.NewArray(nil, types.A),
+	),
+}
+
+// ArrayReverse returns a new array with the elements of the given array in
+// reverse order.
+var ArrayReverse = &Builtin{
+	Name: "array.reverse",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewArray(nil, types.A),
+		),
+		types.NewArray(nil, types.A),
+	),
+}
+
 /**
  * Casting
  */
 
-// ToNumber takes a string, bool, or number value and converts it to a number.
-// Strings are converted to numbers using strconv.Atoi.
-// Boolean false is converted to 0 and boolean true is converted to 1.
+// ToNumber takes a string, bool, null, or number value and converts it to a
+// number. Strings are converted to numbers using strconv.ParseFloat.
+// Boolean false and null are converted to 0 and boolean true is converted to 1.
 var ToNumber = &Builtin{
 	Name: "to_number",
 	Decl: types.NewFunction(
@@ -447,6 +653,62 @@ var ToNumber = &Builtin{
 	),
 }
 
+// CastArray checks the underlying type of the input. If it is array or set, an
+// array containing the values is returned. If it is neither an array nor a set,
+// an error is thrown.
+var CastArray = &Builtin{
+	Name: "cast_array",
+	Decl: types.NewFunction(
+		types.Args(types.NewAny(
+			types.NewArray(nil, types.A),
+			types.NewSet(types.A),
+		)),
+		types.NewArray(nil, types.A),
+	),
+}
+
+// CastSet checks the underlying type of the input. If it is a set, the set is
+// returned. If it is an array, the array is returned in set form (all
+// duplicates removed). If neither, an error is thrown.
+var CastSet = &Builtin{
+	Name: "cast_set",
+	Decl: types.NewFunction(
+		types.Args(types.NewAny(
+			types.NewArray(nil, types.A),
+			types.NewSet(types.A),
+		)),
+		types.NewSet(types.A),
+	),
+}
+
+// CastString returns input if it is a string; if not returns error.
+var CastString = &Builtin{
+	Name: "cast_string",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
+// CastBoolean returns input if it is a boolean; if not returns error.
+var CastBoolean = &Builtin{
+	Name: "cast_boolean",
+	Decl: types.NewFunction(
+		types.Args(types.B),
+		types.B,
+	),
+}
+
+// CastObject returns the given object if it is an object; throws an error
+// otherwise.
+var CastObject = &Builtin{
+	Name: "cast_object",
+	Decl: types.NewFunction(
+		types.Args(types.NewObject(nil, types.NewDynamicProperty(types.A, types.A))),
+		types.NewObject(nil, types.NewDynamicProperty(types.A, types.A)),
+	),
+}
+
 /**
  * Regular Expressions
  */
@@ -464,6 +726,49 @@ var RegexMatch = &Builtin{
 	),
 }
 
+// RegexSplit splits the input string by the occurrences of the given pattern.
+var RegexSplit = &Builtin{
+	Name: "regex.split",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+		),
+		types.NewArray(nil, types.S),
+	),
+}
+
+// RegexFindN returns an array of all successive matches of the pattern in the
+// input string. The third argument limits the number of matches returned; if
+// it is negative, all matches are returned.
+var RegexFindN = &Builtin{
+	Name: "regex.find_n",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+			types.N,
+		),
+		types.NewArray(nil, types.S),
+	),
+}
+
+// RegexTemplateMatch takes a template string with regular expressions embedded
+// between the given start and end delimiters (e.g., "urn:foo:{[a-z]+}") and
+// evaluates to true if the input string matches the template.
+var RegexTemplateMatch = &Builtin{
+	Name: "regex.template_match",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+			types.S,
+			types.S,
+		),
+		types.B,
+	),
+}
+
 // GlobsMatch takes two strings regexp-style strings and evaluates to true if their
 // intersection matches a non-empty set of non-empty strings.
 // Examples:
@@ -480,6 +785,25 @@ var GlobsMatch = &Builtin{
 	),
 }
 
+/**
+ * Glob
+ */
+
+// GlobMatch takes a glob pattern, an array of delimiters, and a string and
+// evaluates to true if the string matches the pattern. If the array of
+// delimiters is empty, "." is used as the default delimiter.
+var GlobMatch = &Builtin{
+	Name: "glob.match",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.NewArray(nil, types.S),
+			types.S,
+		),
+		types.B,
+	),
+}
+
 /**
  * Strings
  */
@@ -617,6 +941,24 @@ var Replace = &Builtin{
 	),
 }
 
+// ReplaceN replaces all instances of the keys in the object with the
+// corresponding values. Replacements are performed in a single pass over the
+// string without overlapping matches.
+var ReplaceN = &Builtin{
+	Name: "strings.replace_n",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewObject(
+				nil,
+				types.NewDynamicProperty(
+					types.S,
+					types.S)),
+			types.S,
+		),
+		types.S,
+	),
+}
+
 // Trim returns the given string will all leading or trailing instances of the second
 // argument removed.
 var Trim = &Builtin{
@@ -642,6 +984,176 @@ var Sprintf = &Builtin{
 	),
 }
 
+/**
+ * Objects
+ */
+
+// ObjectGet returns the value of the key in the object or the default value
+// if the key does not exist.
+var ObjectGet = &Builtin{
+	Name: "object.get",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewObject(
+				nil,
+				types.NewDynamicProperty(types.A, types.A),
+			),
+			types.A,
+			types.A,
+		),
+		types.A,
+	),
+}
+
+// ObjectRemove returns a new object without the keys given in the second
+// operand. The keys may be given as an array, set, or object.
+var ObjectRemove = &Builtin{
+	Name: "object.remove",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewObject(
+				nil,
+				types.NewDynamicProperty(types.A, types.A),
+			),
+			types.NewAny(
+				types.NewArray(nil, types.A),
+				types.NewSet(types.A),
+				types.NewObject(nil, types.NewDynamicProperty(types.A, types.A)),
+			),
+		),
+		types.NewObject(nil, types.NewDynamicProperty(types.A, types.A)),
+	),
+}
+
+// ObjectFilter returns a new object with only the keys given in the second
+// operand. The keys may be given as an array, set, or object.
+var ObjectFilter = &Builtin{
+	Name: "object.filter",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewObject(
+				nil,
+				types.NewDynamicProperty(types.A, types.A),
+			),
+			types.NewAny(
+				types.NewArray(nil, types.A),
+				types.NewSet(types.A),
+				types.NewObject(nil, types.NewDynamicProperty(types.A, types.A)),
+			),
+		),
+		types.NewObject(nil, types.NewDynamicProperty(types.A, types.A)),
+	),
+}
+
+// ObjectUnion returns the deep merge of two objects. If a key exists in both
+// objects, the value from the second object is used unless both values are
+// objects, in which case they are merged recursively.
+var ObjectUnion = &Builtin{
+	Name: "object.union",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewObject(
+				nil,
+				types.NewDynamicProperty(types.A, types.A),
+			),
+			types.NewObject(
+				nil,
+				types.NewDynamicProperty(types.A, types.A),
+			),
+		),
+		types.NewObject(nil, types.NewDynamicProperty(types.A, types.A)),
+	),
+}
+
+/**
+ * JSON Object Manipulation
+ */
+
+// JSONFilter filters the JSON object and returns only the documents under the
+// given paths. Paths are slash-separated strings (e.g., "a/b/c") or arrays of
+// path segments.
+var JSONFilter = &Builtin{
+	Name: "json.filter",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewObject(
+				nil,
+				types.NewDynamicProperty(types.A, types.A),
+			),
+			types.NewAny(
+				types.NewArray(
+					nil,
+					types.NewAny(
+						types.S,
+						types.NewArray(nil, types.A),
+					),
+				),
+				types.NewSet(
+					types.NewAny(
+						types.S,
+						types.NewArray(nil, types.A),
+					),
+				),
+			),
+		),
+		types.A,
+	),
+}
+
+// JSONRemove removes the documents under the given paths from the JSON
+// object. Paths are slash-separated strings (e.g., "a/b/c") or arrays of path
+// segments.
+var JSONRemove = &Builtin{
+	Name: "json.remove",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewObject(
+				nil,
+				types.NewDynamicProperty(types.A, types.A),
+			),
+			types.NewAny(
+				types.NewArray(
+					nil,
+					types.NewAny(
+						types.S,
+						types.NewArray(nil, types.A),
+					),
+				),
+				types.NewSet(
+					types.NewAny(
+						types.S,
+						types.NewArray(nil, types.A),
+					),
+				),
+			),
+		),
+		types.A,
+	),
+}
+
+// JSONPatch applies the JSON Patch (RFC 6902) operations to the document. If
+// an operation cannot be applied (e.g., a path does not exist or a test
+// operation fails), the result is undefined.
+var JSONPatch = &Builtin{
+	Name: "json.patch",
+	Decl: types.NewFunction(
+		types.Args(
+			types.A,
+			types.NewArray(
+				nil,
+				types.NewObject(
+					[]*types.StaticProperty{
+						types.NewStaticProperty("op", types.S),
+						types.NewStaticProperty("path", types.A),
+					},
+					types.NewDynamicProperty(types.A, types.A),
+				),
+			),
+		),
+		types.A,
+	),
+}
+
 /**
  * JSON
  */
@@ -700,6 +1212,92 @@ var Base64UrlDecode = &Builtin{
 	),
 }
 
+// Base64UrlEncodeNoPad serializes the input string into base64url encoding
+// without padding.
+var Base64UrlEncodeNoPad = &Builtin{
+	Name: "base64url.encode_no_pad",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
+// URLQueryEncode escapes the input string so it can be placed inside a URL
+// query.
+var URLQueryEncode = &Builtin{
+	Name: "urlquery.encode",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
+// URLQueryDecode unescapes the URL query encoded input string.
+var URLQueryDecode = &Builtin{
+	Name: "urlquery.decode",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
+// URLQueryEncodeObject serializes the input object into a URL query string.
+// Values may be strings or arrays/sets of strings.
+var URLQueryEncodeObject = &Builtin{
+	Name: "urlquery.encode_object",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewObject(nil, types.NewDynamicProperty(
+				types.S,
+				types.NewAny(
+					types.S,
+					types.NewArray(nil, types.S),
+					types.NewSet(types.S),
+				),
+			)),
+		),
+		types.S,
+	),
+}
+
+// URLQueryDecodeObject deserializes the URL query string into an object that
+// maps each parameter to the array of its values.
+var URLQueryDecodeObject = &Builtin{
+	Name: "urlquery.decode_object",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.NewObject(nil, types.NewDynamicProperty(types.S, types.NewArray(nil, types.S))),
+	),
+}
+
+// HexEncode serializes the input string into hex encoding.
+var HexEncode = &Builtin{
+	Name: "hex.encode",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
+// HexDecode deserializes the hex encoded input string.
+var HexDecode = &Builtin{
+	Name: "hex.decode",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
+// ParseURL parses the input string into an object containing the scheme,
+// host, port, path, query and fragment of the URL.
+var ParseURL = &Builtin{
+	Name: "parse_url",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.NewObject(nil, types.NewDynamicProperty(types.S, types.A)),
+	),
+}
+
 // YAMLMarshal serializes the input term.
 var YAMLMarshal = &Builtin{
 	Name: "yaml.marshal",
@@ -791,31 +1389,99 @@ var ParseDurationNanos = &Builtin{
 	),
 }
 
-// Date returns the [year, month, day] for the nanoseconds since epoch.
+// Date returns the [year, month, day] for the nanoseconds since epoch. The
+// operand may also be a [ns, tz] array where tz is a time zone name.
 var Date = &Builtin{
 	Name: "time.date",
 	Decl: types.NewFunction(
-		types.Args(types.N),
+		types.Args(
+			types.NewAny(
+				types.N,
+				types.NewArray([]types.Type{types.N, types.S}, nil),
+			),
+		),
 		types.NewArray([]types.Type{types.N, types.N, types.N}, nil),
 	),
 }
 
-// Clock returns the [hour, minute, second] of the day for the nanoseconds since epoch.
+// Clock returns the [hour, minute, second] of the day for the nanoseconds
+// since epoch. The operand may also be a [ns, tz] array where tz is a time
+// zone name.
 var Clock = &Builtin{
 	Name: "time.clock",
 	Decl: types.NewFunction(
-		types.Args(types.N),
+		types.Args(
+			types.NewAny(
+				types.N,
+				types.NewArray([]types.Type{types.N, types.S}, nil),
+			),
+		),
 		types.NewArray([]types.Type{types.N, types.N, types.N}, nil),
 	),
 }
 
+// Weekday returns the day of the week (Monday, Tuesday, ...) for the
+// nanoseconds since epoch. The operand may also be a [ns, tz] array where tz
+// is a time zone name.
+var Weekday = &Builtin{
+	Name: "time.weekday",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewAny(
+				types.N,
+				types.NewArray([]types.Type{types.N, types.S}, nil),
+			),
+		),
+		types.S,
+	),
+}
+
+// AddDate returns the nanoseconds since epoch after adding years, months and
+// days to the nanoseconds since epoch. The first operand may also be a
+// [ns, tz] array in which case the calendar arithmetic is performed in the
+// given time zone.
+var AddDate = &Builtin{
+	Name: "time.add_date",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewAny(
+				types.N,
+				types.NewArray([]types.Type{types.N, types.S}, nil),
+			),
+			types.N,
+			types.N,
+			types.N,
+		),
+		types.N,
+	),
+}
+
+// Diff returns the difference [years, months, days, hours, minutes, seconds]
+// between two times given as nanoseconds since epoch or [ns, tz] arrays.
+var Diff = &Builtin{
+	Name: "time.diff",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewAny(
+				types.N,
+				types.NewArray([]types.Type{types.N, types.S}, nil),
+			),
+			types.NewAny(
+				types.N,
+				types.NewArray([]types.Type{types.N, types.S}, nil),
+			),
+		),
+		types.NewArray([]types.Type{types.N, types.N, types.N, types.N, types.N, types.N}, nil),
+	),
+}
+
 /**
  * Crypto.
  */
 
 // CryptoX509ParseCertificates returns one or more certificates from the given
 // base64 encoded string containing DER encoded certificates that have been
-// concatenated.
+// concatenated. PEM encoded certificates are accepted as well.
 var CryptoX509ParseCertificates = &Builtin{
 	Name: "crypto.x509.parse_certificates",
 	Decl: types.NewFunction(
@@ -824,6 +1490,135 @@ var CryptoX509ParseCertificates = &Builtin{
 	),
 }
 
+// CryptoX509ParseAndVerifyCertificates returns [valid, certificates] for the
+// given certificate chain. The first certificate is the leaf and the remaining
+// certificates are intermediates. The chain is verified against the roots
+// given in the second operand. The third operand is an object of verification
+// options ("current_time", "dns_name" and "key_usages"). If "current_time" is
+// not given, the chain is verified at the current time so the built-in is not
+// evaluated during partial evaluation.
+var CryptoX509ParseAndVerifyCertificates = &Builtin{
+	Name: "crypto.x509.parse_and_verify_certificates",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+			types.NewObject(nil, types.NewDynamicProperty(types.S, types.A)),
+		),
+		types.NewArray([]types.Type{
+			types.B,
+			types.NewArray(nil, types.NewObject(nil, types.NewDynamicProperty(types.S, types.A))),
+		}, nil),
+	),
+}
+
+// CryptoX509ParseCertificateRequest returns a certificate signing request
+// parsed from the given PEM or base64 encoded DER string.
+var CryptoX509ParseCertificateRequest = &Builtin{
+	Name: "crypto.x509.parse_certificate_request",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.NewObject(nil, types.NewDynamicProperty(types.S, types.A)),
+	),
+}
+
+// CryptoParsePrivateKeys returns the RSA and EC private keys contained in the
+// given PEM string as JSON Web Keys.
+var CryptoParsePrivateKeys = &Builtin{
+	Name: "crypto.parse_private_keys",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.NewArray(nil, types.NewObject(nil, types.NewDynamicProperty(types.S, types.A))),
+	),
+}
+
+// CryptoMd5 returns a string representing the input string hashed with the md5 function
+var CryptoMd5 = &Builtin{
+	Name: "crypto.md5",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
+// CryptoSha1 returns a string representing the input string hashed with the sha1 function
+var CryptoSha1 = &Builtin{
+	Name: "crypto.sha1",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
+// CryptoSha256 returns a string representing the input string hashed with the sha256 function
+var CryptoSha256 = &Builtin{
+	Name: "crypto.sha256",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
+// CryptoHmacMd5 returns a string representing the MD5 HMAC of the input message using the input key
+var CryptoHmacMd5 = &Builtin{
+	Name: "crypto.hmac.md5",
+	Decl: types.NewFunction(
+		types.Args(types.S, types.S),
+		types.S,
+	),
+}
+
+// CryptoHmacSha1 returns a string representing the SHA1 HMAC of the input message using the input key
+var CryptoHmacSha1 = &Builtin{
+	Name: "crypto.hmac.sha1",
+	Decl: types.NewFunction(
+		types.Args(types.S, types.S),
+		types.S,
+	),
+}
+
+// CryptoHmacSha256 returns a string representing the SHA256 HMAC of the input message using the input key
+var CryptoHmacSha256 = &Builtin{
+	Name: "crypto.hmac.sha256",
+	Decl: types.NewFunction(
+		types.Args(types.S, types.S),
+		types.S,
+	),
+}
+
+// CryptoHmacSha512 returns a string representing the SHA512 HMAC of the input message using the input key
+var CryptoHmacSha512 = &Builtin{
+	Name: "crypto.hmac.sha512",
+	Decl: types.NewFunction(
+		types.Args(types.S, types.S),
+		types.S,
+	),
+}
+
+// CryptoHmacEqual compares two MACs in constant time so that the comparison
+// does not leak timing information.
+var CryptoHmacEqual = &Builtin{
+	Name: "crypto.hmac.equal",
+	Decl: types.NewFunction(
+		types.Args(types.S, types.S),
+		types.B,
+	),
+}
+
+/**
+ * UUIDs
+ */
+
+// UUIDRFC4122 returns a version 4 UUID string. The same seed yields the same
+// UUID within a single query.
+var UUIDRFC4122 = &Builtin{
+	Name: "uuid.rfc4122",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
 /**
  * Graphs.
  */
@@ -845,6 +1640,48 @@ var WalkBuiltin = &Builtin{
 	),
 }
 
+// GraphReachable returns the set of nodes reachable from the initial nodes in
+// the graph. The graph is an object that maps each node to a set or array of
+// neighbouring nodes.
+var GraphReachable = &Builtin{
+	Name: "graph.reachable",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewObject(
+				nil,
+				types.NewDynamicProperty(
+					types.A,
+					types.NewAny(
+						types.NewSet(types.A),
+						types.NewArray(nil, types.A)),
+				)),
+			types.NewAny(types.NewSet(types.A), types.NewArray(nil, types.A)),
+		),
+		types.NewSet(types.A),
+	),
+}
+
+// GraphReachablePaths returns the set of shortest paths from the initial
+// nodes in the graph to the reachable nodes. Each node is reached once so only
+// the paths that are not prefixes of other paths are returned.
+var GraphReachablePaths = &Builtin{
+	Name: "graph.reachable_paths",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewObject(
+				nil,
+				types.NewDynamicProperty(
+					types.A,
+					types.NewAny(
+						types.NewSet(types.A),
+						types.NewArray(nil, types.A)),
+				)),
+			types.NewAny(types.NewSet(types.A), types.NewArray(nil, types.A)),
+		),
+		types.NewSet(types.NewArray(nil, types.A)),
+	),
+}
+
 /**
  * Sorting
  */
@@ -991,27 +1828,50 @@ var Trace = &Builtin{
 	),
 }
 
+/**
+ * Metadata
+ */
+
+// RegoMetadataRule returns the annotations declared in the metadata block of
+// the rule that contains the call. Calls are replaced by the compiler; outside
+// of rules (e.g., in queries) the built-in returns an empty object.
+var RegoMetadataRule = &Builtin{
+	Name: "rego.metadata.rule",
+	Decl: types.NewFunction(
+		nil,
+		types.NewObject(nil, types.NewDynamicProperty(types.S, types.A)),
+	),
+}
+
 /**
  * Set
  */
 
-// Intersection returns the intersection of the given input sets
+// Intersection returns the intersection of the given input sets. The sets may
+// be given as a set or an array.
 var Intersection = &Builtin{
 	Name: "intersection",
 	Decl: types.NewFunction(
 		types.Args(
-			types.NewSet(types.NewSet(types.A)),
+			types.NewAny(
+				types.NewSet(types.NewSet(types.A)),
+				types.NewArray(nil, types.NewSet(types.A)),
+			),
 		),
 		types.NewSet(types.A),
 	),
 }
 
-// Union returns the union of the given input sets
+// Union returns the union of the given input sets. The sets may be given as a
+// set or an array.
 var Union = &Builtin{
 	Name: "union",
 	Decl: types.NewFunction(
 		types.Args(
-			types.NewSet(types.NewSet(types.A)),
+			types.NewAny(
+				types.NewSet(types.NewSet(types.A)),
+				types.NewArray(nil, types.NewSet(types.A)),
+			),
 		),
 		types.NewSet(types.A),
 	),
@@ -1023,7 +1883,8 @@ var Union = &Builtin{
 
 // SetDiff has been replaced by the minus built-in.
 var SetDiff = &Builtin{
-	Name: "set_diff",
+	Name:       "set_diff",
+	Deprecated: true,
 	Decl: types.NewFunction(
 		types.Args(
 			types.NewSet(types.A),
@@ -1040,6 +1901,17 @@ type Builtin struct {
 	Infix    string          // Unique name of infix operator. Default should be unset.
 	Decl     *types.Function // Built-in function type declaration.
 	Relation bool            // Indicates if the built-in acts as a relation.
+
+	// Nondeterministic indicates the built-in may return different outputs
+	// for the same inputs, e.g., because it calls out to an external
+	// service. Calls to non-deterministic built-ins are not evaluated
+	// during partial evaluation.
+	Nondeterministic bool
+
+	// Deprecated indicates the built-in has been replaced and should not be
+	// used anymore. Calls to deprecated built-ins are reported by the
+	// compiler in strict mode.
+	Deprecated bool
 }
 
 // Expr creates a new expression for the built-in with the given operands.
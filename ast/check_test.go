@@ -624,6 +624,10 @@ func TestCheckBuiltinErrors(t *testing.T) {
 		{"sets-any", `sum({1,2,"3",4}, x)`},
 		{"virtual-ref", `plus(data.test.p, data.deabeef, 0)`},
 		{"function-ref", `data.test.f(1, data.test.f)`},
+		{"array-concat-bad-input", `array.concat({1, 2}, [3], x)`},
+		{"array-slice-bad-index", `array.slice([1, 2, 3], "1", 2, x)`},
+		{"numbers-range-bad-input", `numbers.range(1, "10", x)`},
+		{"union-bad-elements", `union([{1}, [2]], x)`},
 	}
 
 	env := newTestEnv([]string{
@@ -76,10 +76,15 @@ type Compiler struct {
 	// TypeEnv holds type information for values inferred by the compiler.
 	TypeEnv *TypeEnv
 
-	moduleLoader ModuleLoader
-	ruleIndices  *util.HashMap
-	stages       []func()
-	maxErrs      int
+	builtins             map[string]*Builtin
+	schemas              *SchemaSet
+	strict               bool
+	strictImports        map[*Module]*moduleImports
+	moduleLoader         ModuleLoader
+	ruleIndices          *util.HashMap
+	comprehensionIndices map[*Term]*ComprehensionIndex
+	stages               []func()
+	maxErrs              int
 }
 
 // QueryContext contains contextual information for running an ad-hoc query.
@@ -168,6 +173,11 @@ type QueryCompiler interface {
 	// parsed query. For example, given the query "input := 1" the rewritten
 	// query would be "__local0__ = 1". The mapping would then be {__local0__: input}.
 	RewrittenVars() map[Var]Var
+
+	// WithBuiltins adds a set of custom built-in functions that are visible to
+	// queries compiled by this QueryCompiler. Unlike Compiler.WithBuiltins, the
+	// underlying compiler is not modified.
+	WithBuiltins(builtins map[string]*Builtin) QueryCompiler
 }
 
 // QueryCompilerStage defines the interface for stages in the query compiler.
@@ -185,7 +195,9 @@ func NewCompiler() *Compiler {
 		}, func(x util.T) int {
 			return x.(Ref).Hash()
 		}),
-		maxErrs: CompileErrorLimitDefault,
+		comprehensionIndices: map[*Term]*ComprehensionIndex{},
+		strictImports:        map[*Module]*moduleImports{},
+		maxErrs:              CompileErrorLimitDefault,
 	}
 
 	c.ModuleTree = NewModuleTree(nil)
@@ -201,8 +213,10 @@ func NewCompiler() *Compiler {
 		// need to be re-run after resolution.
 		c.resolveAllRefs,
 
+		c.checkStrictRules,
 		c.rewriteLocalAssignments,
 		c.rewriteExprTerms,
+		c.rewriteRegoMetadataCalls,
 		c.setModuleTree,
 		c.setRuleTree,
 		c.setGraph,
@@ -216,6 +230,7 @@ func NewCompiler() *Compiler {
 		c.checkRecursion,
 		c.checkTypes,
 		c.buildRuleIndices,
+		c.buildComprehensionIndices,
 	}
 
 	return c
@@ -254,7 +269,7 @@ func (c *Compiler) Failed() bool {
 // ref refers to built-in function, the built-in declaration is consulted,
 // otherwise, the ref is used to perform a ruleset lookup.
 func (c *Compiler) GetArity(ref Ref) int {
-	if bi := BuiltinMap[ref.String()]; bi != nil {
+	if bi := c.builtin(ref.String()); bi != nil {
 		return len(bi.Decl.Args())
 	}
 	rules := c.GetRulesExact(ref)
@@ -417,6 +432,12 @@ func (c *Compiler) RuleIndex(path Ref) RuleIndex {
 	return r.(RuleIndex)
 }
 
+// ComprehensionIndex returns the index built for the comprehension term or nil
+// if the comprehension cannot be indexed.
+func (c *Compiler) ComprehensionIndex(term *Term) *ComprehensionIndex {
+	return c.comprehensionIndices[term]
+}
+
 // ModuleLoader defines the interface that callers can implement to enable lazy
 // loading of modules during compilation.
 type ModuleLoader func(resolved map[string]*Module) (parsed map[string]*Module, err error)
@@ -434,6 +455,51 @@ func (c *Compiler) WithModuleLoader(f ModuleLoader) *Compiler {
 	return c
 }
 
+// WithBuiltins adds a set of custom built-in functions to the compiler. The
+// custom built-in functions are only visible to this compiler and may be
+// used in addition to the language built-ins. The builtins map is keyed by
+// the built-in function name.
+func (c *Compiler) WithBuiltins(builtins map[string]*Builtin) *Compiler {
+	if len(builtins) == 0 {
+		return c
+	}
+	if c.builtins == nil {
+		c.builtins = map[string]*Builtin{}
+	}
+	for name, bi := range builtins {
+		c.builtins[name] = bi
+		c.TypeEnv.tree.Put(bi.Ref(), bi.Decl)
+	}
+	return c
+}
+
+// WithSchemas sets the JSON Schemas that describe the input document and
+// subtrees of the data document. References to documents that have a schema
+// are type checked against the schema, e.g., references to undeclared
+// properties are reported as errors.
+func (c *Compiler) WithSchemas(schemas *SchemaSet) *Compiler {
+	c.schemas = schemas
+	return c
+}
+
+// WithStrict enables strict mode in the compiler. In strict mode, the compiler
+// reports unused imports, unused function arguments, unused local variables,
+// local variables shadowing imports or root documents, rules shadowing root
+// documents, and calls to deprecated built-in functions as errors.
+func (c *Compiler) WithStrict(strict bool) *Compiler {
+	c.strict = strict
+	return c
+}
+
+// builtin returns the language or custom built-in function with the given
+// name or nil if no such built-in function exists.
+func (c *Compiler) builtin(name string) *Builtin {
+	if bi := BuiltinMap[name]; bi != nil {
+		return bi
+	}
+	return c.builtins[name]
+}
+
 // buildRuleIndices constructs indices for rules.
 func (c *Compiler) buildRuleIndices() {
 
@@ -452,6 +518,151 @@ func (c *Compiler) buildRuleIndices() {
 
 }
 
+// ComprehensionIndex describes how a comprehension can be evaluated once and
+// indexed by the values of the variables it closes over. Keys contains the
+// closure variables. Body contains the comprehension body rewritten so that
+// the keys are output variables, i.e., the body can be evaluated without
+// bindings from the enclosing query.
+type ComprehensionIndex struct {
+	Term *Term
+	Keys []*Term
+	Body Body
+}
+
+// buildComprehensionIndices finds comprehensions in rule bodies that close over
+// variables only in equality expressions, e.g., x = data.a[_]; [y | data.b[y].ref
+// = x]. Without an index, the comprehension is evaluated for each binding of
+// the closure variables.
+func (c *Compiler) buildComprehensionIndices() {
+	for _, m := range c.Modules {
+		WalkRules(m, func(r *Rule) bool {
+			candidates := r.Head.Args.Vars()
+			for _, expr := range r.Body {
+				if index := c.getComprehensionIndex(candidates, expr); index != nil {
+					c.comprehensionIndices[index.Term] = index
+				}
+				candidates.Update(expr.Vars(safetyCheckVarVisitorParams))
+			}
+			return false
+		})
+	}
+}
+
+func (c *Compiler) getComprehensionIndex(candidates VarSet, expr *Expr) *ComprehensionIndex {
+
+	if !expr.IsEquality() || expr.Negated || len(expr.With) > 0 {
+		return nil
+	}
+
+	var term *Term
+
+	if _, ok := expr.Operand(0).Value.(Var); ok && IsComprehension(expr.Operand(1).Value) {
+		term = expr.Operand(1)
+	} else if _, ok := expr.Operand(1).Value.(Var); ok && IsComprehension(expr.Operand(0).Value) {
+		term = expr.Operand(0)
+	} else {
+		return nil
+	}
+
+	var head []*Term
+	var body Body
+
+	switch x := term.Value.(type) {
+	case *ArrayComprehension:
+		head, body = []*Term{x.Term}, x.Body
+	case *SetComprehension:
+		head, body = []*Term{x.Term}, x.Body
+	case *ObjectComprehension:
+		head, body = []*Term{x.Key, x.Value}, x.Body
+	}
+
+	vis := NewVarVisitor()
+	Walk(vis, term)
+	keys := vis.Vars().Intersect(candidates).Diff(ReservedVars)
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	rewritten := make(Body, len(body))
+
+	for i := range body {
+		if rewritten[i] = rewriteComprehensionIndexExpr(keys, body[i]); rewritten[i] == nil {
+			return nil
+		}
+	}
+
+	reordered, unsafe := reorderBodyForSafety(c.GetArity, ReservedVars, rewritten)
+	if len(unsafe) > 0 {
+		return nil
+	}
+
+	outputs := outputVarsForBody(reordered, c.GetArity, ReservedVars)
+
+	if len(keys.Diff(outputs)) > 0 {
+		return nil
+	}
+
+	for _, t := range head {
+		if len(t.Vars().Diff(ReservedVars).Diff(outputs)) > 0 {
+			return nil
+		}
+	}
+
+	index := &ComprehensionIndex{Term: term, Body: reordered}
+
+	for _, v := range keys.Sorted() {
+		index.Keys = append(index.Keys, NewTerm(v))
+	}
+
+	return index
+}
+
+// rewriteComprehensionIndexExpr returns expr rewritten so that the keys are
+// bound by unification. If the keys appear anywhere other than as an operand
+// of an equality expression, nil is returned.
+func rewriteComprehensionIndexExpr(keys VarSet, expr *Expr) *Expr {
+
+	vis := NewVarVisitor()
+	Walk(vis, expr)
+
+	if len(vis.Vars().Intersect(keys)) == 0 {
+		return expr
+	}
+
+	if expr.Negated || len(expr.With) > 0 {
+		return nil
+	}
+
+	if !expr.IsEquality() && expr.Operator().Compare(Equal.Ref()) != 0 {
+		return nil
+	}
+
+	if len(expr.Operands()) != 2 {
+		return nil
+	}
+
+	a, b := expr.Operand(0), expr.Operand(1)
+
+	if !isComprehensionIndexKey(keys, a) {
+		a, b = b, a
+	}
+
+	if !isComprehensionIndexKey(keys, a) || len(b.Vars().Intersect(keys)) > 0 {
+		return nil
+	}
+
+	cpy := Equality.Expr(a, b)
+	cpy.Location = expr.Location
+	cpy.Index = expr.Index
+	return cpy
+}
+
+func isComprehensionIndexKey(keys VarSet, term *Term) bool {
+	v, ok := term.Value.(Var)
+	return ok && keys.Contains(v)
+}
+
 // checkRecursion ensures that there are no recursive definitions, i.e., there are
 // no cycles in the Graph.
 func (c *Compiler) checkRecursion() {
@@ -588,6 +799,18 @@ func (c *Compiler) checkSafetyRuleHeads() {
 // checkTypes runs the type checker on all rules. The type checker builds a
 // TypeEnv that is stored on the compiler.
 func (c *Compiler) checkTypes() {
+	for _, path := range c.schemas.Paths() {
+		if !path.HasPrefix(InputRootRef) && !path.HasPrefix(DefaultRootRef) {
+			c.err(NewError(TypeErr, nil, "invalid schema path %v: must refer to %v or %v", path, InputRootDocument, DefaultRootDocument))
+			continue
+		}
+		tpe, err := SchemaToType(c.schemas.Get(path))
+		if err != nil {
+			c.err(NewError(TypeErr, nil, "invalid schema for %v: %v", path, err))
+			continue
+		}
+		c.TypeEnv.tree.Put(path, tpe)
+	}
 	// Recursion is caught in earlier step, so this cannot fail.
 	sorted, _ := c.Graph.Sort()
 	checker := newTypeChecker()
@@ -598,11 +821,183 @@ func (c *Compiler) checkTypes() {
 	c.TypeEnv = env
 }
 
-// checkWithModifiers ensures that with modifier values do not contain
-// references or closures.
+// moduleImports records the imports of a module along with the variables
+// that rules in the module refer to and assign. References to imports are
+// replaced during resolution so the imports are checked against this record.
+type moduleImports struct {
+	imports  []*Import
+	used     VarSet
+	assigned []*Term
+}
+
+// newModuleImports returns the import record for mod. It must be called before
+// the references in mod are resolved.
+func newModuleImports(mod *Module) *moduleImports {
+
+	result := &moduleImports{
+		imports: mod.Imports,
+		used:    NewVarSet(),
+	}
+
+	for _, rule := range mod.Rules {
+		WalkVars(rule, func(v Var) bool {
+			result.used.Add(v)
+			return false
+		})
+		WalkExprs(rule, func(expr *Expr) bool {
+			if !expr.IsAssignment() {
+				return false
+			}
+			WalkTerms(expr.Operand(0), func(t *Term) bool {
+				if _, ok := t.Value.(Var); ok {
+					result.assigned = append(result.assigned, t)
+				}
+				return false
+			})
+			return false
+		})
+	}
+
+	return result
+}
+
+// checkImports reports imports that are not referred to by any rule in the
+// module as well as local variables that shadow imports.
+func (c *Compiler) checkImports(mi *moduleImports) {
+
+	names := map[Var]*Import{}
+	for _, imp := range mi.imports {
+		names[importName(imp)] = imp
+	}
+
+	for _, t := range mi.assigned {
+		if imp := names[t.Value.(Var)]; imp != nil {
+			c.err(NewError(CompileErr, t.Location, "variables must not shadow import %v (use a different variable name)", imp.Path))
+		}
+	}
+
+	for _, imp := range mi.imports {
+		if !mi.used.Contains(importName(imp)) {
+			c.err(NewError(CompileErr, imp.Location, "import %v unused", imp.Path))
+		}
+	}
+}
+
+// checkStrictRules reports unused and shadowed imports, rules that shadow root
+// documents, unused function arguments, unused local variables, assignments to
+// root documents, and calls to deprecated built-in functions.
+func (c *Compiler) checkStrictRules() {
+
+	if !c.strict {
+		return
+	}
+
+	for _, mod := range c.Modules {
+
+		if mi, ok := c.strictImports[mod]; ok {
+			c.checkImports(mi)
+		}
+
+		for _, rule := range mod.Rules {
+
+			if RootDocumentNames.Contains(VarTerm(string(rule.Head.Name))) {
+				c.err(NewError(CompileErr, rule.Location, "rules must not shadow %v (use a different rule name)", rule.Head.Name))
+			}
+
+			counts := ruleVarCounts(rule)
+
+			WalkTerms(rule.Head.Args, func(t *Term) bool {
+				if v, ok := t.Value.(Var); ok && !v.IsWildcard() && counts[v] == 1 {
+					c.err(NewError(CompileErr, t.Location, "unused argument %v", v))
+				}
+				return false
+			})
+
+			WalkExprs(rule, func(expr *Expr) bool {
+				if expr.IsAssignment() {
+					c.checkStrictAssignment(expr.Operand(0), counts)
+				}
+				c.checkDeprecatedCall(expr)
+				return false
+			})
+		}
+	}
+}
+
+func (c *Compiler) checkStrictAssignment(lhs *Term, counts map[Var]int) {
+	WalkTerms(lhs, func(t *Term) bool {
+		switch v := t.Value.(type) {
+		case Ref:
+			if RootDocumentRefs.Contains(t) {
+				c.err(NewError(CompileErr, t.Location, "variables must not shadow %v (use a different variable name)", v))
+			}
+		case Var:
+			if !v.IsWildcard() && counts[v] == 1 {
+				c.err(NewError(CompileErr, t.Location, "assigned var %v unused", v))
+			}
+		}
+		return false
+	})
+}
+
+func (c *Compiler) checkDeprecatedCall(expr *Expr) {
+	check := func(operator *Term) {
+		if bi := c.builtin(operator.String()); bi != nil && bi.Deprecated {
+			c.err(NewError(CompileErr, operator.Location, "deprecated built-in function %v", bi.Name))
+		}
+	}
+	if expr.IsCall() {
+		check(expr.Terms.([]*Term)[0])
+	}
+	WalkTerms(expr, func(t *Term) bool {
+		if call, ok := t.Value.(Call); ok {
+			check(call[0])
+		}
+		return false
+	})
+}
+
+// ruleVarCounts returns the number of occurrences of each variable in the
+// rule and its else branches. The arguments of else branches are not counted
+// because they are the same as the arguments of the rule.
+func ruleVarCounts(rule *Rule) map[Var]int {
+	counts := map[Var]int{}
+	count := func(x interface{}) {
+		WalkVars(x, func(v Var) bool {
+			counts[v]++
+			return false
+		})
+	}
+	count(rule.Head.Args)
+	for r := rule; r != nil; r = r.Else {
+		if r.Head.Key != nil {
+			count(r.Head.Key)
+		}
+		if r.Head.Value != nil {
+			count(r.Head.Value)
+		}
+		count(r.Body)
+	}
+	return counts
+}
+
+func importName(imp *Import) Var {
+	if len(imp.Alias) > 0 {
+		return imp.Alias
+	}
+	path := imp.Path.Value.(Ref)
+	if len(path) == 1 {
+		return path[0].Value.(Var)
+	}
+	return Var(path[len(path)-1].Value.(String))
+}
+
+// checkWithModifiers ensures that with modifier targets refer to input or
+// functions and that with modifier values do not contain references or
+// closures. Functions may be replaced by other functions.
 func (c *Compiler) checkWithModifiers() {
 	for _, m := range c.Modules {
-		wc := newWithModifierChecker()
+		wc := newWithModifierChecker(c)
 		for _, err := range wc.Check(m) {
 			c.err(err)
 		}
@@ -679,6 +1074,13 @@ func (c *Compiler) resolveAllRefs() {
 
 		globals := getGlobals(mod.Package, ruleExports, mod.Imports)
 
+		// Imports are recorded before they are resolved because references to
+		// imports are replaced by the imported paths. The record is checked
+		// along with the other strict rules.
+		if _, ok := c.strictImports[mod]; c.strict && !ok {
+			c.strictImports[mod] = newModuleImports(mod)
+		}
+
 		WalkRules(mod, func(rule *Rule) bool {
 			err := resolveRefsInRule(globals, rule)
 			if err != nil {
@@ -730,6 +1132,42 @@ func (c *Compiler) rewriteExprTerms() {
 	}
 }
 
+// rewriteRegoMetadataCalls replaces calls to rego.metadata.rule() with the
+// annotations of the rule containing the call. Else branches share the
+// annotations of the rule they belong to. For example, given the following
+// rule:
+//
+// # METADATA
+// # title: example
+// p = x { x = rego.metadata.rule() }
+//
+// The rule would be re-written as:
+//
+// p = x { __local0__ = {"scope": "rule", "title": "example"}; x = __local0__ }
+func (c *Compiler) rewriteRegoMetadataCalls() {
+	ref := RegoMetadataRule.Ref()
+	for _, mod := range c.Modules {
+		for _, rule := range mod.Rules {
+			value := NewTerm(rule.Annotations.Value())
+			for r := rule; r != nil; r = r.Else {
+				WalkExprs(r.Body, func(expr *Expr) bool {
+					if !expr.IsCall() || !expr.Operator().Equal(ref) {
+						return false
+					}
+					terms := expr.Terms.([]*Term)
+					switch len(terms) {
+					case 1:
+						expr.Terms = value.Copy().SetLocation(terms[0].Location)
+					case 2:
+						expr.Terms = Equality.Expr(terms[1], value.Copy().SetLocation(terms[0].Location)).Terms
+					}
+					return false
+				})
+			}
+		}
+	}
+}
+
 // rewriteTermsInHead will rewrite rules so that the head does not contain any
 // terms that require evaluation (e.g., refs or comprehensions). If the key or
 // value contains or more of these terms, the key or value will be moved into
@@ -875,6 +1313,7 @@ type queryCompiler struct {
 	typeEnv   *TypeEnv
 	rewritten map[Var]Var
 	after     map[string][]QueryCompilerStage
+	builtins  map[string]*Builtin
 }
 
 func newQueryCompiler(compiler *Compiler) QueryCompiler {
@@ -900,6 +1339,20 @@ func (qc *queryCompiler) RewrittenVars() map[Var]Var {
 	return qc.rewritten
 }
 
+func (qc *queryCompiler) WithBuiltins(builtins map[string]*Builtin) QueryCompiler {
+	qc.builtins = builtins
+	return qc
+}
+
+// getArity returns the number of args of the function referred to by ref
+// taking the custom built-in functions of the query compiler into account.
+func (qc *queryCompiler) getArity(ref Ref) int {
+	if bi := qc.builtins[ref.String()]; bi != nil {
+		return len(bi.Decl.Args())
+	}
+	return qc.compiler.GetArity(ref)
+}
+
 func (qc *queryCompiler) Compile(query Body) (Body, error) {
 
 	query = query.Copy()
@@ -1005,7 +1458,7 @@ func (qc *queryCompiler) rewriteLocalAssignments(_ *QueryContext, body Body) (Bo
 
 func (qc *queryCompiler) checkSafety(_ *QueryContext, body Body) (Body, error) {
 	safe := ReservedVars.Copy()
-	reordered, unsafe := reorderBodyForSafety(qc.compiler.GetArity, safe, body)
+	reordered, unsafe := reorderBodyForSafety(qc.getArity, safe, body)
 	if errs := safetyErrorSlice(body.Loc(), unsafe); len(errs) > 0 {
 		return nil, errs
 	}
@@ -1015,7 +1468,14 @@ func (qc *queryCompiler) checkSafety(_ *QueryContext, body Body) (Body, error) {
 func (qc *queryCompiler) checkTypes(qctx *QueryContext, body Body) (Body, error) {
 	var errs Errors
 	checker := newTypeChecker()
-	qc.typeEnv, errs = checker.CheckBody(qc.compiler.TypeEnv, body)
+	env := qc.compiler.TypeEnv
+	if len(qc.builtins) > 0 {
+		env = env.wrap()
+		for _, bi := range qc.builtins {
+			env.tree.Put(bi.Ref(), bi.Decl)
+		}
+	}
+	qc.typeEnv, errs = checker.CheckBody(env, body)
 	if len(errs) > 0 {
 		return nil, errs
 	}
@@ -1023,7 +1483,8 @@ func (qc *queryCompiler) checkTypes(qctx *QueryContext, body Body) (Body, error)
 }
 
 func (qc *queryCompiler) checkWithModifiers(qctx *QueryContext, body Body) (Body, error) {
-	wc := newWithModifierChecker()
+	wc := newWithModifierChecker(qc.compiler)
+	wc.builtins = qc.builtins
 	if errs := wc.Check(body); len(errs) != 0 {
 		return nil, errs
 	}
@@ -1163,13 +1624,17 @@ func (n *TreeNode) DepthFirst(f func(node *TreeNode) bool) {
 }
 
 type withModifierChecker struct {
-	errors Errors
-	expr   *Expr
-	prefix string
+	compiler *Compiler
+	builtins map[string]*Builtin
+	errors   Errors
+	expr     *Expr
+	prefix   string
 }
 
-func newWithModifierChecker() *withModifierChecker {
-	return &withModifierChecker{}
+func newWithModifierChecker(compiler *Compiler) *withModifierChecker {
+	return &withModifierChecker{
+		compiler: compiler,
+	}
 }
 
 func (wc *withModifierChecker) Check(x interface{}) Errors {
@@ -1184,32 +1649,59 @@ func (wc *withModifierChecker) Visit(x interface{}) Visitor {
 	case *Expr:
 		wc.expr = x
 	case *With:
-		wc.checkTarget(x)
-		wc.checkValue(x)
+		wc.rewriteBuiltinVars(x)
+		if wc.checkTarget(x) {
+			wc.checkFunctionValue(x)
+		} else {
+			wc.checkValue(x)
+		}
 		return nil
 	}
 	return wc
 }
 
-func (wc *withModifierChecker) checkTarget(w *With) {
+// rewriteBuiltinVars rewrites with modifier targets (and values replacing
+// functions) that refer to built-in functions by name, e.g., "count", into
+// refs so that they are handled like other function refs.
+func (wc *withModifierChecker) rewriteBuiltinVars(w *With) {
+	if v, ok := w.Target.Value.(Var); ok && wc.builtin(string(v)) != nil {
+		w.Target = NewTerm(Ref{w.Target}).SetLocation(w.Target.Location)
+	}
+	if ref, ok := w.Target.Value.(Ref); !ok || wc.functionArity(ref) < 0 {
+		return
+	}
+	if v, ok := w.Value.Value.(Var); ok && wc.builtin(string(v)) != nil {
+		w.Value = NewTerm(Ref{w.Value}).SetLocation(w.Value.Location)
+	}
+}
+
+// checkTarget returns true if the target of w is a function.
+func (wc *withModifierChecker) checkTarget(w *With) bool {
 
 	if ref, ok := w.Target.Value.(Ref); ok {
-		if !ref.HasPrefix(InputRootRef) {
-			wc.err(TypeErr, w.Location, "with keyword target must be %v", InputRootDocument)
+		if ref.HasPrefix(InputRootRef) {
+			return false
+		}
+		if wc.functionArity(ref) >= 0 {
+			return true
 		}
+		wc.err(TypeErr, w.Location, "with keyword target must be %v or a function", InputRootDocument)
 	}
 
 	// TODO(tsandall): could validate that target is in fact referred to by
 	// evaluation of the expression.
+	return false
 }
 
 func (wc *withModifierChecker) checkValue(w *With) {
+	n := len(wc.errors)
+
 	WalkClosures(w.Value, func(c interface{}) bool {
 		wc.err(TypeErr, w.Location, "with keyword value must not contain closures")
 		return true
 	})
 
-	if len(wc.errors) > 0 {
+	if len(wc.errors) > n {
 		return
 	}
 
@@ -1219,6 +1711,59 @@ func (wc *withModifierChecker) checkValue(w *With) {
 	})
 }
 
+// checkFunctionValue checks the value replacing a function. The value may be a
+// function with the same arity or a value that the function calls evaluate to.
+func (wc *withModifierChecker) checkFunctionValue(w *With) {
+
+	ref, ok := w.Value.Value.(Ref)
+	if !ok {
+		wc.checkValue(w)
+		return
+	}
+
+	arity := wc.functionArity(ref)
+	if arity < 0 {
+		wc.checkValue(w)
+		return
+	}
+
+	if exp := wc.functionArity(w.Target.Value.(Ref)); arity != exp {
+		wc.err(TypeErr, w.Location, "with keyword value must be a function with %d argument(s) but %v has %d", exp, ref, arity)
+	}
+}
+
+// functionArity returns the number of arguments of the built-in or user
+// function referred to by ref or -1 if ref does not refer to a function.
+// Equality and assignment cannot be replaced because they are not evaluated
+// as function calls.
+func (wc *withModifierChecker) functionArity(ref Ref) int {
+
+	if bi := wc.builtin(ref.String()); bi != nil {
+		if bi.Name == Equality.Name || bi.Name == Assign.Name {
+			return -1
+		}
+		return len(bi.Decl.Args())
+	}
+
+	if wc.compiler != nil && ref.HasPrefix(DefaultRootRef) {
+		if rules := wc.compiler.GetRules(ref); len(rules) > 0 && len(rules[0].Head.Args) > 0 {
+			return len(rules[0].Head.Args)
+		}
+	}
+
+	return -1
+}
+
+func (wc *withModifierChecker) builtin(name string) *Builtin {
+	if bi := wc.builtins[name]; bi != nil {
+		return bi
+	}
+	if wc.compiler != nil {
+		return wc.compiler.builtin(name)
+	}
+	return BuiltinMap[name]
+}
+
 func (wc *withModifierChecker) err(code string, loc *Location, f string, a ...interface{}) {
 	if wc.prefix != "" {
 		f = wc.prefix + ": " + f
@@ -1638,15 +2183,9 @@ func outputVarsForExpr(expr *Expr, arity func(Ref) int, safe VarSet) VarSet {
 
 	// With modifier inputs must be safe.
 	for _, with := range expr.With {
-		unsafe := false
-		WalkVars(with, func(v Var) bool {
-			if !safe.Contains(v) {
-				unsafe = true
-				return true
-			}
-			return false
-		})
-		if unsafe {
+		vis := NewVarVisitor().WithParams(safetyCheckVarVisitorParams)
+		Walk(vis, with)
+		if len(vis.Vars().Diff(safe)) > 0 {
 			return VarSet{}
 		}
 	}
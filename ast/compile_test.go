@@ -11,6 +11,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/open-policy-agent/opa/types"
 	"github.com/open-policy-agent/opa/util"
 	"github.com/open-policy-agent/opa/util/test"
 )
@@ -594,14 +595,24 @@ import data.a.b.d.t as req_dep
 p = true { true }
 ref_in_value = true { req_dep with input as p }
 closure_in_value = true { req_dep with input as [null | null] }
-data_target = true { req_dep with data.p as "foo" }`,
+data_target = true { req_dep with data.p as "foo" }
+f(x) = x { true }
+builtin_target = true { req_dep with time.now_ns as 1 }
+builtin_value = true { req_dep with f as count }
+function_target = true { req_dep with f as "foo" with count as f }
+arity_mismatch = true { req_dep with count as concat }
+eq_target = true { req_dep with eq as true }
+ref_in_function_value = true { req_dep with f as p }`,
 	)
 
 	compileStages(c, c.checkWithModifiers)
 
 	expected := []string{
+		"rego_type_error: arity_mismatch: with keyword value must be a function with 1 argument(s) but concat has 2",
 		"rego_type_error: closure_in_value: with keyword value must not contain closures",
-		"rego_type_error: data_target: with keyword target must be input",
+		"rego_type_error: data_target: with keyword target must be input or a function",
+		"rego_type_error: eq_target: with keyword target must be input or a function",
+		"rego_type_error: ref_in_function_value: with keyword value must not contain refs",
 		"rego_type_error: ref_in_value: with keyword value must not contain refs",
 	}
 
@@ -1909,6 +1920,229 @@ func TestCompilerLazyLoadingError(t *testing.T) {
 	}
 }
 
+func TestCompilerWithBuiltins(t *testing.T) {
+
+	mod := MustParseModule(`package test
+
+	p = x { x = tenant.greet("bob") }
+	q { tenant.greet(1) }`)
+
+	builtins := map[string]*Builtin{
+		"tenant.greet": {
+			Name: "tenant.greet",
+			Decl: types.NewFunction(types.Args(types.S), types.S),
+		},
+	}
+
+	compiler := NewCompiler().WithBuiltins(builtins)
+	compiler.Compile(map[string]*Module{"test": mod})
+
+	if len(compiler.Errors) != 1 || !strings.Contains(compiler.Errors[0].Error(), "tenant.greet") {
+		t.Fatalf("Expected single type error for q but got: %v", compiler.Errors)
+	}
+
+	if arity := compiler.GetArity(MustParseRef("tenant.greet")); arity != 1 {
+		t.Fatalf("Expected arity 1 but got: %v", arity)
+	}
+
+	other := NewCompiler()
+	other.Compile(map[string]*Module{"test": MustParseModule(`package test
+
+	p = x { x = tenant.greet("bob") }`)})
+
+	if !other.Failed() {
+		t.Fatal("Expected custom built-in to be undefined on other compiler")
+	}
+}
+
+func TestCompilerWithSchemas(t *testing.T) {
+
+	schemas := NewSchemaSet()
+	schemas.Put(InputRootRef, util.MustUnmarshalJSON([]byte(`{
+		"properties": {
+			"request": {
+				"properties": {
+					"method": {"type": "string"},
+					"headers": {"type": "object", "additionalProperties": {"type": "string"}}
+				}
+			}
+		}
+	}`)))
+	schemas.Put(MustParseRef("data.servers"), util.MustUnmarshalJSON([]byte(`{
+		"type": "array",
+		"items": {"properties": {"id": {"type": "string"}}}
+	}`)))
+
+	mod := MustParseModule(`package test
+
+	ok { input.request.method = "GET"; input.request.headers[k] = "x"; data.servers[_].id = "s1" }
+	typo { input.reqest.method = "GET" }
+	mismatch { input.request.method = 1 }
+	data_typo { data.servers[_].idx }`)
+
+	compiler := NewCompiler().WithSchemas(schemas)
+	compiler.Compile(map[string]*Module{"test": mod})
+
+	expected := []string{
+		"4:9: rego_type_error: undefined ref: input.reqest.method",
+		"5:13: rego_type_error: match error",
+		"6:14: rego_type_error: undefined ref: data.servers[_].idx",
+	}
+
+	if len(compiler.Errors) != len(expected) {
+		t.Fatalf("Expected %d errors but got: %v", len(expected), compiler.Errors)
+	}
+
+	sort.Slice(compiler.Errors, func(i, j int) bool {
+		return compiler.Errors[i].Location.Row < compiler.Errors[j].Location.Row
+	})
+
+	for i := range expected {
+		if !strings.HasPrefix(compiler.Errors[i].Error(), expected[i]) {
+			t.Errorf("Expected error %q but got: %v", expected[i], compiler.Errors[i])
+		}
+	}
+
+	schemas = NewSchemaSet()
+	schemas.Put(MustParseRef("foo.bar"), map[string]interface{}{})
+	schemas.Put(InputRootRef, map[string]interface{}{"type": "float"})
+
+	compiler = NewCompiler().WithSchemas(schemas)
+	compiler.Compile(map[string]*Module{"test": MustParseModule(`package test`)})
+
+	if len(compiler.Errors) != 2 ||
+		compiler.Errors[0].Message != `invalid schema path foo.bar: must refer to input or data` ||
+		compiler.Errors[1].Message != `invalid schema for input: unknown type "float"` {
+		t.Fatalf("Unexpected errors: %v", compiler.Errors)
+	}
+}
+
+func TestCompilerStrict(t *testing.T) {
+
+	mod := MustParseModule(`package test
+
+data { true }
+
+f(a, b) = a { true }
+g(a, b) = a { false } else = b { true }
+
+p { xx := 1; set_diff({1}, {2}) }
+q { input := {"a": 1}; input.a = 1 }
+r { x := 1; x > 0 }`)
+
+	compiler := NewCompiler().WithStrict(false)
+	compiler.Compile(map[string]*Module{"test": mod.Copy()})
+
+	if compiler.Failed() {
+		t.Fatalf("Expected no errors in non-strict mode but got: %v", compiler.Errors)
+	}
+
+	compiler = NewCompiler().WithStrict(true)
+	compiler.Compile(map[string]*Module{"test": mod})
+
+	expected := []string{
+		"3:1: rego_compile_error: rules must not shadow data (use a different rule name)",
+		"5:6: rego_compile_error: unused argument b",
+		"8:5: rego_compile_error: assigned var xx unused",
+		"8:14: rego_compile_error: deprecated built-in function set_diff",
+		"9:5: rego_compile_error: variables must not shadow input (use a different variable name)",
+	}
+
+	assertStrictErrors(t, compiler.Errors, expected)
+
+	mod = MustParseModule(`package test
+
+import data.foo
+import data.bar
+import input.baz
+
+p { foo.x; baz := 1; baz > 0 }
+q { x := 1 }`)
+
+	compiler = NewCompiler().WithStrict(true)
+	compiler.Compile(map[string]*Module{"test": mod})
+
+	expected = []string{
+		"4:1: rego_compile_error: import data.bar unused",
+		"7:12: rego_compile_error: variables must not shadow import input.baz (use a different variable name)",
+		"8:5: rego_compile_error: assigned var x unused",
+	}
+
+	assertStrictErrors(t, compiler.Errors, expected)
+}
+
+func assertStrictErrors(t *testing.T, errs Errors, expected []string) {
+	t.Helper()
+
+	sort.Slice(errs, func(i, j int) bool {
+		if errs[i].Location.Row != errs[j].Location.Row {
+			return errs[i].Location.Row < errs[j].Location.Row
+		}
+		return errs[i].Location.Col < errs[j].Location.Col
+	})
+
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors but got: %v", len(expected), errs)
+	}
+
+	for i := range expected {
+		if errs[i].Error() != expected[i] {
+			t.Errorf("Expected error %q but got: %v", expected[i], errs[i])
+		}
+	}
+}
+
+func TestCompilerComprehensionIndex(t *testing.T) {
+
+	compiler := NewCompiler()
+	compiler.Compile(map[string]*Module{"test": MustParseModule(`package test
+
+	single[x] { data.a[x]; count([y | data.b[y].ref == x]) > 0 }
+	multiple { x = data.a[_]; z = data.c[_]; ys := {y | data.b[y].ref = x; data.b[y].z == z} }
+	object { x = data.a[_]; ys := {k: y | data.b[y].ref = x; k = data.b[y].k} }
+	function(x) = ys { ys := [y | data.b[y].ref == x] }
+	in_ref { x = data.a[_]; ys := [y | y = data.b[x]] }
+	negated { x = data.a[_]; ys := [y | data.b[y]; not data.b[y].ref = x] }
+	in_call { x = data.a[_]; ys := [y | data.b[y]; startswith(y, x)] }
+	no_closure { ys := [y | data.b[y]] }`)})
+
+	if compiler.Failed() {
+		t.Fatalf("Unexpected errors: %v", compiler.Errors)
+	}
+
+	expected := map[Var]string{
+		"single":     "[x]",
+		"multiple":   "[x, z]",
+		"object":     "[x]",
+		"function":   "[x]",
+		"in_ref":     "",
+		"negated":    "",
+		"in_call":    "",
+		"no_closure": "",
+	}
+
+	for _, rule := range compiler.Modules["test"].Rules {
+		var index *ComprehensionIndex
+		for _, expr := range rule.Body {
+			if expr.IsEquality() && IsComprehension(expr.Operand(1).Value) {
+				index = compiler.ComprehensionIndex(expr.Operand(1))
+			}
+		}
+		exp := expected[rule.Head.Name]
+		if exp == "" {
+			if index != nil {
+				t.Errorf("%v: expected no index but got keys %v", rule.Head.Name, index.Keys)
+			}
+			continue
+		}
+		if index == nil {
+			t.Errorf("%v: expected index with keys %v", rule.Head.Name, exp)
+		} else if Array(index.Keys).String() != exp {
+			t.Errorf("%v: expected keys %v but got %v", rule.Head.Name, exp, index.Keys)
+		}
+	}
+}
+
 func TestCompilerLazyLoading(t *testing.T) {
 
 	mod1 := MustParseModule(`package a.b.c
@@ -2023,7 +2257,7 @@ func TestQueryCompiler(t *testing.T) {
 		{"unsafe vars", "z", "", nil, "", fmt.Errorf("1 error occurred: 1:1: rego_unsafe_var_error: var z is unsafe")},
 		{"safe vars", `data; abc`, `package ex`, []string{"import input.xyz as abc"}, `{}`, `data; input.xyz`},
 		{"reorder", `x != 1; x = 0`, "", nil, "", `x = 0; x != 1`},
-		{"bad with target", "x = 1 with data.p as null", "", nil, "", fmt.Errorf("1 error occurred: 1:7: rego_type_error: with keyword target must be input")},
+		{"bad with target", "x = 1 with data.p as null", "", nil, "", fmt.Errorf("1 error occurred: 1:7: rego_type_error: with keyword target must be input or a function")},
 		{"unsafe exprs", "count(sum())", "", nil, "", fmt.Errorf("1 error occurred: 1:1: rego_unsafe_var_error: expression is unsafe")},
 		{"check types", "x = data.a.b.c.z; y = null; x = y", "", nil, "", fmt.Errorf("match error\n\tleft  : number\n\tright : null")},
 	}
@@ -7,8 +7,11 @@ package ast
 import (
 	"fmt"
 	"io"
+	"math/big"
+	"regexp/syntax"
 	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/open-policy-agent/opa/util"
 )
@@ -25,12 +28,15 @@ type RuleIndex interface {
 	Lookup(resolver ValueResolver) (result *IndexResult, err error)
 }
 
-// IndexResult contains the result of an index lookup.
+// IndexResult contains the result of an index lookup. If EarlyExit is true,
+// all of the rules produce the same constant value so evaluation can stop
+// after the first rule body succeeds.
 type IndexResult struct {
-	Kind    DocKind
-	Rules   []*Rule
-	Else    map[*Rule][]*Rule
-	Default *Rule
+	Kind      DocKind
+	Rules     []*Rule
+	Else      map[*Rule][]*Rule
+	Default   *Rule
+	EarlyExit bool
 }
 
 // NewIndexResult returns a new IndexResult object.
@@ -51,6 +57,7 @@ type baseDocEqIndex struct {
 	root        *trieNode
 	defaultRule *Rule
 	kind        DocKind
+	earlyExit   bool
 }
 
 func newBaseDocEqIndex(isVirtual func(Ref) bool) *baseDocEqIndex {
@@ -67,16 +74,12 @@ func (i *baseDocEqIndex) Build(rules []*Rule) bool {
 	}
 
 	i.kind = rules[0].Head.DocKind()
+	i.earlyExit = canEarlyExit(rules)
 	refs := make(refValueIndex, len(rules))
 
 	// freq is map[ref]int where the values represent the frequency of the
 	// ref/key.
-	freq := util.NewHashMap(func(a, b util.T) bool {
-		r1, r2 := a.(Ref), b.(Ref)
-		return r1.Equal(r2)
-	}, func(x util.T) int {
-		return x.(Ref).Hash()
-	})
+	freq := newRefHashMap()
 
 	// Build refs and freq maps
 	for idx := range rules {
@@ -89,10 +92,11 @@ func (i *baseDocEqIndex) Build(rules []*Rule) bool {
 				return false
 			}
 
+			bindings := newIndexBindings(rule.Body)
+
 			for _, expr := range rule.Body {
-				ref, value, ok := i.getRefAndValue(expr)
-				if ok {
-					refs.Insert(rule, ref, value)
+				ref, value, ok := i.getRefAndValue(bindings, expr)
+				if ok && refs.Insert(rule, ref, value) {
 					count, ok := freq.Get(ref)
 					if !ok {
 						count = 0
@@ -141,7 +145,7 @@ func (i *baseDocEqIndex) Build(rules []*Rule) bool {
 
 			if refs := refs[rule]; refs != nil {
 				for _, pair := range sorted {
-					value := refs.Get(pair.ref)
+					value, _ := refs.Get(pair.ref)
 					node = node.Insert(pair.ref, value)
 				}
 			}
@@ -170,8 +174,13 @@ func (i *baseDocEqIndex) Lookup(resolver ValueResolver) (*IndexResult, error) {
 
 	result := NewIndexResult(i.kind)
 	result.Default = i.defaultRule
+	result.EarlyExit = i.earlyExit
 	result.Rules = make([]*Rule, 0, len(tr.ordering))
 
+	// The trie children are not visited in a fixed order so sort the rules to
+	// return them in the order they were passed to Build.
+	sort.Ints(tr.ordering)
+
 	for _, pos := range tr.ordering {
 		sort.Slice(tr.unordered[pos], func(i, j int) bool {
 			return tr.unordered[pos][i].prio[1] < tr.unordered[pos][j].prio[1]
@@ -190,6 +199,28 @@ func (i *baseDocEqIndex) Lookup(resolver ValueResolver) (*IndexResult, error) {
 	return result, nil
 }
 
+// canEarlyExit returns true if the rules cannot produce conflicting values,
+// i.e., none of the rules have else branches and all of the rules (other than
+// the default rule) define complete documents or functions with the same
+// ground value.
+func canEarlyExit(rules []*Rule) bool {
+	var value *Term
+	for _, rule := range rules {
+		if rule.Default {
+			continue
+		}
+		if rule.Else != nil || rule.Head.Key != nil || rule.Head.Value == nil || !rule.Head.Value.IsGround() {
+			return false
+		}
+		if value == nil {
+			value = rule.Head.Value
+		} else if !value.Equal(rule.Head.Value) {
+			return false
+		}
+	}
+	return value != nil
+}
+
 func indexedOperator(expr *Expr) bool {
 	if expr.IsEquality() {
 		return true
@@ -200,38 +231,51 @@ func indexedOperator(expr *Expr) bool {
 	return false
 }
 
-func (i *baseDocEqIndex) getRefAndValue(expr *Expr) (Ref, Value, bool) {
+func (i *baseDocEqIndex) getRefAndValue(bindings *indexBindings, expr *Expr) (Ref, interface{}, bool) {
 
-	if !indexedOperator(expr) || expr.Negated {
+	if expr.Negated || len(expr.With) > 0 {
 		return nil, nil, false
 	}
 
-	a, b := expr.Operand(0), expr.Operand(1)
-
-	if ref, value, ok := i.getRefAndValueFromTerms(a, b); ok {
-		return ref, value, true
+	if term, ok := expr.Terms.(*Term); ok {
+		return i.getRefAndMembership(bindings, term)
 	}
 
-	return i.getRefAndValueFromTerms(b, a)
-}
-
-func (i *baseDocEqIndex) getRefAndValueFromTerms(a, b *Term) (Ref, Value, bool) {
-
-	ref, ok := a.Value.(Ref)
-	if !ok {
+	if !expr.IsCall() {
 		return nil, nil, false
 	}
 
-	if !RootDocumentNames.Contains(ref[0]) {
-		return nil, nil, false
+	switch {
+	case indexedOperator(expr):
+		a, b := expr.Operand(0), expr.Operand(1)
+		if ref, value, ok := i.getRefAndValueFromTerms(bindings, a, b); ok {
+			return ref, value, true
+		}
+		return i.getRefAndValueFromTerms(bindings, b, a)
+	case expr.Operator().Compare(NotEqual.Ref()) == 0:
+		a, b := expr.Operand(0), expr.Operand(1)
+		if ref, value, ok := i.getRefAndNotEqual(bindings, a, b); ok {
+			return ref, value, true
+		}
+		return i.getRefAndNotEqual(bindings, b, a)
+	case expr.Operator().Compare(GlobMatch.Ref()) == 0:
+		return i.getRefAndGlob(bindings, expr.Operand(0), expr.Operand(1), expr.Operand(2))
+	case expr.Operator().Compare(RegexMatch.Ref()) == 0:
+		return i.getRefAndRegexPrefix(bindings, expr.Operand(0), expr.Operand(1))
 	}
 
-	if i.isVirtual(ref) {
+	return nil, nil, false
+}
+
+func (i *baseDocEqIndex) getRefAndValueFromTerms(bindings *indexBindings, a, b *Term) (Ref, interface{}, bool) {
+
+	ref, ok := i.getIndexedRef(bindings, a)
+	if !ok {
 		return nil, nil, false
 	}
 
-	if ref.IsNested() || !ref.IsGround() {
-		return nil, nil, false
+	if set, ok := bindings.membership(b); ok {
+		return ref, set, true
 	}
 
 	switch b := b.Value.(type) {
@@ -261,15 +305,332 @@ func (i *baseDocEqIndex) getRefAndValueFromTerms(a, b *Term) (Ref, Value, bool)
 	return nil, nil, false
 }
 
-type refValueIndex map[*Rule]*ValueMap
+// getRefAndMembership handles expressions like s[x] where s is bound to a set
+// of scalars and x is bound to the indexed ref.
+func (i *baseDocEqIndex) getRefAndMembership(bindings *indexBindings, term *Term) (Ref, interface{}, bool) {
+
+	r, ok := term.Value.(Ref)
+	if !ok || len(r) != 2 {
+		return nil, nil, false
+	}
+
+	head, ok := r[0].Value.(Var)
+	if !ok {
+		return nil, nil, false
+	}
+
+	set, ok := bindings.collections[head].(Set)
+	if !ok {
+		return nil, nil, false
+	}
+
+	ref, ok := i.getIndexedRef(bindings, r[1])
+	if !ok {
+		return nil, nil, false
+	}
+
+	return ref, newSetIndexValue(set), true
+}
+
+func (i *baseDocEqIndex) getRefAndNotEqual(bindings *indexBindings, a, b *Term) (Ref, interface{}, bool) {
+
+	ref, ok := i.getIndexedRef(bindings, a)
+	if !ok || !IsScalar(b.Value) {
+		return nil, nil, false
+	}
+
+	return ref, notEqualIndexValue{b.Value}, true
+}
+
+// getRefAndGlob handles glob.match calls where the pattern consists of literal
+// segments and single wildcard segments separated by a single delimiter. The
+// pattern is indexed as an array of segments.
+func (i *baseDocEqIndex) getRefAndGlob(bindings *indexBindings, pattern, delimiters, match *Term) (Ref, interface{}, bool) {
+
+	ref, ok := i.getIndexedRef(bindings, match)
+	if !ok {
+		return nil, nil, false
+	}
+
+	p, ok := pattern.Value.(String)
+	if !ok {
+		return nil, nil, false
+	}
+
+	arr, ok := delimiters.Value.(Array)
+	if !ok || len(arr) > 1 {
+		return nil, nil, false
+	}
+
+	delim := "."
+	if len(arr) == 1 {
+		s, ok := arr[0].Value.(String)
+		if !ok || utf8.RuneCountInString(string(s)) != 1 {
+			return nil, nil, false
+		}
+		delim = string(s)
+	}
+
+	parts := strings.Split(string(p), delim)
+	segments := make(Array, len(parts))
+
+	for j := range parts {
+		if parts[j] == "*" {
+			segments[j] = VarTerm(fmt.Sprintf("$%d", j))
+		} else if strings.ContainsAny(parts[j], globSpecialChars) {
+			return nil, nil, false
+		} else {
+			segments[j] = StringTerm(parts[j])
+		}
+	}
+
+	return ref, globIndexValue{delim, segments}, true
+}
+
+// getRefAndRegexPrefix handles re_match calls where the pattern is anchored at
+// the start of the text and begins with a literal string.
+func (i *baseDocEqIndex) getRefAndRegexPrefix(bindings *indexBindings, pattern, match *Term) (Ref, interface{}, bool) {
+
+	ref, ok := i.getIndexedRef(bindings, match)
+	if !ok {
+		return nil, nil, false
+	}
+
+	p, ok := pattern.Value.(String)
+	if !ok {
+		return nil, nil, false
+	}
+
+	re, err := syntax.Parse(string(p), syntax.Perl)
+	if err != nil || re.Op != syntax.OpConcat || len(re.Sub) < 2 {
+		return nil, nil, false
+	}
+
+	if re.Sub[0].Op != syntax.OpBeginText {
+		return nil, nil, false
+	}
+
+	lit := re.Sub[1]
+	if lit.Op != syntax.OpLiteral || lit.Flags&syntax.FoldCase != 0 || len(lit.Rune) == 0 {
+		return nil, nil, false
+	}
+
+	return ref, regexPrefixIndexValue(string(lit.Rune)), true
+}
+
+// getIndexedRef returns the ref that can be indexed for term. The term must
+// either be a ground, non-virtual ref to a base document or a var that is
+// bound to such a ref in the rule body.
+func (i *baseDocEqIndex) getIndexedRef(bindings *indexBindings, term *Term) (Ref, bool) {
 
-func (m refValueIndex) Insert(rule *Rule, ref Ref, value Value) {
+	var ref Ref
+
+	switch v := term.Value.(type) {
+	case Ref:
+		ref = v
+	case Var:
+		var ok bool
+		if ref, ok = bindings.refs[v]; !ok {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	if !RootDocumentNames.Contains(ref[0]) {
+		return nil, false
+	}
+
+	if i.isVirtual(ref) {
+		return nil, false
+	}
+
+	if ref.IsNested() || !ref.IsGround() {
+		return nil, false
+	}
+
+	return ref, true
+}
+
+const globSpecialChars = "*?[]{}!\\"
+
+// indexBindings records the vars in a rule body that are bound to refs and
+// collections of scalars. The compiler rewrites refs in call operands into
+// local vars so the bindings are needed to index calls like equal and
+// glob.match.
+type indexBindings struct {
+	refs        map[Var]Ref
+	collections map[Var]Value
+	members     map[Var]Var
+}
+
+func newIndexBindings(body Body) *indexBindings {
+
+	b := &indexBindings{
+		refs:        map[Var]Ref{},
+		collections: map[Var]Value{},
+		members:     map[Var]Var{},
+	}
+
+	for _, expr := range body {
+		if expr.Negated || len(expr.With) > 0 || !expr.IsEquality() {
+			continue
+		}
+		b.bind(expr.Operand(0), expr.Operand(1))
+		b.bind(expr.Operand(1), expr.Operand(0))
+	}
+
+	return b
+}
+
+func (b *indexBindings) bind(a, x *Term) {
+
+	v, ok := a.Value.(Var)
+	if !ok {
+		return
+	}
+
+	switch x := x.Value.(type) {
+	case Ref:
+		if RootDocumentNames.Contains(x[0]) {
+			b.refs[v] = x
+		} else if len(x) == 2 {
+			if head, ok := x[0].Value.(Var); ok {
+				if _, ok := x[1].Value.(Var); ok {
+					b.members[v] = head
+				}
+			}
+		}
+	case Array:
+		if scalars(x) {
+			b.collections[v] = x
+		}
+	case Set:
+		if scalars(x) {
+			b.collections[v] = x
+		}
+	}
+}
+
+// membership returns the set of values that term must be a member of. The term
+// must either be a var bound to an element of a collection, e.g., x = s[_], or
+// a ref to an element of a collection, e.g., s[_].
+func (b *indexBindings) membership(term *Term) (setIndexValue, bool) {
+
+	var head Var
+
+	switch x := term.Value.(type) {
+	case Var:
+		var ok bool
+		if head, ok = b.members[x]; !ok {
+			return setIndexValue{}, false
+		}
+	case Ref:
+		if len(x) != 2 {
+			return setIndexValue{}, false
+		}
+		var ok bool
+		if head, ok = x[0].Value.(Var); !ok {
+			return setIndexValue{}, false
+		}
+		if _, ok = x[1].Value.(Var); !ok {
+			return setIndexValue{}, false
+		}
+	default:
+		return setIndexValue{}, false
+	}
+
+	coll, ok := b.collections[head]
+	if !ok {
+		return setIndexValue{}, false
+	}
+
+	return newSetIndexValue(coll), true
+}
+
+func scalars(x interface{}) bool {
+	result := true
+	switch x := x.(type) {
+	case Array:
+		for i := range x {
+			result = result && IsScalar(x[i].Value)
+		}
+	case Set:
+		x.Foreach(func(elem *Term) {
+			result = result && IsScalar(elem.Value)
+		})
+	}
+	return result
+}
+
+// setIndexValue represents a condition that requires the ref to be a member of
+// a collection of scalars.
+type setIndexValue struct {
+	coll  Value
+	elems map[Value]struct{}
+}
+
+func newSetIndexValue(coll Value) setIndexValue {
+	elems := map[Value]struct{}{}
+	switch coll := coll.(type) {
+	case Array:
+		for i := range coll {
+			elems[indexKey(coll[i].Value)] = struct{}{}
+		}
+	case Set:
+		coll.Foreach(func(elem *Term) {
+			elems[indexKey(elem.Value)] = struct{}{}
+		})
+	}
+	return setIndexValue{coll, elems}
+}
+
+// notEqualIndexValue represents a condition that requires the ref to not be
+// equal to a scalar.
+type notEqualIndexValue struct {
+	value Value
+}
+
+// globIndexValue represents a condition that requires the ref to match a glob
+// pattern. The pattern is represented as an array of segments where wildcard
+// segments are vars.
+type globIndexValue struct {
+	delim    string
+	segments Array
+}
+
+// regexPrefixIndexValue represents a condition that requires the ref to start
+// with a string.
+type regexPrefixIndexValue string
+
+type refValueIndex map[*Rule]*util.HashMap
+
+// Insert records the value for the ref in the rule. If the rule already has a
+// value for the ref, vars are replaced by more selective values. Insert returns
+// true if the ref did not have a value before.
+func (m refValueIndex) Insert(rule *Rule, ref Ref, value interface{}) bool {
 	vm, ok := m[rule]
 	if !ok {
-		vm = NewValueMap()
+		vm = newRefHashMap()
 		m[rule] = vm
 	}
+	if curr, ok := vm.Get(ref); ok {
+		if _, ok := curr.(Var); ok {
+			vm.Put(ref, value)
+		}
+		return false
+	}
 	vm.Put(ref, value)
+	return true
+}
+
+func newRefHashMap() *util.HashMap {
+	return util.NewHashMap(func(a, b util.T) bool {
+		r1, r2 := a.(Ref), b.(Ref)
+		return r1.Equal(r2)
+	}, func(x util.T) int {
+		return x.(Ref).Hash()
+	})
 }
 
 type trieWalker interface {
@@ -303,9 +664,18 @@ type trieNode struct {
 	undefined *trieNode
 	scalars   map[Value]*trieNode
 	array     *trieNode
+	notEqual  map[Value]*trieNode
+	globs     map[string]*trieNode
+	prefixes  map[string]*trieNode
+	sets      []*trieSetNode
 	rules     []*ruleNode
 }
 
+type trieSetNode struct {
+	value setIndexValue
+	node  *trieNode
+}
+
 type ruleNode struct {
 	prio [2]int
 	rule *Rule
@@ -313,7 +683,10 @@ type ruleNode struct {
 
 func newTrieNodeImpl() *trieNode {
 	return &trieNode{
-		scalars: map[Value]*trieNode{},
+		scalars:  map[Value]*trieNode{},
+		notEqual: map[Value]*trieNode{},
+		globs:    map[string]*trieNode{},
+		prefixes: map[string]*trieNode{},
 	}
 }
 
@@ -338,9 +711,21 @@ func (node *trieNode) Do(walker trieWalker) {
 	if node.array != nil {
 		node.array.Do(next)
 	}
+	for _, child := range node.notEqual {
+		child.Do(next)
+	}
+	for _, child := range node.globs {
+		child.Do(next)
+	}
+	for _, child := range node.prefixes {
+		child.Do(next)
+	}
+	for _, child := range node.sets {
+		child.node.Do(next)
+	}
 }
 
-func (node *trieNode) Insert(ref Ref, value Value) *trieNode {
+func (node *trieNode) Insert(ref Ref, value interface{}) *trieNode {
 
 	if node.next == nil {
 		node.next = newTrieNodeImpl()
@@ -363,7 +748,7 @@ func (node *trieNode) Traverse(resolver ValueResolver, tr *trieTraversalResult)
 	return node.next.traverse(resolver, tr)
 }
 
-func (node *trieNode) insertValue(value Value) *trieNode {
+func (node *trieNode) insertValue(value interface{}) *trieNode {
 
 	switch value := value.(type) {
 	case nil:
@@ -377,22 +762,64 @@ func (node *trieNode) insertValue(value Value) *trieNode {
 		}
 		return node.any
 	case Null, Boolean, Number, String:
-		child, ok := node.scalars[value]
-		if !ok {
-			child = newTrieNodeImpl()
-			node.scalars[value] = child
-		}
-		return child
+		return insertChild(node.scalars, value.(Value))
 	case Array:
 		if node.array == nil {
 			node.array = newTrieNodeImpl()
 		}
 		return node.array.insertArray(value)
+	case notEqualIndexValue:
+		return insertChild(node.notEqual, value.value)
+	case globIndexValue:
+		child, ok := node.globs[value.delim]
+		if !ok {
+			child = newTrieNodeImpl()
+			node.globs[value.delim] = child
+		}
+		return child.insertArray(value.segments)
+	case regexPrefixIndexValue:
+		child, ok := node.prefixes[string(value)]
+		if !ok {
+			child = newTrieNodeImpl()
+			node.prefixes[string(value)] = child
+		}
+		return child
+	case setIndexValue:
+		for _, child := range node.sets {
+			if child.value.coll.Compare(value.coll) == 0 {
+				return child.node
+			}
+		}
+		child := &trieSetNode{value, newTrieNodeImpl()}
+		node.sets = append(node.sets, child)
+		return child.node
 	}
 
 	panic("illegal value")
 }
 
+func insertChild(children map[Value]*trieNode, value Value) *trieNode {
+	key := indexKey(value)
+	child, ok := children[key]
+	if !ok {
+		child = newTrieNodeImpl()
+		children[key] = child
+	}
+	return child
+}
+
+// indexKey returns the key for the scalar value in the trie. Numbers are
+// compared numerically (e.g., 1 is equal to 1.0) so they are normalized the
+// same way as in Compare.
+func indexKey(value Value) Value {
+	if n, ok := value.(Number); ok {
+		if f, ok := new(big.Float).SetString(string(n)); ok {
+			return Number(f.Text('g', -1))
+		}
+	}
+	return value
+}
+
 func (node *trieNode) insertArray(arr Array) *trieNode {
 
 	if len(arr) == 0 {
@@ -406,12 +833,7 @@ func (node *trieNode) insertArray(arr Array) *trieNode {
 		}
 		return node.any.insertArray(arr[1:])
 	case Null, Boolean, Number, String:
-		child, ok := node.scalars[head]
-		if !ok {
-			child = newTrieNodeImpl()
-			node.scalars[head] = child
-		}
-		return child.insertArray(arr[1:])
+		return insertChild(node.scalars, head).insertArray(arr[1:])
 	}
 
 	panic("illegal value")
@@ -445,6 +867,10 @@ func (node *trieNode) traverse(resolver ValueResolver, tr *trieTraversalResult)
 
 func (node *trieNode) traverseValue(resolver ValueResolver, tr *trieTraversalResult, value Value) error {
 
+	if err := node.traverseConditions(resolver, tr, value); err != nil {
+		return err
+	}
+
 	switch value := value.(type) {
 	case Array:
 		if node.array == nil {
@@ -453,7 +879,7 @@ func (node *trieNode) traverseValue(resolver ValueResolver, tr *trieTraversalRes
 		return node.array.traverseArray(resolver, tr, value)
 
 	case Null, Boolean, Number, String:
-		child, ok := node.scalars[value]
+		child, ok := node.scalars[indexKey(value)]
 		if !ok {
 			return nil
 		}
@@ -463,6 +889,78 @@ func (node *trieNode) traverseValue(resolver ValueResolver, tr *trieTraversalRes
 	return nil
 }
 
+// traverseConditions visits the children for conditions other than equality.
+// If the value is not a string, the glob and regex children are visited
+// because the built-in functions return errors for non-string operands. Sets
+// only contain scalars so they are not visited for other values.
+func (node *trieNode) traverseConditions(resolver ValueResolver, tr *trieTraversalResult, value Value) error {
+
+	scalar := IsScalar(value)
+
+	var key Value
+	if scalar {
+		key = indexKey(value)
+	}
+
+	for k, child := range node.notEqual {
+		if !scalar || k != key {
+			if err := child.Traverse(resolver, tr); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, child := range node.sets {
+		if _, ok := child.value.elems[key]; ok && scalar {
+			if err := child.node.Traverse(resolver, tr); err != nil {
+				return err
+			}
+		}
+	}
+
+	s, ok := value.(String)
+
+	for delim, child := range node.globs {
+		var err error
+		if ok {
+			err = child.traverseArray(resolver, tr, splitString(string(s), delim))
+		} else {
+			err = child.traverseArrayAll(resolver, tr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !ok {
+		for _, child := range node.prefixes {
+			if err := child.Traverse(resolver, tr); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for j := 1; j <= len(s) && len(node.prefixes) > 0; j++ {
+		if child, ok := node.prefixes[string(s[:j])]; ok {
+			if err := child.Traverse(resolver, tr); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func splitString(s string, delim string) Array {
+	parts := strings.Split(s, delim)
+	arr := make(Array, len(parts))
+	for i := range parts {
+		arr[i] = StringTerm(parts[i])
+	}
+	return arr
+}
+
 func (node *trieNode) traverseArray(resolver ValueResolver, tr *trieTraversalResult, arr Array) error {
 
 	if len(arr) == 0 {
@@ -482,7 +980,7 @@ func (node *trieNode) traverseArray(resolver ValueResolver, tr *trieTraversalRes
 		node.any.traverseArray(resolver, tr, arr[1:])
 	}
 
-	child, ok := node.scalars[head]
+	child, ok := node.scalars[indexKey(head)]
 	if !ok {
 		return nil
 	}
@@ -490,6 +988,30 @@ func (node *trieNode) traverseArray(resolver ValueResolver, tr *trieTraversalRes
 	return child.traverseArray(resolver, tr, arr[1:])
 }
 
+// traverseArrayAll visits all nodes that terminate an array in the trie.
+func (node *trieNode) traverseArrayAll(resolver ValueResolver, tr *trieTraversalResult) error {
+
+	if node.next != nil || len(node.rules) > 0 {
+		if err := node.Traverse(resolver, tr); err != nil {
+			return err
+		}
+	}
+
+	if node.any != nil {
+		if err := node.any.traverseArrayAll(resolver, tr); err != nil {
+			return err
+		}
+	}
+
+	for _, child := range node.scalars {
+		if err := child.traverseArrayAll(resolver, tr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 type triePrinter struct {
 	depth int
 	w     io.Writer
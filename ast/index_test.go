@@ -114,6 +114,56 @@ func TestBaseDocEqIndexing(t *testing.T) {
 		input.x = 1
 	}
 
+	glob_match {
+		glob.match("/api/*/users", ["/"], input.path)
+	} {
+		x = input.path
+		glob.match("/admin/*", ["/"], x)
+	} {
+		glob.match("*.example.com", [], input.host)
+	} {
+		# Patterns with partial segment wildcards are not indexed.
+		glob.match("/api/v*", ["/"], input.path)
+	}
+
+	regex_prefix {
+		re_match("^/api/", input.path)
+	} {
+		re_match("^/admin/.*$", input.path)
+	} {
+		# Patterns that are not anchored are not indexed.
+		re_match("users", input.path)
+	}
+
+	membership {
+		methods = {"GET", "HEAD"}
+		methods[input.method]
+	} {
+		methods = {"POST", "PUT"}
+		m = input.method
+		x = methods[i]
+		m == x
+	} {
+		methods = ["DELETE"]
+		input.method = methods[i]
+	}
+
+	not_equal {
+		input.x != 1
+	} {
+		x = input.x
+		x != 2
+	}
+
+	numbers {
+		input.x = 1
+	} {
+		s = {1, 2}
+		s[input.x]
+	} {
+		input.x != 1
+	}
+
 	# exercise default keyword
 	default allow = false
 	allow {
@@ -268,6 +318,153 @@ func TestBaseDocEqIndexing(t *testing.T) {
 			input:      `{"x": 1000, "y": 1000}`,
 			expectedRS: []string{},
 		},
+		{
+			note:    "glob match",
+			ruleset: "glob_match",
+			input:   `{"path": "/api/v1/users"}`,
+			expectedRS: []string{
+				`glob_match { glob.match("/api/*/users", ["/"], input.path) }`,
+				`glob_match { glob.match("/api/v*", ["/"], input.path) }`,
+			},
+		},
+		{
+			note:    "glob match var and default delimiter",
+			ruleset: "glob_match",
+			input:   `{"path": "/admin/users", "host": "www.example.com"}`,
+			expectedRS: []string{
+				`glob_match { x = input.path; glob.match("/admin/*", ["/"], x) }`,
+				`glob_match { glob.match("*.example.com", [], input.host) }`,
+				`glob_match { glob.match("/api/v*", ["/"], input.path) }`,
+			},
+		},
+		{
+			note:    "glob match non-string",
+			ruleset: "glob_match",
+			input:   `{"path": 7}`,
+			expectedRS: []string{
+				`glob_match { glob.match("/api/*/users", ["/"], input.path) }`,
+				`glob_match { x = input.path; glob.match("/admin/*", ["/"], x) }`,
+				`glob_match { glob.match("/api/v*", ["/"], input.path) }`,
+			},
+		},
+		{
+			note:    "regex prefix match",
+			ruleset: "regex_prefix",
+			input:   `{"path": "/api/v1/users"}`,
+			expectedRS: []string{
+				`regex_prefix { re_match("^/api/", input.path) }`,
+				`regex_prefix { re_match("users", input.path) }`,
+			},
+		},
+		{
+			note:    "regex prefix miss",
+			ruleset: "regex_prefix",
+			input:   `{"path": "/ad"}`,
+			expectedRS: []string{
+				`regex_prefix { re_match("users", input.path) }`,
+			},
+		},
+		{
+			note:    "set membership",
+			ruleset: "membership",
+			input:   `{"method": "HEAD"}`,
+			expectedRS: []string{
+				`membership { methods = {"GET", "HEAD"}; methods[input.method] }`,
+			},
+		},
+		{
+			note:    "set membership var",
+			ruleset: "membership",
+			input:   `{"method": "PUT"}`,
+			expectedRS: []string{
+				`membership { methods = {"POST", "PUT"}; m = input.method; x = methods[i]; m == x }`,
+			},
+		},
+		{
+			note:    "array membership",
+			ruleset: "membership",
+			input:   `{"method": "DELETE"}`,
+			expectedRS: []string{
+				`membership { methods = ["DELETE"]; input.method = methods[i] }`,
+			},
+		},
+		{
+			note:       "membership miss",
+			ruleset:    "membership",
+			input:      `{"method": "PATCH"}`,
+			expectedRS: []string{},
+		},
+		{
+			note:       "membership non-scalar",
+			ruleset:    "membership",
+			input:      `{"method": ["GET"]}`,
+			expectedRS: []string{},
+		},
+		{
+			note:       "membership non-scalar set",
+			ruleset:    "membership",
+			input:      `{"method": {"PUT"}}`,
+			expectedRS: []string{},
+		},
+		{
+			note:    "numbers",
+			ruleset: "numbers",
+			input:   `{"x": 1}`,
+			expectedRS: []string{
+				`numbers { input.x = 1 }`,
+				`numbers { s = {1, 2}; s[input.x] }`,
+			},
+		},
+		{
+			note:    "numbers float",
+			ruleset: "numbers",
+			input:   `{"x": 1.0}`,
+			expectedRS: []string{
+				`numbers { input.x = 1 }`,
+				`numbers { s = {1, 2}; s[input.x] }`,
+			},
+		},
+		{
+			note:    "numbers exponent",
+			ruleset: "numbers",
+			input:   `{"x": 0.2e1}`,
+			expectedRS: []string{
+				`numbers { s = {1, 2}; s[input.x] }`,
+				`numbers { input.x != 1 }`,
+			},
+		},
+		{
+			note:    "not equal",
+			ruleset: "not_equal",
+			input:   `{"x": 1}`,
+			expectedRS: []string{
+				`not_equal { x = input.x; x != 2 }`,
+			},
+		},
+		{
+			note:    "not equal multiple",
+			ruleset: "not_equal",
+			input:   `{"x": 3}`,
+			expectedRS: []string{
+				`not_equal { input.x != 1 }`,
+				`not_equal { x = input.x; x != 2 }`,
+			},
+		},
+		{
+			note:    "not equal non-scalar",
+			ruleset: "not_equal",
+			input:   `{"x": [1]}`,
+			expectedRS: []string{
+				`not_equal { input.x != 1 }`,
+				`not_equal { x = input.x; x != 2 }`,
+			},
+		},
+		{
+			note:       "not equal undefined",
+			ruleset:    "not_equal",
+			input:      `{}`,
+			expectedRS: []string{},
+		},
 		{
 			note:       "default rule only",
 			ruleset:    "allow",
@@ -415,6 +612,44 @@ func TestBaseDocEqIndexingPriorities(t *testing.T) {
 	}
 }
 
+func TestBaseDocEqIndexingEarlyExit(t *testing.T) {
+
+	tests := []struct {
+		note     string
+		module   string
+		expected bool
+	}{
+		{"constant", `p { input.x = 1 }
+		p { input.y = 2 }`, true},
+		{"default", `default p = false
+		p = false { input.x = 1 }`, true},
+		{"function", `f(x) = true { x = 1 }
+		f(x) { x = 2 }`, true},
+		{"different values", `p = 1 { input.x = 1 }
+		p = 2 { input.y = 2 }`, false},
+		{"non-ground value", `p = x { x = input.x }`, false},
+		{"else", `p { input.x = 1 } else { true }`, false},
+		{"partial set", `p[x] { x = input.x }`, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			module := MustParseModule("package test\n" + tc.module)
+			index := newBaseDocEqIndex(func(Ref) bool { return false })
+			if !index.Build(module.Rules) {
+				t.Fatalf("Expected index build to succeed")
+			}
+			result, err := index.Lookup(testResolver{MustParseTerm(`{"x": 1, "y": 2}`), nil})
+			if err != nil {
+				t.Fatalf("Unexpected error during index lookup: %v", err)
+			}
+			if result.EarlyExit != tc.expected {
+				t.Fatalf("Expected early exit to be %v but got %v", tc.expected, result.EarlyExit)
+			}
+		})
+	}
+}
+
 func TestBaseDocEqIndexingErrors(t *testing.T) {
 	index := newBaseDocEqIndex(func(Ref) bool {
 		return false
@@ -557,6 +557,10 @@ func parseModule(stmts []Statement, comments []*Comment) (*Module, error) {
 		}
 	}
 
+	if len(errs) == 0 {
+		errs = attachAnnotations(mod)
+	}
+
 	if len(errs) == 0 {
 		return mod, nil
 	}
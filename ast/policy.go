@@ -107,10 +107,11 @@ type (
 	// within a namespace (defined by the package) and optional
 	// dependencies on external documents (defined by imports).
 	Module struct {
-		Package  *Package   `json:"package"`
-		Imports  []*Import  `json:"imports,omitempty"`
-		Rules    []*Rule    `json:"rules,omitempty"`
-		Comments []*Comment `json:"comments,omitempty"`
+		Package     *Package     `json:"package"`
+		Imports     []*Import    `json:"imports,omitempty"`
+		Rules       []*Rule      `json:"rules,omitempty"`
+		Comments    []*Comment   `json:"comments,omitempty"`
+		Annotations *Annotations `json:"annotations,omitempty"`
 	}
 
 	// Comment contains the raw text from the comment in the definition.
@@ -143,6 +144,11 @@ type (
 		Body     Body      `json:"body"`
 		Else     *Rule     `json:"else,omitempty"`
 
+		// Annotations contains the metadata declared in the comment block
+		// preceding the rule (if any.) Like locations, annotations are not
+		// included in comparisons.
+		Annotations *Annotations `json:"annotations,omitempty"`
+
 		// Module is a pointer to the module containing this rule. If the rule
 		// was NOT created while parsing/constructing a module, this should be
 		// left unset. The pointer is not included in any standard operations
@@ -216,6 +222,7 @@ func (mod *Module) Copy() *Module {
 		cpy.Imports[i] = mod.Imports[i].Copy()
 	}
 	cpy.Package = mod.Package.Copy()
+	cpy.Annotations = mod.Annotations.Copy()
 	return &cpy
 }
 
@@ -415,6 +422,7 @@ func (rule *Rule) Copy() *Rule {
 	if cpy.Else != nil {
 		cpy.Else = rule.Else.Copy()
 	}
+	cpy.Annotations = rule.Annotations.Copy()
 	return &cpy
 }
 
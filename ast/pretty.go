@@ -58,6 +58,12 @@ func (pp *prettyPrinter) Visit(x interface{}) Visitor {
 		}
 		extras = append(extras, fmt.Sprintf("index=%d", x.Index))
 		pp.writeIndent("%v %v", TypeName(x), strings.Join(extras, " "))
+	case *Module:
+		pp.writeType(x)
+		pp.writeAnnotations(x.Annotations)
+	case *Rule:
+		pp.writeType(x)
+		pp.writeAnnotations(x.Annotations)
 	case Null, Boolean, Number, String, Var:
 		pp.writeValue(x)
 	default:
@@ -74,6 +80,15 @@ func (pp *prettyPrinter) writeType(x interface{}) {
 	pp.writeIndent(TypeName(x))
 }
 
+func (pp *prettyPrinter) writeAnnotations(a *Annotations) {
+	if a == nil {
+		return
+	}
+	pp.depth++
+	pp.writeIndent("annotations %v", a)
+	pp.depth--
+}
+
 func (pp *prettyPrinter) writeIndent(f string, a ...interface{}) {
 	pad := strings.Repeat(" ", pp.depth)
 	pp.write(pad+f, a...)
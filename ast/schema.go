@@ -0,0 +1,317 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package ast
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/types"
+	"github.com/open-policy-agent/opa/util"
+)
+
+// SchemaSet holds a map from a path to a JSON Schema. The path must refer to
+// the input document or a subtree of the data document, e.g., input or
+// data.servers. The schemas are used by the compiler to type check references
+// to the documents.
+type SchemaSet struct {
+	m *util.HashMap
+}
+
+// NewSchemaSet returns an empty SchemaSet.
+func NewSchemaSet() *SchemaSet {
+	return &SchemaSet{
+		m: util.NewHashMap(func(a, b util.T) bool {
+			return a.(Ref).Equal(b.(Ref))
+		}, func(x util.T) int {
+			return x.(Ref).Hash()
+		}),
+	}
+}
+
+// Put inserts the schema for the document referred to by path. The schema
+// must be the decoded JSON representation of a JSON Schema.
+func (ss *SchemaSet) Put(path Ref, schema interface{}) {
+	ss.m.Put(path, schema)
+}
+
+// Get returns the schema for the document referred to by path or nil if no
+// schema exists for the path.
+func (ss *SchemaSet) Get(path Ref) interface{} {
+	if ss == nil {
+		return nil
+	}
+	x, ok := ss.m.Get(path)
+	if !ok {
+		return nil
+	}
+	return x
+}
+
+// Paths returns the paths that have schemas sorted in ascending order.
+func (ss *SchemaSet) Paths() []Ref {
+	var paths []Ref
+	if ss == nil {
+		return paths
+	}
+	ss.m.Iter(func(k, _ util.T) bool {
+		paths = append(paths, k.(Ref))
+		return false
+	})
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i].Compare(paths[j]) < 0
+	})
+	return paths
+}
+
+// SchemaToType converts a JSON Schema into a type. Objects that declare
+// properties are closed unless they set "additionalProperties" so that
+// references to undeclared properties are reported by the type checker.
+// Schema keywords that do not affect the shape of the document (e.g.,
+// "required" or "pattern") are ignored.
+func SchemaToType(schema interface{}) (types.Type, error) {
+	root, ok := schema.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema must be an object")
+	}
+	c := &schemaConverter{
+		root:     root,
+		visiting: map[string]bool{},
+	}
+	return c.convert(root)
+}
+
+type schemaConverter struct {
+	root     map[string]interface{}
+	visiting map[string]bool
+}
+
+func (c *schemaConverter) convert(x interface{}) (types.Type, error) {
+
+	switch x := x.(type) {
+	case bool:
+		// The "true" schema accepts any value. The "false" schema accepts
+		// nothing but there is no type for that so treat it like "true".
+		return types.A, nil
+	case map[string]interface{}:
+		return c.convertObject(x)
+	}
+
+	return nil, fmt.Errorf("schema must be an object or boolean but got %v", util.MustMarshalJSON(x))
+}
+
+func (c *schemaConverter) convertObject(schema map[string]interface{}) (types.Type, error) {
+
+	if ref, ok := schema["$ref"]; ok {
+		return c.convertRef(ref)
+	}
+
+	for _, key := range []string{"anyOf", "oneOf"} {
+		if alts, ok := schema[key]; ok {
+			return c.convertUnion(key, alts)
+		}
+	}
+
+	if enum, ok := schema["enum"]; ok {
+		return c.convertEnum(enum)
+	}
+
+	switch tpe := schema["type"].(type) {
+	case nil:
+		if _, ok := schema["properties"]; ok {
+			return c.convertType("object", schema)
+		}
+		if _, ok := schema["items"]; ok {
+			return c.convertType("array", schema)
+		}
+		return types.A, nil
+	case string:
+		return c.convertType(tpe, schema)
+	case []interface{}:
+		var result types.Type
+		for _, elem := range tpe {
+			s, ok := elem.(string)
+			if !ok {
+				return nil, fmt.Errorf("type must be a string or array of strings")
+			}
+			t, err := c.convertType(s, schema)
+			if err != nil {
+				return nil, err
+			}
+			result = types.Or(result, t)
+		}
+		if result == nil {
+			return types.A, nil
+		}
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("type must be a string or array of strings")
+}
+
+func (c *schemaConverter) convertType(tpe string, schema map[string]interface{}) (types.Type, error) {
+	switch tpe {
+	case "null":
+		return types.NewNull(), nil
+	case "boolean":
+		return types.B, nil
+	case "number", "integer":
+		return types.N, nil
+	case "string":
+		return types.S, nil
+	case "array":
+		return c.convertArray(schema)
+	case "object":
+		return c.convertProperties(schema)
+	}
+	return nil, fmt.Errorf("unknown type %q", tpe)
+}
+
+func (c *schemaConverter) convertArray(schema map[string]interface{}) (types.Type, error) {
+
+	switch items := schema["items"].(type) {
+	case nil:
+		return types.NewArray(nil, types.A), nil
+	case []interface{}:
+		static := make([]types.Type, len(items))
+		for i := range items {
+			t, err := c.convert(items[i])
+			if err != nil {
+				return nil, err
+			}
+			static[i] = t
+		}
+		var dynamic types.Type
+		if additional, ok := schema["additionalItems"]; ok {
+			if b, ok := additional.(bool); !ok || b {
+				t, err := c.convert(additional)
+				if err != nil {
+					return nil, err
+				}
+				dynamic = t
+			}
+		}
+		return types.NewArray(static, dynamic), nil
+	default:
+		t, err := c.convert(items)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewArray(nil, t), nil
+	}
+}
+
+func (c *schemaConverter) convertProperties(schema map[string]interface{}) (types.Type, error) {
+
+	props, ok := schema["properties"]
+	if !ok {
+		props = map[string]interface{}{}
+	}
+
+	obj, ok := props.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("properties must be an object")
+	}
+
+	static := make([]*types.StaticProperty, 0, len(obj))
+
+	for k, v := range obj {
+		t, err := c.convert(v)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", k, err)
+		}
+		static = append(static, types.NewStaticProperty(k, t))
+	}
+
+	var dynamic *types.DynamicProperty
+
+	switch additional := schema["additionalProperties"].(type) {
+	case nil:
+		// Objects without declared properties may contain anything.
+		if len(static) == 0 {
+			dynamic = types.NewDynamicProperty(types.S, types.A)
+		}
+	case bool:
+		if additional {
+			dynamic = types.NewDynamicProperty(types.S, types.A)
+		}
+	default:
+		t, err := c.convert(additional)
+		if err != nil {
+			return nil, err
+		}
+		dynamic = types.NewDynamicProperty(types.S, t)
+	}
+
+	return types.NewObject(static, dynamic), nil
+}
+
+func (c *schemaConverter) convertUnion(key string, alts interface{}) (types.Type, error) {
+	arr, ok := alts.([]interface{})
+	if !ok || len(arr) == 0 {
+		return nil, fmt.Errorf("%v must be a non-empty array", key)
+	}
+	var result types.Type
+	for i := range arr {
+		t, err := c.convert(arr[i])
+		if err != nil {
+			return nil, err
+		}
+		result = types.Or(result, t)
+	}
+	return result, nil
+}
+
+func (c *schemaConverter) convertEnum(enum interface{}) (types.Type, error) {
+	arr, ok := enum.([]interface{})
+	if !ok || len(arr) == 0 {
+		return nil, fmt.Errorf("enum must be a non-empty array")
+	}
+	var result types.Type
+	for i := range arr {
+		v, err := InterfaceToValue(arr[i])
+		if err != nil {
+			return nil, err
+		}
+		result = types.Or(result, NewTypeEnv().Get(v))
+	}
+	return result, nil
+}
+
+// convertRef resolves references to definitions in the same document, e.g.,
+// "#/definitions/address". Recursive definitions are typed as any.
+func (c *schemaConverter) convertRef(ref interface{}) (types.Type, error) {
+
+	s, ok := ref.(string)
+	if !ok || !strings.HasPrefix(s, "#") {
+		return nil, fmt.Errorf("unsupported $ref %v (only local references are supported)", util.MustMarshalJSON(ref))
+	}
+
+	if c.visiting[s] {
+		return types.A, nil
+	}
+
+	var curr interface{} = c.root
+
+	for _, part := range strings.Split(strings.TrimPrefix(s, "#"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.Replace(strings.Replace(part, "~1", "/", -1), "~0", "~", -1)
+		obj, ok := curr.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolved $ref %q", s)
+		}
+		if curr, ok = obj[part]; !ok {
+			return nil, fmt.Errorf("unresolved $ref %q", s)
+		}
+	}
+
+	c.visiting[s] = true
+	defer delete(c.visiting, s)
+
+	return c.convert(curr)
+}
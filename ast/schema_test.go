@@ -0,0 +1,85 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package ast
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/types"
+	"github.com/open-policy-agent/opa/util"
+)
+
+func TestSchemaToType(t *testing.T) {
+
+	tests := []struct {
+		note     string
+		schema   string
+		expected types.Type
+	}{
+		{"any", `{}`, types.A},
+		{"scalars", `{"type": ["null", "boolean", "integer", "string"]}`, types.NewAny(types.NewNull(), types.B, types.N, types.S)},
+		{"open object", `{"type": "object"}`, types.NewObject(nil, types.NewDynamicProperty(types.S, types.A))},
+		{"closed object", `{"type": "object", "properties": {"a": {"type": "string"}, "b": {"type": "number"}}}`, types.NewObject(
+			[]*types.StaticProperty{
+				types.NewStaticProperty("a", types.S),
+				types.NewStaticProperty("b", types.N),
+			}, nil)},
+		{"additional properties", `{"properties": {"a": {"type": "string"}}, "additionalProperties": {"type": "boolean"}}`, types.NewObject(
+			[]*types.StaticProperty{
+				types.NewStaticProperty("a", types.S),
+			}, types.NewDynamicProperty(types.S, types.B))},
+		{"array", `{"type": "array", "items": {"type": "string"}}`, types.NewArray(nil, types.S)},
+		{"tuple", `{"type": "array", "items": [{"type": "string"}, {"type": "number"}]}`, types.NewArray([]types.Type{types.S, types.N}, nil)},
+		{"enum", `{"enum": ["a", 1]}`, types.NewAny(types.S, types.N)},
+		{"any of", `{"anyOf": [{"type": "string"}, {"type": "array"}]}`, types.NewAny(types.S, types.NewArray(nil, types.A))},
+		{"ref", `{"properties": {"a": {"$ref": "#/definitions/x"}}, "definitions": {"x": {"type": "string"}}}`, types.NewObject(
+			[]*types.StaticProperty{
+				types.NewStaticProperty("a", types.S),
+			}, nil)},
+		{"recursive ref", `{"$ref": "#/definitions/x", "definitions": {"x": {"properties": {"y": {"$ref": "#/definitions/x"}}}}}`, types.NewObject(
+			[]*types.StaticProperty{
+				types.NewStaticProperty("y", types.A),
+			}, nil)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			result, err := SchemaToType(util.MustUnmarshalJSON([]byte(tc.schema)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if types.Compare(result, tc.expected) != 0 {
+				t.Fatalf("Expected %v but got: %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestSchemaToTypeErrors(t *testing.T) {
+
+	tests := []struct {
+		note     string
+		schema   string
+		expected string
+	}{
+		{"non-object", `[]`, "schema must be an object"},
+		{"unknown type", `{"type": "float"}`, `unknown type "float"`},
+		{"bad properties", `{"properties": []}`, "properties must be an object"},
+		{"bad property", `{"properties": {"a": {"type": 1}}}`, "a: type must be a string or array of strings"},
+		{"remote ref", `{"$ref": "http://example.com/schema.json"}`, "only local references are supported"},
+		{"unresolved ref", `{"$ref": "#/definitions/x"}`, `unresolved $ref "#/definitions/x"`},
+		{"empty enum", `{"enum": []}`, "enum must be a non-empty array"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			_, err := SchemaToType(util.MustUnmarshalJSON([]byte(tc.schema)))
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Fatalf("Expected error containing %q but got: %v", tc.expected, err)
+			}
+		})
+	}
+}
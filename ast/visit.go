@@ -308,6 +308,15 @@ func (vis *VarVisitor) Visit(v interface{}) Visitor {
 			return nil
 		}
 	}
+	if vis.params.SkipRefCallHead {
+		if v, ok := v.(*With); ok {
+			if !vis.params.SkipWithTarget {
+				vis.walkWithOperand(v.Target)
+			}
+			vis.walkWithOperand(v.Value)
+			return nil
+		}
+	}
 	if vis.params.SkipWithTarget {
 		if v, ok := v.(*With); ok {
 			Walk(vis, v.Value)
@@ -341,6 +350,18 @@ func (vis *VarVisitor) Visit(v interface{}) Visitor {
 	return vis
 }
 
+// walkWithOperand walks the target or value of a with modifier. Built-in
+// functions referred to by the operand are treated like call heads.
+func (vis *VarVisitor) walkWithOperand(t *Term) {
+	if r, ok := t.Value.(Ref); ok && BuiltinMap[r.String()] != nil {
+		for _, x := range r[1:] {
+			Walk(vis, x)
+		}
+		return
+	}
+	Walk(vis, t)
+}
+
 type noopBeforeAndAfterVisitor struct {
 	Visitor
 }
@@ -18,6 +18,8 @@ import (
 var checkParams = struct {
 	format   *util.EnumFlag
 	errLimit int
+	schema   string
+	strict   bool
 }{
 	format: util.NewEnumFlag(checkFormatPretty, []string{
 		checkFormatPretty, checkFormatJSON,
@@ -38,7 +40,18 @@ var checkCommand = &cobra.Command{
 
 If the 'check' command succeeds in parsing and compiling the source file(s), no output
 is produced. If the parsing or compiling fails, 'check' will output the errors
-and exit with a non-zero exit code.`,
+and exit with a non-zero exit code.
+
+The --schema flag provides JSON Schemas that are used to type check references to
+the input and data documents. If the flag refers to a file, the file contains the
+schema for the input document. If the flag refers to a directory, the file
+'input.json' contains the schema for the input document and other files contain
+schemas for the data document at the file's path, e.g., 'servers.json' describes
+data.servers.
+
+The --strict flag enables additional checks that report unused imports, unused
+function arguments, unused local variables, variables shadowing imports, input or
+data, rules named input or data, and calls to deprecated built-in functions.`,
 
 	PreRunE: func(Cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
@@ -66,7 +79,18 @@ func checkModules(args []string) int {
 		modules[m.Name] = m.Parsed
 	}
 
-	compiler := ast.NewCompiler().SetErrorLimit(checkParams.errLimit)
+	compiler := ast.NewCompiler().
+		SetErrorLimit(checkParams.errLimit).
+		WithStrict(checkParams.strict)
+
+	if checkParams.schema != "" {
+		schemas, err := loader.Schemas(checkParams.schema)
+		if err != nil {
+			outputErrors(err)
+			return 1
+		}
+		compiler.WithSchemas(schemas)
+	}
 
 	compiler.Compile(modules)
 
@@ -99,5 +123,7 @@ func outputErrors(err error) {
 func init() {
 	setMaxErrors(checkCommand.Flags(), &checkParams.errLimit)
 	checkCommand.Flags().VarP(checkParams.format, "format", "f", "set output format")
+	checkCommand.Flags().BoolVarP(&checkParams.strict, "strict", "S", false, "enable compiler strict mode")
+	checkCommand.Flags().StringVarP(&checkParams.schema, "schema", "s", "", "set path of JSON Schema file or directory used to type check input and data")
 	RootCommand.AddCommand(checkCommand)
 }
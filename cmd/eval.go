@@ -9,13 +9,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
 
+	"github.com/olekukonko/tablewriter"
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/filter"
 	"github.com/open-policy-agent/opa/loader"
 	"github.com/open-policy-agent/opa/metrics"
+	"github.com/open-policy-agent/opa/profiler"
 	"github.com/open-policy-agent/opa/rego"
 	"github.com/open-policy-agent/opa/storage/inmem"
 	"github.com/open-policy-agent/opa/topdown"
@@ -25,13 +30,25 @@ import (
 )
 
 type evalCommandParams struct {
-	dataPath  string
-	inputPath string
-	imports   repeatedStringFlag
-	pkg       string
-	stdin     bool
-	explain   *util.EnumFlag
-	metrics   bool
+	dataPath        string
+	inputPath       string
+	imports         repeatedStringFlag
+	pkg             string
+	stdin           bool
+	explain         *util.EnumFlag
+	metrics         bool
+	profile         bool
+	profileLimit    int
+	partial         bool
+	unknowns        repeatedStringFlag
+	disableInlining repeatedStringFlag
+	shallowInlining bool
+	copyPropagation bool
+	outputFormat    *util.EnumFlag
+	fail            bool
+	failDefined     bool
+	translate       *util.EnumFlag
+	mappingPath     string
 }
 
 const (
@@ -39,17 +56,43 @@ const (
 	explainModeFull = "full"
 )
 
+const (
+	evalJSONOutput     = "json"
+	evalValuesOutput   = "values"
+	evalBindingsOutput = "bindings"
+	evalPrettyOutput   = "pretty"
+	evalRawOutput      = "raw"
+)
+
 type evalResult struct {
 	Result      rego.ResultSet         `json:"result,omitempty"`
+	Partial     *rego.PartialQueries   `json:"partial,omitempty"`
+	Filter      *filter.Result         `json:"filter,omitempty"`
 	Explanation []string               `json:"explanation,omitempty"`
 	Metrics     map[string]interface{} `json:"metrics,omitempty"`
+	Profile     []profiler.ExprStats   `json:"profile,omitempty"`
 }
 
-func init() {
+func newEvalCommandParams() evalCommandParams {
 
 	var params evalCommandParams
 
 	params.explain = util.NewEnumFlag(explainModeOff, []string{explainModeFull})
+	params.outputFormat = util.NewEnumFlag(evalJSONOutput, []string{
+		evalJSONOutput,
+		evalValuesOutput,
+		evalBindingsOutput,
+		evalPrettyOutput,
+		evalRawOutput,
+	})
+	params.translate = util.NewEnumFlag("", filter.Targets)
+
+	return params
+}
+
+func init() {
+
+	params := newEvalCommandParams()
 
 	evalCommand := &cobra.Command{
 		Use:   "eval <query>",
@@ -81,7 +124,53 @@ Where /some/path contains:
 
 The JSON file 'foo/bar/data.json' would be loaded and rooted under
 'data.foo.bar' and the 'foo/baz.rego' would be loaded and rooted under the
-package path contained inside the file.`,
+package path contained inside the file.
+
+To partially evaluate a query with respect to the input document:
+
+	$ opa eval --data policy.rego --partial 'data.example.allow = true'
+
+The --unknowns flag sets the references to treat as unknown during partial
+evaluation (default: input). The --disable-inlining flag sets the paths of
+virtual documents that are output as support rules instead of being inlined
+into the partially evaluated queries. The --shallow-inlining flag outputs support
+rules for all virtual documents that depend on unknowns. The --copy-propagation
+flag removes redundant variables, expressions and queries from the output.
+
+To translate the partially evaluated queries into a SQL WHERE clause or an
+Elasticsearch query:
+
+	$ opa eval --data policy.rego --partial --unknowns data.posts \
+		--translate sql --mapping mapping.json 'data.example.allow = true'
+
+The --mapping file declares the tables that the unknown collections are stored
+in, e.g., {"data.posts": {"name": "posts"}}.
+
+The --format flag controls the output:
+
+	json:     the result set, explanation and metrics as JSON (default)
+	values:   the expression values of each result as JSON
+	bindings: the variable bindings of each result as JSON
+	pretty:   the results as a table (like the REPL)
+	raw:      the expression values of each result, one per line, with strings
+	          printed without quotes
+
+Partially evaluated queries are printed as JSON unless the pretty format is
+selected.
+
+To find the expressions where most of the evaluation time is spent:
+
+	$ opa eval --profile --format pretty --data policy.rego 'data.example.allow'
+
+The --profile flag reports the total time, number of evaluations and number of
+re-evaluations (i.e., backtracking) of each expression, sorted by time. The
+--profile-limit flag sets the number of expressions to report (default: 10).
+
+The --fail flag exits with a non-zero status if the result is undefined (or the
+partially evaluated query set is empty.) The --fail-defined flag exits with a
+non-zero status if the result is defined:
+
+	$ opa eval --fail --data policy.rego --input input.json 'data.example.allow = true'`,
 
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) > 0 && params.stdin {
@@ -90,14 +179,22 @@ package path contained inside the file.`,
 				return errors.New("specify query argument or --stdin")
 			} else if len(args) > 1 {
 				return errors.New("specify at most one query argument")
+			} else if params.translate.String() != "" && !params.partial {
+				return errors.New("specify --partial with --translate")
+			} else if params.fail && params.failDefined {
+				return errors.New("specify --fail or --fail-defined but not both")
 			}
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := eval(args, params); err != nil {
+			defined, err := eval(args, params, os.Stdout)
+			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
 				os.Exit(1)
 			}
+			if evalFailed(params, defined) {
+				os.Exit(1)
+			}
 		},
 	}
 
@@ -107,19 +204,33 @@ package path contained inside the file.`,
 	evalCommand.Flags().StringVarP(&params.pkg, "package", "", "", "set query package")
 	evalCommand.Flags().BoolVarP(&params.stdin, "stdin", "", false, "read query from stdin")
 	evalCommand.Flags().BoolVarP(&params.metrics, "metrics", "", false, "report query performance metrics")
+	evalCommand.Flags().BoolVarP(&params.profile, "profile", "", false, "report expression evaluation profile")
+	evalCommand.Flags().IntVarP(&params.profileLimit, "profile-limit", "", 10, "set number of expressions to report in profile")
 	evalCommand.Flags().VarP(params.explain, "explain", "", "enable query explainations")
+	evalCommand.Flags().BoolVarP(&params.partial, "partial", "p", false, "perform partial evaluation")
+	evalCommand.Flags().VarP(&params.unknowns, "unknowns", "u", "set paths to treat as unknown during partial evaluation")
+	evalCommand.Flags().VarP(&params.disableInlining, "disable-inlining", "", "set paths of documents to exclude from inlining")
+	evalCommand.Flags().BoolVarP(&params.shallowInlining, "shallow-inlining", "", false, "disable inlining of rules that depend on unknowns")
+	evalCommand.Flags().BoolVarP(&params.copyPropagation, "copy-propagation", "", false, "simplify partially evaluated queries with copy propagation")
+	evalCommand.Flags().VarP(params.outputFormat, "format", "f", "set output format")
+	evalCommand.Flags().BoolVarP(&params.fail, "fail", "", false, "exits with non-zero exit code on undefined result")
+	evalCommand.Flags().BoolVarP(&params.failDefined, "fail-defined", "", false, "exits with non-zero exit code on defined result")
+	evalCommand.Flags().VarP(params.translate, "translate", "", "translate partially evaluated queries into filter")
+	evalCommand.Flags().StringVarP(&params.mappingPath, "mapping", "", "", "set path of mapping file used for translation")
 
 	RootCommand.AddCommand(evalCommand)
 }
 
-func eval(args []string, params evalCommandParams) (err error) {
+// eval evaluates the query and writes the result to w. The return value
+// indicates whether the result is defined.
+func eval(args []string, params evalCommandParams, w io.Writer) (defined bool, err error) {
 
 	var query string
 
 	if params.stdin {
 		bs, err := ioutil.ReadAll(os.Stdin)
 		if err != nil {
-			return err
+			return false, err
 		}
 		query = string(bs)
 	} else {
@@ -139,7 +250,7 @@ func eval(args []string, params evalCommandParams) (err error) {
 	if params.dataPath != "" {
 		loadResult, err := loader.All([]string{params.dataPath})
 		if err != nil {
-			return err
+			return false, err
 		}
 		regoArgs = append(regoArgs, rego.Store(inmem.NewFromObject(loadResult.Documents)))
 		for _, file := range loadResult.Modules {
@@ -150,11 +261,11 @@ func eval(args []string, params evalCommandParams) (err error) {
 	if params.inputPath != "" {
 		bs, err := ioutil.ReadFile(params.inputPath)
 		if err != nil {
-			return err
+			return false, err
 		}
 		term, err := ast.ParseTerm(string(bs))
 		if err != nil {
-			return err
+			return false, err
 		}
 		regoArgs = append(regoArgs, rego.ParsedInput(term.Value))
 	}
@@ -167,6 +278,13 @@ func eval(args []string, params evalCommandParams) (err error) {
 		regoArgs = append(regoArgs, rego.Tracer(tracer))
 	}
 
+	var prof *profiler.Profiler
+
+	if params.profile {
+		prof = profiler.New()
+		regoArgs = append(regoArgs, rego.Tracer(prof))
+	}
+
 	var m metrics.Metrics
 
 	if params.metrics {
@@ -174,16 +292,48 @@ func eval(args []string, params evalCommandParams) (err error) {
 		regoArgs = append(regoArgs, rego.Metrics(m))
 	}
 
+	if params.partial {
+		unknowns := params.unknowns.v
+		if len(unknowns) == 0 {
+			unknowns = []string{"input"}
+		}
+		regoArgs = append(regoArgs, rego.Unknowns(unknowns))
+		if len(params.disableInlining.v) > 0 {
+			regoArgs = append(regoArgs, rego.DisableInlining(params.disableInlining.v))
+		}
+		regoArgs = append(regoArgs, rego.ShallowInlining(params.shallowInlining), rego.CopyPropagation(params.copyPropagation))
+	}
+
 	eval := rego.New(regoArgs...)
 	ctx := context.Background()
 
-	rs, err := eval.Eval(ctx)
+	var result evalResult
+
+	if params.partial {
+		result.Partial, err = eval.Partial(ctx)
+	} else {
+		result.Result, err = eval.Eval(ctx)
+	}
+
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	result := evalResult{
-		Result: rs,
+	if target := params.translate.String(); target != "" {
+		var mapping filter.Mapping
+		if params.mappingPath != "" {
+			bs, err := ioutil.ReadFile(params.mappingPath)
+			if err != nil {
+				return false, err
+			}
+			if err := util.Unmarshal(bs, &mapping); err != nil {
+				return false, err
+			}
+		}
+		result.Filter, err = filter.TranslateTarget(target, result.Partial, mapping)
+		if err != nil {
+			return false, err
+		}
 	}
 
 	if params.explain.String() != explainModeOff {
@@ -196,12 +346,258 @@ func eval(args []string, params evalCommandParams) (err error) {
 		result.Metrics = m.All()
 	}
 
-	bs, err := json.MarshalIndent(result, "", "  ")
+	if params.profile {
+		result.Profile = prof.ReportTopN(params.profileLimit)
+	}
+
+	if result.Partial != nil {
+		defined = len(result.Partial.Queries) > 0
+	} else {
+		defined = len(result.Result) > 0
+	}
+
+	switch params.outputFormat.String() {
+	case evalValuesOutput:
+		err = printEvalValues(w, result)
+	case evalBindingsOutput:
+		err = printEvalBindings(w, result)
+	case evalPrettyOutput:
+		err = printEvalPretty(w, result)
+	case evalRawOutput:
+		err = printEvalRaw(w, result)
+	default:
+		err = printEvalJSON(w, result)
+	}
+
+	return defined, err
+}
+
+// evalFailed returns true if the command should exit with a non-zero status
+// given whether the result is defined.
+func evalFailed(params evalCommandParams, defined bool) bool {
+	return (params.fail && !defined) || (params.failDefined && defined)
+}
+
+func printEvalJSON(w io.Writer, x interface{}) error {
+	bs, err := json.MarshalIndent(x, "", "  ")
 	if err != nil {
 		return err
 	}
+	fmt.Fprintln(w, string(bs))
+	return nil
+}
+
+// printEvalValues prints the expression values of each result. Partially
+// evaluated queries are printed in the JSON format.
+func printEvalValues(w io.Writer, result evalResult) error {
+
+	if result.Partial != nil {
+		return printEvalJSON(w, result)
+	}
+
+	values := make([][]interface{}, len(result.Result))
+
+	for i := range result.Result {
+		values[i] = make([]interface{}, len(result.Result[i].Expressions))
+		for j, expr := range result.Result[i].Expressions {
+			values[i][j] = expr.Value
+		}
+	}
+
+	return printEvalJSON(w, values)
+}
+
+// printEvalBindings prints the variable bindings of each result. Partially
+// evaluated queries are printed in the JSON format.
+func printEvalBindings(w io.Writer, result evalResult) error {
+
+	if result.Partial != nil {
+		return printEvalJSON(w, result)
+	}
+
+	bindings := make([]rego.Vars, len(result.Result))
+
+	for i := range result.Result {
+		bindings[i] = result.Result[i].Bindings
+	}
+
+	return printEvalJSON(w, bindings)
+}
+
+// printEvalRaw prints the expression values of each result on separate lines.
+// Strings are printed without quotes so that the output can be consumed by
+// other programs. Partially evaluated queries are printed in the JSON format.
+func printEvalRaw(w io.Writer, result evalResult) error {
+
+	if result.Partial != nil {
+		return printEvalJSON(w, result)
+	}
+
+	for _, r := range result.Result {
+		for _, expr := range r.Expressions {
+			if s, ok := expr.Value.(string); ok {
+				fmt.Fprintln(w, s)
+				continue
+			}
+			bs, err := json.Marshal(expr.Value)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(w, string(bs))
+		}
+	}
+
+	return nil
+}
+
+func printEvalPretty(w io.Writer, result evalResult) error {
+
+	for _, line := range result.Explanation {
+		fmt.Fprintln(w, line)
+	}
+
+	if result.Filter != nil {
+		if err := printEvalFilter(w, result.Filter); err != nil {
+			return err
+		}
+	} else if result.Partial != nil {
+		printEvalPartial(w, result.Partial)
+	} else if err := printEvalResultSet(w, result.Result); err != nil {
+		return err
+	}
+
+	if result.Metrics != nil {
+		if err := printEvalJSON(w, result.Metrics); err != nil {
+			return err
+		}
+	}
+
+	if result.Profile != nil {
+		profiler.PrettyPrint(w, result.Profile)
+	}
+
+	return nil
+}
+
+func printEvalPartial(w io.Writer, pq *rego.PartialQueries) {
+
+	if len(pq.Queries) == 0 {
+		fmt.Fprintln(w, "undefined")
+	}
+
+	for i := range pq.Queries {
+		fmt.Fprintln(w, renameWildcards(pq.Queries[i]))
+	}
+
+	for i := range pq.Support {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "# support module %d\n", i+1)
+		fmt.Fprintln(w, pq.Support[i])
+	}
+}
+
+// renameWildcards returns a copy of query where wildcard vars are replaced by
+// unique vars, e.g., $_term1 becomes _term1. Wildcards are printed as "_" so
+// otherwise the vars generated during evaluation could not be told apart.
+func renameWildcards(query ast.Body) ast.Body {
+
+	vars := query.Vars(ast.VarVisitorParams{})
+	names := map[ast.Var]ast.Var{}
+
+	result, _ := ast.TransformVars(query.Copy(), func(v ast.Var) (ast.Value, error) {
+		if !v.IsWildcard() {
+			return v, nil
+		}
+		name, ok := names[v]
+		if !ok {
+			prefix := "_" + strings.TrimLeft(string(v)[len(ast.WildcardPrefix):], "_")
+			name = ast.Var(prefix)
+			for i := 1; vars.Contains(name); i++ {
+				name = ast.Var(fmt.Sprintf("%v_%d", prefix, i))
+			}
+			vars.Add(name)
+			names[v] = name
+		}
+		return name, nil
+	})
+
+	return result.(ast.Body)
+}
+
+func printEvalFilter(w io.Writer, result *filter.Result) error {
+
+	if result.SQL != nil {
+		fmt.Fprintln(w, "WHERE", result.SQL.Where)
+		if len(result.SQL.Args) > 0 {
+			return printEvalJSON(w, result.SQL.Args)
+		}
+		return nil
+	}
+
+	return printEvalJSON(w, result.Elasticsearch)
+}
+
+// printEvalResultSet prints the result set in the same form as the REPL. Each
+// row contains the variable bindings and the values of non-boolean expressions.
+func printEvalResultSet(w io.Writer, rs rego.ResultSet) error {
+
+	if len(rs) == 0 {
+		fmt.Fprintln(w, "undefined")
+		return nil
+	}
+
+	if len(rs) == 1 && len(rs[0].Bindings) == 0 && len(rs[0].Expressions) == 1 {
+		return printEvalJSON(w, rs[0].Expressions[0].Value)
+	}
+
+	var vars []string
+
+	for k := range rs[0].Bindings {
+		vars = append(vars, k)
+	}
+
+	sort.Strings(vars)
+
+	var exprs []int
+
+	for i, expr := range rs[0].Expressions {
+		if _, ok := expr.Value.(bool); !ok {
+			exprs = append(exprs, i)
+		}
+	}
+
+	header := make([]string, 0, len(vars)+len(exprs))
+	header = append(header, vars...)
+
+	for _, i := range exprs {
+		header = append(header, rs[0].Expressions[i].Text)
+	}
+
+	table := tablewriter.NewWriter(w)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeader(header)
+
+	for _, result := range rs {
+		row := make([]string, 0, len(header))
+		for _, v := range vars {
+			bs, err := json.Marshal(result.Bindings[v])
+			if err != nil {
+				return err
+			}
+			row = append(row, string(bs))
+		}
+		for _, i := range exprs {
+			bs, err := json.Marshal(result.Expressions[i].Value)
+			if err != nil {
+				return err
+			}
+			row = append(row, string(bs))
+		}
+		table.Append(row)
+	}
 
-	fmt.Println(string(bs))
+	table.Render()
 	return nil
 }
 
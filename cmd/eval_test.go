@@ -0,0 +1,134 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/util/test"
+)
+
+func TestEvalFormats(t *testing.T) {
+
+	files := map[string]string{
+		"test.rego": `package test
+
+p = "hello" { true }
+q[x] { a = [1, 2]; x = a[_] }`,
+	}
+
+	tests := []struct {
+		note     string
+		format   string
+		query    string
+		expected string
+	}{
+		{"values", evalValuesOutput, `data.test.p`, "[\n  [\n    \"hello\"\n  ]\n]\n"},
+		{"values: multiple", evalValuesOutput, `data.test.q[x]; x > 1`, "[\n  [\n    2,\n    true\n  ]\n]\n"},
+		{"values: undefined", evalValuesOutput, `data.test.r`, "[]\n"},
+		{"bindings", evalBindingsOutput, `data.test.q[x]`, "[\n  {\n    \"x\": 1\n  },\n  {\n    \"x\": 2\n  }\n]\n"},
+		{"bindings: undefined", evalBindingsOutput, `data.test.r = x`, "[]\n"},
+		{"raw", evalRawOutput, `data.test.p`, "hello\n"},
+		{"raw: multiple", evalRawOutput, `data.test.q[_]`, "1\n2\n"},
+		{"raw: non-string", evalRawOutput, `{"a": data.test.p}`, "{\"a\":\"hello\"}\n"},
+		{"raw: undefined", evalRawOutput, `data.test.r`, ""},
+	}
+
+	test.WithTempFS(files, func(path string) {
+		for _, tc := range tests {
+			t.Run(tc.note, func(t *testing.T) {
+				params := newEvalCommandParams()
+				params.dataPath = filepath.Join(path, "test.rego")
+				if err := params.outputFormat.Set(tc.format); err != nil {
+					t.Fatal(err)
+				}
+
+				var buf bytes.Buffer
+
+				if _, err := eval([]string{tc.query}, params, &buf); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				if buf.String() != tc.expected {
+					t.Fatalf("Expected:\n%q\n\nGot:\n%q", tc.expected, buf.String())
+				}
+			})
+		}
+	})
+}
+
+func TestEvalFail(t *testing.T) {
+
+	tests := []struct {
+		note        string
+		query       string
+		partial     bool
+		fail        bool
+		failDefined bool
+		defined     bool
+		failed      bool
+	}{
+		{"defined", `x = 1`, false, false, false, true, false},
+		{"undefined", `1 = 2`, false, false, false, false, false},
+		{"fail: defined", `x = 1`, false, true, false, true, false},
+		{"fail: undefined", `1 = 2`, false, true, false, false, true},
+		{"fail-defined: defined", `x = 1`, false, false, true, true, true},
+		{"fail-defined: undefined", `1 = 2`, false, false, true, false, false},
+		{"partial: defined", `input.x = 1`, true, true, false, true, false},
+		{"partial: undefined", `input.x = 1; 1 = 2`, true, true, false, false, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			params := newEvalCommandParams()
+			params.partial = tc.partial
+			params.fail = tc.fail
+			params.failDefined = tc.failDefined
+
+			var buf bytes.Buffer
+
+			defined, err := eval([]string{tc.query}, params, &buf)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if defined != tc.defined {
+				t.Fatalf("Expected defined to be %v but got %v", tc.defined, defined)
+			}
+
+			if evalFailed(params, defined) != tc.failed {
+				t.Fatalf("Expected failed to be %v but got %v", tc.failed, !tc.failed)
+			}
+		})
+	}
+}
+
+func TestRenameWildcards(t *testing.T) {
+
+	query := ast.NewBody(
+		ast.Equality.Expr(ast.VarTerm("$_term1"), ast.VarTerm("_term1")),
+		ast.Equality.Expr(ast.RefTerm(ast.VarTerm("input"), ast.VarTerm("$0")), ast.VarTerm("$_term1")),
+		ast.NotEqual.Expr(ast.VarTerm("$1"), ast.BooleanTerm(false)),
+	)
+
+	expected := `_term1_1 = _term1; input[_0] = _term1_1; neq(_1, false)`
+
+	result := renameWildcards(query)
+
+	if result.String() != expected {
+		t.Fatalf("Expected %v but got: %v", expected, result)
+	}
+
+	if query.String() != `_ = _term1; input[_] = _; neq(_, false)` {
+		t.Fatalf("Expected query to be unchanged but got: %v", query)
+	}
+
+	if _, err := ast.ParseBody(result.String()); err != nil {
+		t.Fatalf("Unexpected error parsing result: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package filter
+
+import "fmt"
+
+var elasticsearchRangeOps = map[string]string{
+	"<":  "lt",
+	"<=": "lte",
+	">":  "gt",
+	">=": "gte",
+}
+
+// Elasticsearch returns an Elasticsearch bool query for the condition. Columns
+// are used as field names. Comparisons between columns cannot be expressed
+// and are reported as errors.
+func Elasticsearch(cond Condition) (map[string]interface{}, error) {
+	switch c := cond.(type) {
+	case And:
+		filters, err := elasticsearchList(c)
+		if err != nil {
+			return nil, err
+		}
+		return elasticsearchBool("filter", filters), nil
+	case Or:
+		should, err := elasticsearchList(c)
+		if err != nil {
+			return nil, err
+		}
+		result := elasticsearchBool("should", should)
+		result["bool"].(map[string]interface{})["minimum_should_match"] = 1
+		return result, nil
+	case Not:
+		query, err := Elasticsearch(c.Condition)
+		if err != nil {
+			return nil, err
+		}
+		return elasticsearchBool("must_not", []interface{}{query}), nil
+	case Bool:
+		if c {
+			return map[string]interface{}{"match_all": map[string]interface{}{}}, nil
+		}
+		return map[string]interface{}{"match_none": map[string]interface{}{}}, nil
+	case Compare:
+		if col, ok := c.Value.(Column); ok {
+			return nil, unsupportedErr(c.Location, "comparison of %v and %v not supported", c.Column, col)
+		}
+		if c.Value == nil {
+			exists := map[string]interface{}{
+				"exists": map[string]interface{}{"field": c.Column.Name},
+			}
+			switch c.Op {
+			case "=":
+				return elasticsearchBool("must_not", []interface{}{exists}), nil
+			case "!=":
+				return exists, nil
+			}
+			return nil, unsupportedErr(c.Location, "comparison of %v with null not supported", c.Column)
+		}
+		switch c.Op {
+		case "=":
+			return elasticsearchTerm(c.Column, c.Value), nil
+		case "!=":
+			return elasticsearchBool("must_not", []interface{}{elasticsearchTerm(c.Column, c.Value)}), nil
+		}
+		return map[string]interface{}{
+			"range": map[string]interface{}{
+				c.Column.Name: map[string]interface{}{
+					elasticsearchRangeOps[c.Op]: c.Value,
+				},
+			},
+		}, nil
+	case In:
+		return map[string]interface{}{
+			"terms": map[string]interface{}{
+				c.Column.Name: c.Values,
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("condition %T not supported", cond)
+}
+
+func elasticsearchList(conds []Condition) ([]interface{}, error) {
+	result := make([]interface{}, len(conds))
+	for i := range conds {
+		query, err := Elasticsearch(conds[i])
+		if err != nil {
+			return nil, err
+		}
+		result[i] = query
+	}
+	return result, nil
+}
+
+func elasticsearchBool(occur string, queries []interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			occur: queries,
+		},
+	}
+}
+
+func elasticsearchTerm(col Column, value interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"term": map[string]interface{}{
+			col.Name: value,
+		},
+	}
+}
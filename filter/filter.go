@@ -0,0 +1,749 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package filter translates the results of partial evaluation into data
+// filters, e.g., SQL WHERE clauses or Elasticsearch queries.
+//
+// The unknowns used during partial evaluation refer to collections of rows,
+// e.g., data.posts. References into the collections that are indexed by a
+// variable and a key (e.g., data.posts[x].owner) refer to columns. The Mapping
+// declares the table that each collection is stored in.
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// Mapping maps references to collections (e.g., "data.posts") onto tables.
+type Mapping map[string]Table
+
+// Table describes the table that a collection is stored in. Keys in the
+// collection that are not listed in Columns are used as the column names. The
+// table and column names must be plain identifiers (the table name may be
+// qualified with a schema, e.g., "public.posts".)
+type Table struct {
+	Name    string            `json:"name"`
+	Columns map[string]string `json:"columns,omitempty"`
+}
+
+// Error is returned when the partially evaluated queries contain constructs
+// that cannot be translated.
+type Error struct {
+	Message  string        `json:"message"`
+	Location *ast.Location `json:"location,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Location != nil {
+		return e.Location.String() + ": " + e.Message
+	}
+	return e.Message
+}
+
+func unsupportedErr(loc *ast.Location, f string, a ...interface{}) error {
+	return &Error{
+		Message:  fmt.Sprintf(f, a...),
+		Location: loc,
+	}
+}
+
+// Condition is a node in the filter produced by Translate.
+type Condition interface {
+	condition()
+}
+
+type (
+	// And is satisfied if all of the conditions are satisfied.
+	And []Condition
+
+	// Or is satisfied if any of the conditions are satisfied.
+	Or []Condition
+
+	// Not is satisfied if the condition is not satisfied.
+	Not struct {
+		Condition Condition
+	}
+
+	// Compare is satisfied if the column compares to the value with the
+	// operator. The operator is one of =, !=, <, <=, > or >=. The value is
+	// either a Column or a scalar (nil, bool, int64, float64 or string.) The
+	// location refers to the expression that the comparison was translated
+	// from.
+	Compare struct {
+		Op       string
+		Column   Column
+		Value    interface{}
+		Location *ast.Location
+	}
+
+	// In is satisfied if the column is equal to one of the scalar values.
+	In struct {
+		Column Column
+		Values []interface{}
+	}
+
+	// Bool is a constant condition.
+	Bool bool
+
+	// Column identifies a column of a table.
+	Column struct {
+		Table string
+		Name  string
+	}
+)
+
+func (And) condition()     {}
+func (Or) condition()      {}
+func (Not) condition()     {}
+func (Compare) condition() {}
+func (In) condition()      {}
+func (Bool) condition()    {}
+
+func (c Column) String() string {
+	return c.Table + "." + c.Name
+}
+
+var compareOps = map[string]string{
+	ast.Equality.Name:      "=",
+	ast.Equal.Name:         "=",
+	ast.NotEqual.Name:      "!=",
+	ast.LessThan.Name:      "<",
+	ast.LessThanEq.Name:    "<=",
+	ast.GreaterThan.Name:   ">",
+	ast.GreaterThanEq.Name: ">=",
+}
+
+var flippedOps = map[string]string{
+	"=":  "=",
+	"!=": "!=",
+	"<":  ">",
+	"<=": ">=",
+	">":  "<",
+	">=": "<=",
+}
+
+// Translate converts the partially evaluated queries into a condition. The
+// queries are combined with OR and the expressions in each query are combined
+// with AND. Support rules generated for negated expressions are expanded into
+// the condition.
+func Translate(pq *rego.PartialQueries, mapping Mapping) (Condition, error) {
+
+	t, err := newTranslator(pq.Support, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(Or, 0, len(pq.Queries))
+
+	for _, query := range pq.Queries {
+		t.rows = map[string]ast.Var{}
+		cond, err := t.translateBody(query, nil)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, cond)
+	}
+
+	return simplify(result), nil
+}
+
+// Supported translation targets.
+const (
+	TargetSQL           = "sql"
+	TargetElasticsearch = "elasticsearch"
+)
+
+// Targets lists the supported translation targets.
+var Targets = []string{TargetSQL, TargetElasticsearch}
+
+// Result contains the translation of partially evaluated queries for one of
+// the targets.
+type Result struct {
+	SQL           *SQLResult             `json:"sql,omitempty"`
+	Elasticsearch map[string]interface{} `json:"elasticsearch,omitempty"`
+}
+
+// SQLResult contains a parameterized SQL WHERE clause and the arguments for
+// the placeholders.
+type SQLResult struct {
+	Where string        `json:"where"`
+	Args  []interface{} `json:"args,omitempty"`
+}
+
+// TranslateTarget translates the partially evaluated queries into a filter
+// for the target.
+func TranslateTarget(target string, pq *rego.PartialQueries, mapping Mapping) (*Result, error) {
+
+	cond, err := Translate(pq, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	switch target {
+	case TargetSQL:
+		where, args := SQL(cond)
+		return &Result{SQL: &SQLResult{Where: where, Args: args}}, nil
+	case TargetElasticsearch:
+		query, err := Elasticsearch(cond)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Elasticsearch: query}, nil
+	}
+
+	return nil, fmt.Errorf("unknown target %q (must be one of %v)", target, Targets)
+}
+
+type mappedRef struct {
+	ref   ast.Ref
+	table Table
+}
+
+type translator struct {
+	tables  []mappedRef
+	support map[string][]*ast.Rule
+	rows    map[string]ast.Var
+}
+
+func newTranslator(support []*ast.Module, mapping Mapping) (*translator, error) {
+
+	t := &translator{
+		support: map[string][]*ast.Rule{},
+	}
+
+	keys := make([]string, 0, len(mapping))
+	for k := range mapping {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		ref, err := ast.ParseRef(k)
+		if err != nil {
+			return nil, fmt.Errorf("bad mapping %q: %v", k, err)
+		}
+		t.tables = append(t.tables, mappedRef{ref, mapping[k]})
+	}
+
+	for _, module := range support {
+		for _, rule := range module.Rules {
+			path := module.Package.Path.Append(ast.StringTerm(string(rule.Head.Name))).String()
+			t.support[path] = append(t.support[path], rule)
+		}
+	}
+
+	return t, nil
+}
+
+// scope holds the variable bindings for a query. Residual queries contain
+// equalities that bind variables to references and values (e.g., __local0__ =
+// data.posts[x]) and the bindings are substituted into the other expressions.
+type scope struct {
+	bindings map[ast.Var]*ast.Term
+}
+
+func newScope() *scope {
+	return &scope{bindings: map[ast.Var]*ast.Term{}}
+}
+
+func (t *translator) translateBody(body ast.Body, params []*ast.Expr) (Condition, error) {
+
+	sc := newScope()
+	var deferred []*ast.Expr
+
+	for _, expr := range append(params, body...) {
+		if !sc.bind(expr) {
+			deferred = append(deferred, expr)
+		}
+	}
+
+	result := make(And, 0, len(deferred))
+
+	for _, expr := range deferred {
+		cond, err := t.translateExpr(sc, expr)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, cond)
+	}
+
+	return simplify(result), nil
+}
+
+// bind records the binding if expr is an equality with an unbound variable on
+// either side.
+func (sc *scope) bind(expr *ast.Expr) bool {
+
+	if expr.Negated || len(expr.With) > 0 || !expr.IsEquality() {
+		return false
+	}
+
+	a, b := sc.resolve(expr.Operand(0)), sc.resolve(expr.Operand(1))
+
+	if v, ok := a.Value.(ast.Var); ok {
+		if !v.Equal(b.Value) {
+			sc.bindings[v] = b
+		}
+		return true
+	}
+
+	if v, ok := b.Value.(ast.Var); ok {
+		sc.bindings[v] = a
+		return true
+	}
+
+	return false
+}
+
+// resolve substitutes the bindings into the term. References with variable
+// heads bound to references are concatenated, e.g., __local0__.owner becomes
+// data.posts[x].owner.
+func (sc *scope) resolve(term *ast.Term) *ast.Term {
+	return sc.resolveDepth(term, len(sc.bindings))
+}
+
+// resolveDepth substitutes at most depth bindings along any path so that
+// self-referential bindings (e.g., x = x.y) terminate.
+func (sc *scope) resolveDepth(term *ast.Term, depth int) *ast.Term {
+
+	switch v := term.Value.(type) {
+	case ast.Var:
+		if b, ok := sc.bindings[v]; ok && depth > 0 {
+			return sc.resolveDepth(b, depth-1)
+		}
+	case ast.Ref:
+		head := sc.resolveDepth(v[0], depth)
+		var ref ast.Ref
+		if r, ok := head.Value.(ast.Ref); ok {
+			ref = r.Copy()
+		} else {
+			ref = ast.Ref{head}
+		}
+		for _, x := range v[1:] {
+			ref = append(ref, sc.resolveDepth(x, depth))
+		}
+		cpy := *term
+		cpy.Value = ref
+		return &cpy
+	}
+
+	return term
+}
+
+func (t *translator) translateExpr(sc *scope, expr *ast.Expr) (Condition, error) {
+
+	if len(expr.With) > 0 {
+		return nil, unsupportedErr(expr.Location, "with keyword not supported")
+	}
+
+	if expr.Negated {
+		cpy := expr.Complement()
+		cond, err := t.translateExpr(sc, cpy)
+		if err != nil {
+			return nil, err
+		}
+		return simplify(Not{cond}), nil
+	}
+
+	switch terms := expr.Terms.(type) {
+	case *ast.Term:
+		return t.translateTerm(sc, expr, sc.resolve(terms))
+	case []*ast.Term:
+		name := terms[0].String()
+		if rules, ok := t.support[name]; ok {
+			return t.translateSupport(sc, expr, rules, terms[1:])
+		}
+		op, ok := compareOps[name]
+		if !ok {
+			return nil, unsupportedErr(expr.Location, "function %v not supported", name)
+		}
+		if len(terms) != 3 {
+			return nil, unsupportedErr(expr.Location, "function %v output not supported", name)
+		}
+		return t.translateCompare(sc, expr, op, sc.resolve(terms[1]), sc.resolve(terms[2]))
+	}
+
+	return nil, unsupportedErr(expr.Location, "expression not supported")
+}
+
+func (t *translator) translateTerm(sc *scope, expr *ast.Expr, term *ast.Term) (Condition, error) {
+
+	if ref, ok := term.Value.(ast.Ref); ok {
+		if rules, ok := t.support[ref.String()]; ok {
+			return t.translateSupport(sc, expr, rules, nil)
+		}
+	}
+
+	col, row, err := t.column(expr, term)
+	if err != nil {
+		return nil, err
+	}
+
+	if row {
+		// References to rows (e.g., data.posts[x]) are satisfied by all rows.
+		return Bool(true), nil
+	}
+
+	if col != nil {
+		return Compare{Op: "=", Column: *col, Value: true, Location: expr.Location}, nil
+	}
+
+	if !term.IsGround() {
+		return nil, unsupportedErr(expr.Location, "term %v not supported", term)
+	}
+
+	return Bool(!ast.Boolean(false).Equal(term.Value)), nil
+}
+
+// translateSupport expands the support rules referred to by the expression.
+// The arguments are bound to the rule's parameters.
+func (t *translator) translateSupport(sc *scope, expr *ast.Expr, rules []*ast.Rule, args []*ast.Term) (Condition, error) {
+
+	result := make(Or, 0, len(rules))
+
+	for _, rule := range rules {
+
+		if rule.Default || rule.Head.Key != nil || !ast.BooleanTerm(true).Equal(rule.Head.Value) {
+			return nil, unsupportedErr(expr.Location, "reference to support rule %v not supported", rule.Head.Name)
+		}
+
+		if len(rule.Head.Args) != len(args) {
+			return nil, unsupportedErr(expr.Location, "call to support rule %v not supported", rule.Head.Name)
+		}
+
+		params := make([]*ast.Expr, 0, len(args))
+		for i := range args {
+			// The root documents are passed as arguments to support rules
+			// but they are not rebound.
+			if ast.RootDocumentNames.Contains(rule.Head.Args[i]) {
+				continue
+			}
+			param := ast.Equality.Expr(rule.Head.Args[i], sc.resolve(args[i]))
+			param.Location = expr.Location
+			params = append(params, param)
+		}
+
+		cond, err := t.translateBody(rule.Body, params)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, cond)
+	}
+
+	return simplify(result), nil
+}
+
+func (t *translator) translateCompare(sc *scope, expr *ast.Expr, op string, a, b *ast.Term) (Condition, error) {
+
+	colA, rowA, err := t.column(expr, a)
+	if err != nil {
+		return nil, err
+	}
+
+	colB, rowB, err := t.column(expr, b)
+	if err != nil {
+		return nil, err
+	}
+
+	if rowA || rowB {
+		return nil, unsupportedErr(expr.Location, "comparison of rows not supported")
+	}
+
+	if colA == nil && colB != nil {
+		colA, colB, a, b = colB, colA, b, a
+		op = flippedOps[op]
+	}
+
+	if colA == nil {
+		return compareConstants(expr, op, a, b)
+	}
+
+	if colB != nil {
+		return Compare{Op: op, Column: *colA, Value: *colB, Location: expr.Location}, nil
+	}
+
+	if values, ok := collectionValues(b); ok && op == "=" {
+		result := In{Column: *colA}
+		for _, v := range values {
+			x, err := scalar(expr, v)
+			if err != nil {
+				return nil, err
+			}
+			result.Values = append(result.Values, x)
+		}
+		return simplify(result), nil
+	}
+
+	x, err := scalar(expr, b)
+	if err != nil {
+		return nil, err
+	}
+
+	return Compare{Op: op, Column: *colA, Value: x, Location: expr.Location}, nil
+}
+
+func compareConstants(expr *ast.Expr, op string, a, b *ast.Term) (Condition, error) {
+
+	if !a.IsGround() || !b.IsGround() {
+		return nil, unsupportedErr(expr.Location, "comparison of %v and %v not supported", a, b)
+	}
+
+	cmp := a.Value.Compare(b.Value)
+
+	switch op {
+	case "=":
+		return Bool(cmp == 0), nil
+	case "!=":
+		return Bool(cmp != 0), nil
+	case "<":
+		return Bool(cmp < 0), nil
+	case "<=":
+		return Bool(cmp <= 0), nil
+	case ">":
+		return Bool(cmp > 0), nil
+	default:
+		return Bool(cmp >= 0), nil
+	}
+}
+
+// column returns the column referred to by term. If term refers to a row
+// instead of a column, row is true. If term does not refer to a mapped
+// collection, the column is nil.
+func (t *translator) column(expr *ast.Expr, term *ast.Term) (col *Column, row bool, err error) {
+
+	ref, ok := term.Value.(ast.Ref)
+	if !ok {
+		return nil, false, nil
+	}
+
+	for _, m := range t.tables {
+
+		if !ref.HasPrefix(m.ref) {
+			continue
+		}
+
+		if len(ref) == len(m.ref) || len(ref) > len(m.ref)+2 {
+			return nil, false, unsupportedErr(expr.Location, "reference %v not supported (must refer to column of %v)", ref, m.ref)
+		}
+
+		v, ok := ref[len(m.ref)].Value.(ast.Var)
+		if !ok {
+			return nil, false, unsupportedErr(expr.Location, "reference %v not supported (row must be variable)", ref)
+		}
+
+		if other, ok := t.rows[m.table.Name]; ok && !other.Equal(v) {
+			return nil, false, unsupportedErr(expr.Location, "reference %v not supported (multiple rows of %v)", ref, m.ref)
+		}
+
+		t.rows[m.table.Name] = v
+
+		if len(ref) == len(m.ref)+1 {
+			return nil, true, nil
+		}
+
+		key, ok := ref[len(ref)-1].Value.(ast.String)
+		if !ok {
+			return nil, false, unsupportedErr(expr.Location, "reference %v not supported (column must be string)", ref)
+		}
+
+		name := string(key)
+		if mapped, ok := m.table.Columns[name]; ok {
+			name = mapped
+		}
+
+		if !tableNameRegexp.MatchString(m.table.Name) {
+			return nil, false, unsupportedErr(expr.Location, "table name %q not supported (must be identifier)", m.table.Name)
+		}
+
+		if !columnNameRegexp.MatchString(name) {
+			return nil, false, unsupportedErr(expr.Location, "column name %q not supported (must be identifier)", name)
+		}
+
+		return &Column{Table: m.table.Name, Name: name}, false, nil
+	}
+
+	if ref.IsGround() || ref[0].IsGround() {
+		return nil, false, nil
+	}
+
+	return nil, false, unsupportedErr(expr.Location, "reference %v not supported (not in mapping)", ref)
+}
+
+// Table and column names are written into the filters verbatim so they are
+// restricted to plain identifiers.
+var (
+	columnNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	tableNameRegexp  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+)
+
+// collectionValues returns the elements of a ground collection that is
+// iterated over by a variable, e.g., ["a", "b"][x].
+func collectionValues(term *ast.Term) ([]*ast.Term, bool) {
+
+	ref, ok := term.Value.(ast.Ref)
+	if !ok || len(ref) != 2 || !ref[0].IsGround() {
+		return nil, false
+	}
+
+	if _, ok := ref[1].Value.(ast.Var); !ok {
+		return nil, false
+	}
+
+	switch coll := ref[0].Value.(type) {
+	case ast.Array:
+		return coll, true
+	case ast.Set:
+		var result []*ast.Term
+		coll.Foreach(func(x *ast.Term) {
+			result = append(result, x)
+		})
+		return result, true
+	}
+
+	return nil, false
+}
+
+func scalar(expr *ast.Expr, term *ast.Term) (interface{}, error) {
+	switch v := term.Value.(type) {
+	case ast.Null:
+		return nil, nil
+	case ast.Boolean:
+		return bool(v), nil
+	case ast.String:
+		return string(v), nil
+	case ast.Number:
+		if i, err := json.Number(v).Int64(); err == nil {
+			return i, nil
+		}
+		if f, err := json.Number(v).Float64(); err == nil {
+			return f, nil
+		}
+	}
+	return nil, unsupportedErr(expr.Location, "value %v not supported (must be scalar)", term)
+}
+
+// simplify flattens nested conditions, removes constants and combines
+// equality comparisons on the same column into IN lists.
+func simplify(cond Condition) Condition {
+	switch c := cond.(type) {
+	case And:
+		var result And
+		for _, x := range c {
+			switch x := simplify(x).(type) {
+			case Bool:
+				if !x {
+					return Bool(false)
+				}
+			case And:
+				result = append(result, x...)
+			default:
+				result = append(result, x)
+			}
+		}
+		switch len(result) {
+		case 0:
+			return Bool(true)
+		case 1:
+			return result[0]
+		}
+		return result
+	case Or:
+		var result Or
+		for _, x := range c {
+			switch x := simplify(x).(type) {
+			case Bool:
+				if x {
+					return Bool(true)
+				}
+			case Or:
+				result = append(result, x...)
+			default:
+				result = append(result, x)
+			}
+		}
+		result = mergeIn(result)
+		switch len(result) {
+		case 0:
+			return Bool(false)
+		case 1:
+			return result[0]
+		}
+		return result
+	case Not:
+		x := simplify(c.Condition)
+		if b, ok := x.(Bool); ok {
+			return !b
+		}
+		return Not{x}
+	case In:
+		if len(c.Values) == 0 {
+			return Bool(false)
+		}
+	}
+	return cond
+}
+
+// mergeIn combines the conditions that test the same column for equality with
+// constant values into In conditions.
+func mergeIn(conds Or) Or {
+
+	result := make(Or, 0, len(conds))
+	index := map[Column]int{}
+
+	for _, cond := range conds {
+		var col Column
+		var values []interface{}
+		switch c := cond.(type) {
+		case Compare:
+			if _, ok := c.Value.(Column); ok || c.Op != "=" || c.Value == nil {
+				result = append(result, cond)
+				continue
+			}
+			col, values = c.Column, []interface{}{c.Value}
+		case In:
+			col, values = c.Column, c.Values
+		default:
+			result = append(result, cond)
+			continue
+		}
+		i, ok := index[col]
+		if !ok {
+			index[col] = len(result)
+			result = append(result, In{Column: col})
+			i = len(result) - 1
+		}
+		in := result[i].(In)
+		for _, v := range values {
+			if !containsValue(in.Values, v) {
+				in.Values = append(in.Values, v)
+			}
+		}
+		result[i] = in
+	}
+
+	for i := range result {
+		if in, ok := result[i].(In); ok && len(in.Values) == 1 {
+			result[i] = Compare{Op: "=", Column: in.Column, Value: in.Values[0]}
+		}
+	}
+
+	return result
+}
+
+func containsValue(values []interface{}, x interface{}) bool {
+	for _, v := range values {
+		if v == x {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/util"
+)
+
+func TestTranslate(t *testing.T) {
+
+	mapping := Mapping{
+		"data.posts": {Name: "posts", Columns: map[string]string{"owner": "owner_id"}},
+		"data.users": {Name: "users"},
+	}
+
+	input := map[string]interface{}{
+		"user": "bob",
+		"col":  "id = 1 OR 1=1; DROP TABLE posts; --",
+	}
+
+	tests := []struct {
+		note    string
+		rules   string
+		mapping Mapping
+		sql     string
+		args    []interface{}
+		es      string
+		err     string
+	}{
+		{
+			note:  "equality",
+			rules: `allow { data.posts[x].owner = input.user }`,
+			sql:   `posts.owner_id = ?`,
+			args:  []interface{}{"bob"},
+			es:    `{"term": {"owner_id": "bob"}}`,
+		},
+		{
+			note:  "conjunction",
+			rules: `allow { data.posts[x].public = true; data.posts[x].likes >= 10 }`,
+			sql:   `(posts.public = ? AND posts.likes >= ?)`,
+			args:  []interface{}{true, int64(10)},
+			es:    `{"bool": {"filter": [{"term": {"public": true}}, {"range": {"likes": {"gte": 10}}}]}}`,
+		},
+		{
+			note: "disjunction",
+			rules: `allow { data.posts[x].owner = input.user }
+			allow { data.posts[x].likes < 3 }`,
+			sql:  `(posts.owner_id = ? OR posts.likes < ?)`,
+			args: []interface{}{"bob", int64(3)},
+			es:   `{"bool": {"should": [{"term": {"owner_id": "bob"}}, {"range": {"likes": {"lt": 3}}}], "minimum_should_match": 1}}`,
+		},
+		{
+			note:  "in",
+			rules: `allow { cats = ["a", "b"]; data.posts[x].category = cats[_] }`,
+			sql:   `posts.category IN (?, ?)`,
+			args:  []interface{}{"a", "b"},
+			es:    `{"terms": {"category": ["a", "b"]}}`,
+		},
+		{
+			note:  "flipped",
+			rules: `allow { 7 > data.posts[x].likes }`,
+			sql:   `posts.likes < ?`,
+			args:  []interface{}{int64(7)},
+			es:    `{"range": {"likes": {"lt": 7}}}`,
+		},
+		{
+			note:  "not equal null",
+			rules: `allow { data.posts[x].owner != null }`,
+			sql:   `posts.owner_id IS NOT NULL`,
+			es:    `{"exists": {"field": "owner_id"}}`,
+		},
+		{
+			note:  "negation",
+			rules: `allow { data.posts[x].owner != null; not data.posts[x].draft }`,
+			sql:   `(posts.owner_id IS NOT NULL AND NOT (posts.draft <> ?))`,
+			args:  []interface{}{false},
+			es:    `{"bool": {"filter": [{"exists": {"field": "owner_id"}}, {"bool": {"must_not": [{"bool": {"must_not": [{"term": {"draft": false}}]}}]}}]}}`,
+		},
+		{
+			note:  "join",
+			rules: `allow { data.posts[x].owner = data.users[y].id; data.users[y].name = input.user }`,
+			sql:   `(posts.owner_id = users.id AND users.name = ?)`,
+			args:  []interface{}{"bob"},
+			err:   "test.rego:3: comparison of posts.owner_id and users.id not supported",
+		},
+		{
+			note:  "constant true",
+			rules: `allow { input.user = "bob" }`,
+			sql:   `TRUE`,
+			es:    `{"match_all": {}}`,
+		},
+		{
+			note:  "undefined",
+			rules: `allow { input.user = "alice"; data.posts[x].public = true }`,
+			sql:   `FALSE`,
+			es:    `{"match_none": {}}`,
+		},
+		{
+			note:  "unsupported function",
+			rules: `allow { startswith(data.posts[x].title, "a") }`,
+			err:   "test.rego:3: function startswith not supported",
+		},
+		{
+			note:  "unsupported reference",
+			rules: `allow { data.comments[x].public = true }`,
+			err:   "test.rego:3: reference data.comments[x1].public not supported (not in mapping)",
+		},
+		{
+			note:  "unsupported row",
+			rules: `allow { data.posts.p1.public = true }`,
+			err:   `test.rego:3: reference data.posts.p1.public not supported (row must be variable)`,
+		},
+		{
+			note:  "bad column name",
+			rules: `allow { data.posts[x][input.col] == "bob" }`,
+			err:   `test.rego:3: column name "id = 1 OR 1=1; DROP TABLE posts; --" not supported (must be identifier)`,
+		},
+		{
+			note:    "bad table name",
+			rules:   `allow { data.users[x].name == "bob" }`,
+			mapping: Mapping{"data.users": {Name: "users; DROP TABLE users"}},
+			err:     `test.rego:3: table name "users; DROP TABLE users" not supported (must be identifier)`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			module := "package test\n\n" + tc.rules
+
+			r := rego.New(
+				rego.Query("data.test.allow = true"),
+				rego.Module("test.rego", module),
+				rego.Input(input),
+				rego.Unknowns([]string{"data.posts", "data.users", "data.comments"}),
+			)
+
+			pq, err := r.Partial(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m := mapping
+			if tc.mapping != nil {
+				m = tc.mapping
+			}
+
+			cond, err := Translate(pq, m)
+			if tc.sql == "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Expected error %q but got: %v", tc.err, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v (queries: %v)", err, pq.Queries)
+			}
+
+			sql, args := SQL(cond)
+			if sql != tc.sql || !reflect.DeepEqual(args, tc.args) {
+				t.Fatalf("Expected SQL %v %v but got: %v %v", tc.sql, tc.args, sql, args)
+			}
+
+			es, err := Elasticsearch(cond)
+			if tc.es == "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("Expected error %q but got: %v", tc.err, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var expected interface{}
+			if err := util.UnmarshalJSON([]byte(tc.es), &expected); err != nil {
+				t.Fatal(err)
+			}
+
+			var result interface{} = es
+			if err := util.RoundTrip(&result); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(result, expected) {
+				t.Fatalf("Expected Elasticsearch query %v but got: %v", expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// SQL returns a parameterized SQL WHERE clause for the condition. Values are
+// replaced with ? placeholders and returned in order.
+func SQL(cond Condition) (string, []interface{}) {
+	var buf bytes.Buffer
+	var args []interface{}
+	writeSQL(&buf, &args, cond)
+	return buf.String(), args
+}
+
+func writeSQL(buf *bytes.Buffer, args *[]interface{}, cond Condition) {
+	switch c := cond.(type) {
+	case And:
+		writeSQLList(buf, args, " AND ", c)
+	case Or:
+		writeSQLList(buf, args, " OR ", c)
+	case Not:
+		buf.WriteString("NOT (")
+		writeSQL(buf, args, c.Condition)
+		buf.WriteString(")")
+	case Bool:
+		if c {
+			buf.WriteString("TRUE")
+		} else {
+			buf.WriteString("FALSE")
+		}
+	case Compare:
+		buf.WriteString(c.Column.String())
+		switch v := c.Value.(type) {
+		case nil:
+			if c.Op == "=" {
+				buf.WriteString(" IS NULL")
+				return
+			} else if c.Op == "!=" {
+				buf.WriteString(" IS NOT NULL")
+				return
+			}
+			fmt.Fprintf(buf, " %v ?", c.Op)
+			*args = append(*args, nil)
+		case Column:
+			fmt.Fprintf(buf, " %v %v", sqlOp(c.Op), v)
+		default:
+			fmt.Fprintf(buf, " %v ?", sqlOp(c.Op))
+			*args = append(*args, v)
+		}
+	case In:
+		buf.WriteString(c.Column.String())
+		buf.WriteString(" IN (")
+		for i, v := range c.Values {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString("?")
+			*args = append(*args, v)
+		}
+		buf.WriteString(")")
+	}
+}
+
+func writeSQLList(buf *bytes.Buffer, args *[]interface{}, sep string, conds []Condition) {
+	buf.WriteString("(")
+	for i, c := range conds {
+		if i > 0 {
+			buf.WriteString(sep)
+		}
+		writeSQL(buf, args, c)
+	}
+	buf.WriteString(")")
+}
+
+func sqlOp(op string) string {
+	if op == "!=" {
+		return "<>"
+	}
+	return op
+}
@@ -69,6 +69,76 @@ func Rego(path string) (*RegoFile, error) {
 	return loadRego(path, bs)
 }
 
+// Schemas returns a SchemaSet loaded from the given path. If the path refers to
+// a file, the file contains the JSON Schema for the input document. If the
+// path refers to a directory, each JSON or YAML file in the directory
+// (recursively) contains a schema for the document identified by the file's
+// path relative to the directory, e.g., "input.json" describes the input
+// document and "servers.json" or "infra/servers.yaml" describe data.servers
+// or data.infra.servers respectively.
+func Schemas(path string) (*ast.SchemaSet, error) {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ss := ast.NewSchemaSet()
+
+	if !info.IsDir() {
+		schema, err := loadSchema(path)
+		if err != nil {
+			return nil, err
+		}
+		ss.Put(ast.InputRootRef, schema)
+		return ss, nil
+	}
+
+	paths, err := Paths(path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range paths {
+		ext := filepath.Ext(file)
+		if ext != ".json" && ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		rel, err := filepath.Rel(path, strings.TrimSuffix(file, ext))
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		var ref ast.Ref
+		if len(parts) == 1 && parts[0] == ast.InputRootDocument.String() {
+			ref = ast.InputRootRef.Copy()
+		} else {
+			ref = ast.DefaultRootRef.Copy()
+			for _, part := range parts {
+				ref = append(ref, ast.StringTerm(part))
+			}
+		}
+		schema, err := loadSchema(file)
+		if err != nil {
+			return nil, err
+		}
+		ss.Put(ref, schema)
+	}
+
+	return ss, nil
+}
+
+func loadSchema(path string) (interface{}, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) == ".json" {
+		return loadJSON(path, bs)
+	}
+	return loadYAML(path, bs)
+}
+
 // CleanPath returns the normalized version of a path that can be used as an identifier.
 func CleanPath(path string) string {
 	return strings.Trim(path, "/")
@@ -241,6 +241,53 @@ func TestLoadRegos(t *testing.T) {
 	})
 }
 
+func TestSchemas(t *testing.T) {
+	files := map[string]string{
+		"/schemas/input.json":         `{"type": "object"}`,
+		"/schemas/servers.json":       `{"type": "array"}`,
+		"/schemas/infra/network.yaml": `type: string`,
+		"/schemas/README.md":          `ignored`,
+	}
+
+	test.WithTempFS(files, func(rootDir string) {
+
+		ss, err := Schemas(filepath.Join(rootDir, "schemas"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := map[string]interface{}{
+			"input":              parseJSON(files["/schemas/input.json"]),
+			"data.servers":       parseJSON(files["/schemas/servers.json"]),
+			"data.infra.network": parseYAML(files["/schemas/infra/network.yaml"]),
+		}
+
+		paths := ss.Paths()
+		if len(paths) != len(expected) {
+			t.Fatalf("Expected %d schemas but got: %v", len(expected), paths)
+		}
+
+		for path, schema := range expected {
+			if result := ss.Get(ast.MustParseRef(path)); !reflect.DeepEqual(result, schema) {
+				t.Fatalf("Expected %v for %v but got: %v", schema, path, result)
+			}
+		}
+
+		ss, err = Schemas(filepath.Join(rootDir, "schemas", "servers.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result := ss.Get(ast.InputRootRef); !reflect.DeepEqual(result, parseJSON(files["/schemas/servers.json"])) {
+			t.Fatalf("Expected input schema but got: %v", result)
+		}
+
+		if _, err := Schemas(filepath.Join(rootDir, "missing")); err == nil {
+			t.Fatal("Expected error for missing path")
+		}
+	})
+}
+
 func parseYAML(s string) interface{} {
 	var x interface{}
 	if err := yaml.Unmarshal([]byte(s), &x); err != nil {
@@ -0,0 +1,152 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package profiler computes per-expression statistics from query evaluation
+// to help locate performance hot spots in policies.
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown"
+)
+
+// Profiler implements the topdown.Tracer interface. The Profiler attributes
+// the wall time spent between trace events to the expression that was most
+// recently evaluated (or re-evaluated). The Profiler is not safe for
+// concurrent use.
+type Profiler struct {
+	stats   map[location]*ExprStats
+	current *ExprStats
+	last    time.Time
+}
+
+// ExprStats contains the statistics recorded for a single expression.
+type ExprStats struct {
+	ExprTimeNs int64         `json:"total_time_ns"`
+	NumEval    int           `json:"num_eval"`
+	NumRedo    int           `json:"num_redo"`
+	Location   *ast.Location `json:"location"`
+}
+
+type location struct {
+	file string
+	row  int
+	col  int
+}
+
+// New returns a new Profiler object.
+func New() *Profiler {
+	return &Profiler{
+		stats: map[location]*ExprStats{},
+	}
+}
+
+// Enabled returns true if profiling is enabled.
+func (p *Profiler) Enabled() bool {
+	return p != nil
+}
+
+// Trace updates the statistics for the expression that was most recently
+// evaluated and, if the event refers to an expression being evaluated or
+// re-evaluated, makes that expression the current one.
+func (p *Profiler) Trace(event *topdown.Event) {
+
+	now := time.Now()
+
+	if p.current != nil {
+		p.current.ExprTimeNs += int64(now.Sub(p.last))
+	}
+
+	p.last = now
+
+	expr, ok := event.Node.(*ast.Expr)
+	if !ok || expr.Location == nil {
+		return
+	}
+
+	switch event.Op {
+	case topdown.EvalOp:
+		stats := p.get(expr.Location)
+		stats.NumEval++
+		p.current = stats
+	case topdown.RedoOp:
+		stats := p.get(expr.Location)
+		stats.NumRedo++
+		p.current = stats
+	}
+}
+
+// Report returns the statistics for all expressions that were evaluated
+// sorted by the total time spent (in descending order.)
+func (p *Profiler) Report() []ExprStats {
+
+	result := make([]ExprStats, 0, len(p.stats))
+
+	for _, stats := range p.stats {
+		result = append(result, *stats)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ExprTimeNs != result[j].ExprTimeNs {
+			return result[i].ExprTimeNs > result[j].ExprTimeNs
+		}
+		return result[i].Location.Compare(result[j].Location) < 0
+	})
+
+	return result
+}
+
+// ReportTopN returns the statistics for the n expressions where the most time
+// was spent. If n is not positive, the statistics for all expressions are
+// returned.
+func (p *Profiler) ReportTopN(n int) []ExprStats {
+	result := p.Report()
+	if n > 0 && n < len(result) {
+		result = result[:n]
+	}
+	return result
+}
+
+func (p *Profiler) get(loc *ast.Location) *ExprStats {
+	key := location{file: loc.File, row: loc.Row, col: loc.Col}
+	stats, ok := p.stats[key]
+	if !ok {
+		stats = &ExprStats{Location: loc}
+		p.stats[key] = stats
+	}
+	return stats
+}
+
+// PrettyPrint writes a table containing the statistics to w.
+func PrettyPrint(w io.Writer, stats []ExprStats) {
+	table := tablewriter.NewWriter(w)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeader([]string{"Time", "Num Eval", "Num Redo", "Location"})
+	for _, s := range stats {
+		table.Append([]string{
+			time.Duration(s.ExprTimeNs).String(),
+			fmt.Sprint(s.NumEval),
+			fmt.Sprint(s.NumRedo),
+			formatLocation(s.Location),
+		})
+	}
+	if table.NumLines() > 0 {
+		table.Render()
+	}
+}
+
+func formatLocation(loc *ast.Location) string {
+	if len(loc.File) > 0 {
+		return fmt.Sprintf("%v:%v:%v", loc.File, loc.Row, loc.Col)
+	}
+	return fmt.Sprintf("%v:%v", loc.Row, loc.Col)
+}
@@ -0,0 +1,127 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+func TestProfilerReport(t *testing.T) {
+
+	module := `package test
+
+	p {
+		a = [1, 2, 3, 4]
+		x = a[_]
+		x > 2
+	}`
+
+	profiler := New()
+
+	_, err := rego.New(
+		rego.Module("test.rego", module),
+		rego.Query("data.test.p"),
+		rego.Tracer(profiler),
+	).Eval(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[int]ExprStats{
+		4: {NumEval: 1, NumRedo: 1},
+		5: {NumEval: 1, NumRedo: 3},
+		6: {NumEval: 3, NumRedo: 1},
+	}
+
+	report := profiler.Report()
+
+	for i := range report {
+		if report[i].Location.File != "test.rego" {
+			continue
+		}
+		exp, ok := expected[report[i].Location.Row]
+		if !ok {
+			t.Fatalf("Unexpected expression in report: %v", report[i].Location)
+		}
+		if exp.NumEval != report[i].NumEval || exp.NumRedo != report[i].NumRedo {
+			t.Errorf("Expected eval/redo counts %d/%d for row %d but got %d/%d", exp.NumEval, exp.NumRedo, report[i].Location.Row, report[i].NumEval, report[i].NumRedo)
+		}
+		if i > 0 && report[i-1].ExprTimeNs < report[i].ExprTimeNs {
+			t.Errorf("Expected report to be sorted by time but got: %v", report)
+		}
+		delete(expected, report[i].Location.Row)
+	}
+
+	if len(expected) > 0 {
+		t.Fatalf("Expected expressions missing from report: %v", expected)
+	}
+}
+
+func TestProfilerReportTopN(t *testing.T) {
+
+	profiler := New()
+
+	_, err := rego.New(
+		rego.Query("a = [1, 2, 3]; x = a[_]; x > 1; x < 3"),
+		rego.Tracer(profiler),
+	).Eval(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		n        int
+		expected int
+	}{
+		{0, 4},
+		{-1, 4},
+		{2, 2},
+		{10, 4},
+	}
+
+	for _, tc := range tests {
+		if result := profiler.ReportTopN(tc.n); len(result) != tc.expected {
+			t.Errorf("Expected %d results for n=%d but got: %v", tc.expected, tc.n, result)
+		}
+	}
+}
+
+func TestPrettyPrint(t *testing.T) {
+
+	stats := []ExprStats{
+		{ExprTimeNs: 1500, NumEval: 3, NumRedo: 2, Location: ast.NewLocation(nil, "test.rego", 7, 3)},
+		{ExprTimeNs: 20, NumEval: 1, NumRedo: 1, Location: ast.NewLocation(nil, "", 1, 5)},
+	}
+
+	var buf bytes.Buffer
+	PrettyPrint(&buf, stats)
+
+	expected := []string{
+		"| Time  | Num Eval | Num Redo |   Location    |",
+		"| 1.5µs | 3        | 2        | test.rego:7:3 |",
+		"| 20ns  | 1        | 1        | 1:5           |",
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatalf("Expected output to contain %q but got:\n%v", line, buf.String())
+		}
+	}
+
+	buf.Reset()
+	PrettyPrint(&buf, nil)
+
+	if buf.Len() != 0 {
+		t.Fatalf("Expected no output for empty stats but got:\n%v", buf.String())
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/open-policy-agent/opa/storage"
 	"github.com/open-policy-agent/opa/storage/inmem"
 	"github.com/open-policy-agent/opa/topdown"
+	"github.com/open-policy-agent/opa/types"
 	"github.com/open-policy-agent/opa/util"
 )
 
@@ -23,17 +24,30 @@ const defaultPartialNamespace = "partial"
 // PartialResult represents the result of partial evaluation. The result can be
 // used to generate a new query that can be run when inputs are known.
 type PartialResult struct {
-	compiler *ast.Compiler
-	store    storage.Store
-	body     ast.Body
+	compiler     *ast.Compiler
+	store        storage.Store
+	body         ast.Body
+	builtinDecls map[string]*ast.Builtin
+	builtinFuncs map[string]*topdown.Builtin
 }
 
 // Rego returns an object that can be evaluated to produce a query result.
 func (pr PartialResult) Rego(options ...func(*Rego)) *Rego {
-	options = append(options, Compiler(pr.compiler), Store(pr.store), ParsedQuery(pr.body))
+	options = append(options, Compiler(pr.compiler), Store(pr.store), ParsedQuery(pr.body), func(r *Rego) {
+		for name, decl := range pr.builtinDecls {
+			r.addBuiltin(decl, pr.builtinFuncs[name])
+		}
+	})
 	return New(options...)
 }
 
+// PartialQueries contains the queries and support modules produced by partial
+// evaluation.
+type PartialQueries struct {
+	Queries []ast.Body    `json:"queries,omitempty"`
+	Support []*ast.Module `json:"support,omitempty"`
+}
+
 // Result defines the output of Rego evaluation.
 type Result struct {
 	Expressions []*ExpressionValue `json:"expressions"`
@@ -119,18 +133,48 @@ type Rego struct {
 	input            ast.Value
 	unknowns         []string
 	partialNamespace string
+	disableInlining  []string
+	shallowInlining  bool
+	copyPropagation  bool
 	modules          []rawModule
 	compiler         *ast.Compiler
 	store            storage.Store
 	txn              storage.Transaction
 	metrics          metrics.Metrics
-	tracer           topdown.Tracer
+	tracers          []topdown.Tracer
 	instrumentation  *topdown.Instrumentation
 	instrument       bool
 	capture          map[*ast.Expr]ast.Var // map exprs to generated capture vars
 	termVarID        int
+	builtinDecls     map[string]*ast.Builtin
+	builtinFuncs     map[string]*topdown.Builtin
+}
+
+// Function represents a built-in function that is callable in Rego.
+type Function struct {
+	Name             string
+	Decl             *types.Function
+	Nondeterministic bool // if true, calls are not evaluated during partial evaluation
 }
 
+// BuiltinContext contains additional attributes from the evaluator that
+// built-in functions can use, e.g., the request context.Context, caches, etc.
+type BuiltinContext = topdown.BuiltinContext
+
+type (
+	// Builtin1 defines a built-in function that accepts 1 argument.
+	Builtin1 func(bctx BuiltinContext, op1 *ast.Term) (*ast.Term, error)
+
+	// Builtin2 defines a built-in function that accepts 2 arguments.
+	Builtin2 func(bctx BuiltinContext, op1, op2 *ast.Term) (*ast.Term, error)
+
+	// Builtin3 defines a built-in function that accepts 3 arguments.
+	Builtin3 func(bctx BuiltinContext, op1, op2, op3 *ast.Term) (*ast.Term, error)
+
+	// BuiltinDyn defines a built-in function that accepts a list of arguments.
+	BuiltinDyn func(bctx BuiltinContext, terms []*ast.Term) (*ast.Term, error)
+)
+
 // Query returns an argument that sets the Rego query.
 func Query(q string) func(r *Rego) {
 	return func(r *Rego) {
@@ -208,6 +252,33 @@ func PartialNamespace(ns string) func(r *Rego) {
 	}
 }
 
+// DisableInlining returns an argument that sets the paths of virtual documents
+// that should not be inlined during partial evaluation. The paths must be
+// references, e.g., data.example.allow.
+func DisableInlining(paths []string) func(r *Rego) {
+	return func(r *Rego) {
+		r.disableInlining = paths
+	}
+}
+
+// ShallowInlining returns an argument that enables or disables shallow
+// inlining. When enabled, rules that depend on unknown values are partially
+// evaluated into support rules instead of being inlined.
+func ShallowInlining(enabled bool) func(r *Rego) {
+	return func(r *Rego) {
+		r.shallowInlining = enabled
+	}
+}
+
+// CopyPropagation returns an argument that enables or disables copy
+// propagation of the partially evaluated queries and support rules. When
+// enabled, redundant variables, expressions and queries are removed.
+func CopyPropagation(enabled bool) func(r *Rego) {
+	return func(r *Rego) {
+		r.copyPropagation = enabled
+	}
+}
+
 // Module returns an argument that adds a Rego module.
 func Module(filename, input string) func(r *Rego) {
 	return func(r *Rego) {
@@ -255,15 +326,93 @@ func Instrument(yes bool) func(r *Rego) {
 	}
 }
 
-// Tracer returns an argument that sets the topdown Tracer.
+// Tracer returns an argument that adds a topdown Tracer. Multiple tracers may
+// be added.
 func Tracer(t topdown.Tracer) func(r *Rego) {
 	return func(r *Rego) {
 		if t != nil {
-			r.tracer = t
+			r.tracers = append(r.tracers, t)
 		}
 	}
 }
 
+// Function1 returns an option that adds a built-in function to the Rego object.
+// The built-in function is only visible to queries and modules evaluated by
+// this Rego object. If the compiler is supplied with the Compiler option, the
+// compiler is not modified and the built-in function is only visible to the
+// query. If the implementation returns a nil term, the call is undefined.
+func Function1(decl *Function, f Builtin1) func(*Rego) {
+	return newFunction(decl, func(bctx BuiltinContext, terms []*ast.Term) (*ast.Term, error) {
+		return f(bctx, terms[0])
+	})
+}
+
+// Function2 returns an option that adds a built-in function to the Rego object.
+func Function2(decl *Function, f Builtin2) func(*Rego) {
+	return newFunction(decl, func(bctx BuiltinContext, terms []*ast.Term) (*ast.Term, error) {
+		return f(bctx, terms[0], terms[1])
+	})
+}
+
+// Function3 returns an option that adds a built-in function to the Rego object.
+func Function3(decl *Function, f Builtin3) func(*Rego) {
+	return newFunction(decl, func(bctx BuiltinContext, terms []*ast.Term) (*ast.Term, error) {
+		return f(bctx, terms[0], terms[1], terms[2])
+	})
+}
+
+// FunctionDyn returns an option that adds a built-in function to the Rego
+// object. The implementation is called with all of the input operands.
+func FunctionDyn(decl *Function, f BuiltinDyn) func(*Rego) {
+	return newFunction(decl, f)
+}
+
+func newFunction(decl *Function, f BuiltinDyn) func(*Rego) {
+	bi := &ast.Builtin{
+		Name:             decl.Name,
+		Decl:             decl.Decl,
+		Nondeterministic: decl.Nondeterministic,
+	}
+	return func(r *Rego) {
+		r.addBuiltin(bi, &topdown.Builtin{
+			Decl: bi,
+			Func: func(bctx BuiltinContext, terms []*ast.Term, iter func(*ast.Term) error) error {
+				result, err := f(bctx, terms[:len(bi.Decl.Args())])
+				if err != nil {
+					return functionErr(bi.Name, bctx.Location, err)
+				}
+				if result == nil {
+					return nil
+				}
+				return iter(result)
+			},
+		})
+	}
+}
+
+func functionErr(name string, loc *ast.Location, err error) error {
+	switch err.(type) {
+	case topdown.BuiltinEmpty:
+		return nil
+	case *topdown.Error:
+		return err
+	}
+	return &topdown.Error{
+		Code:     topdown.BuiltinErr,
+		Message:  fmt.Sprintf("%v: %v", name, err.Error()),
+		Location: loc,
+	}
+}
+
+func (r *Rego) addBuiltin(decl *ast.Builtin, f *topdown.Builtin) {
+	if r.builtinDecls == nil {
+		r.builtinDecls = map[string]*ast.Builtin{}
+		r.builtinFuncs = map[string]*topdown.Builtin{}
+	}
+	r.builtinDecls[decl.Name] = decl
+	r.builtinFuncs[decl.Name] = f
+}
+
 // New returns a new Rego object.
 func New(options ...func(*Rego)) *Rego {
 
@@ -276,7 +425,7 @@ func New(options ...func(*Rego)) *Rego {
 	}
 
 	if r.compiler == nil {
-		r.compiler = ast.NewCompiler()
+		r.compiler = ast.NewCompiler().WithBuiltins(r.builtinDecls)
 	}
 
 	if r.store == nil {
@@ -376,6 +525,51 @@ func (r *Rego) PartialEval(ctx context.Context) (PartialResult, error) {
 	return r.partialEval(ctx, compiled, txn, ast.Wildcard)
 }
 
+// Partial partially evaluates the query with respect to the unknowns and
+// returns the partially evaluated queries and support modules. Unlike
+// PartialEval, the query may contain any number of expressions.
+func (r *Rego) Partial(ctx context.Context) (*PartialQueries, error) {
+
+	if len(r.query) == 0 && len(r.parsedQuery) == 0 {
+		return nil, fmt.Errorf("cannot evaluate empty query")
+	}
+
+	parsed, query, err := r.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.compileModules(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	_, compiled, err := r.compileQuery(nil, query)
+	if err != nil {
+		return nil, err
+	}
+
+	txn := r.txn
+
+	if txn == nil {
+		txn, err = r.store.NewTransaction(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer r.store.Abort(ctx, txn)
+	}
+
+	_, queries, support, err := r.partial(ctx, compiled, txn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PartialQueries{
+		Queries: queries,
+		Support: support,
+	}, nil
+}
+
 func (r *Rego) parse() (map[string]*ast.Module, ast.Body, error) {
 
 	r.metrics.Timer(metrics.RegoQueryParse).Start()
@@ -483,7 +677,9 @@ func (r *Rego) compileQuery(extras []extraStage, query ast.Body) (ast.QueryCompi
 		WithImports(imports).
 		WithInput(input)
 
-	qc := r.compiler.QueryCompiler().WithContext(qctx)
+	qc := r.compiler.QueryCompiler().
+		WithContext(qctx).
+		WithBuiltins(r.builtinDecls)
 
 	for _, extra := range extras {
 		qc = qc.WithStageAfter(extra.after, extra.stage)
@@ -501,10 +697,13 @@ func (r *Rego) eval(ctx context.Context, qc ast.QueryCompiler, compiled ast.Body
 		WithStore(r.store).
 		WithTransaction(txn).
 		WithMetrics(r.metrics).
-		WithInstrumentation(r.instrumentation)
+		WithInstrumentation(r.instrumentation).
+		WithBuiltins(r.builtinFuncs).
+		WithEarlyExit(true).
+		WithQueryEarlyExit(true)
 
-	if r.tracer != nil {
-		q = q.WithTracer(r.tracer)
+	for _, t := range r.tracers {
+		q = q.WithTracer(t)
 	}
 
 	if r.input != nil {
@@ -568,6 +767,49 @@ func (r *Rego) eval(ctx context.Context, qc ast.QueryCompiler, compiled ast.Body
 
 func (r *Rego) partialEval(ctx context.Context, compiled ast.Body, txn storage.Transaction, output *ast.Term) (PartialResult, error) {
 
+	partialNamespace, partials, support, err := r.partial(ctx, compiled, txn)
+	if err != nil {
+		return PartialResult{}, err
+	}
+
+	// Construct module for queries.
+	module := ast.MustParseModule("package " + partialNamespace)
+	module.Rules = make([]*ast.Rule, len(partials))
+	for i, body := range partials {
+		module.Rules[i] = &ast.Rule{
+			Head:   ast.NewHead(ast.Var("__result__"), nil, output),
+			Body:   body,
+			Module: module,
+		}
+	}
+
+	// Update compiler with partial evaluation output.
+	r.compiler.Modules["__partialresult__"] = module
+	for i, module := range support {
+		r.compiler.Modules[fmt.Sprintf("__partialsupport%d__", i)] = module
+	}
+
+	r.compiler.Compile(r.compiler.Modules)
+	if r.compiler.Failed() {
+		return PartialResult{}, r.compiler.Errors
+	}
+
+	result := PartialResult{
+		compiler:     r.compiler,
+		store:        r.store,
+		body:         ast.MustParseBody(fmt.Sprintf("data.%v.__result__", partialNamespace)),
+		builtinDecls: r.builtinDecls,
+		builtinFuncs: r.builtinFuncs,
+	}
+
+	return result, nil
+}
+
+// partial runs partial evaluation on the compiled query and returns the
+// namespace of the support modules along with the partially evaluated queries
+// and support modules.
+func (r *Rego) partial(ctx context.Context, compiled ast.Body, txn storage.Transaction) (string, []ast.Body, []*ast.Module, error) {
+
 	var unknowns []*ast.Term
 
 	// Use input document as unknown if caller has not specified any.
@@ -579,7 +821,7 @@ func (r *Rego) partialEval(ctx context.Context, compiled ast.Body, txn storage.T
 			var err error
 			unknowns[i], err = ast.ParseTerm(r.unknowns[i])
 			if err != nil {
-				return PartialResult{}, err
+				return "", nil, nil, err
 			}
 		}
 	}
@@ -591,9 +833,9 @@ func (r *Rego) partialEval(ctx context.Context, compiled ast.Body, txn storage.T
 
 	// Check partial namespace to ensure it's valid.
 	if term, err := ast.ParseTerm(partialNamespace); err != nil {
-		return PartialResult{}, err
+		return "", nil, nil, err
 	} else if _, ok := term.Value.(ast.Var); !ok {
-		return PartialResult{}, fmt.Errorf("bad partial namespace")
+		return "", nil, nil, fmt.Errorf("bad partial namespace")
 	}
 
 	q := topdown.NewQuery(compiled).
@@ -603,10 +845,25 @@ func (r *Rego) partialEval(ctx context.Context, compiled ast.Body, txn storage.T
 		WithMetrics(r.metrics).
 		WithInstrumentation(r.instrumentation).
 		WithUnknowns(unknowns).
-		WithPartialNamespace(partialNamespace)
+		WithPartialNamespace(partialNamespace).
+		WithShallowInlining(r.shallowInlining).
+		WithCopyPropagation(r.copyPropagation).
+		WithBuiltins(r.builtinFuncs)
+
+	if len(r.disableInlining) > 0 {
+		paths := make([]ast.Ref, len(r.disableInlining))
+		for i := range r.disableInlining {
+			var err error
+			paths[i], err = ast.ParseRef(r.disableInlining[i])
+			if err != nil {
+				return "", nil, nil, err
+			}
+		}
+		q = q.WithDisableInlining(paths)
+	}
 
-	if r.tracer != nil {
-		q = q.WithTracer(r.tracer)
+	for _, t := range r.tracers {
+		q = q.WithTracer(t)
 	}
 
 	if r.input != nil {
@@ -624,38 +881,10 @@ func (r *Rego) partialEval(ctx context.Context, compiled ast.Body, txn storage.T
 
 	partials, support, err := q.PartialRun(ctx)
 	if err != nil {
-		return PartialResult{}, err
-	}
-
-	// Construct module for queries.
-	module := ast.MustParseModule("package " + partialNamespace)
-	module.Rules = make([]*ast.Rule, len(partials))
-	for i, body := range partials {
-		module.Rules[i] = &ast.Rule{
-			Head:   ast.NewHead(ast.Var("__result__"), nil, output),
-			Body:   body,
-			Module: module,
-		}
-	}
-
-	// Update compiler with partial evaluation output.
-	r.compiler.Modules["__partialresult__"] = module
-	for i, module := range support {
-		r.compiler.Modules[fmt.Sprintf("__partialsupport%d__", i)] = module
+		return "", nil, nil, err
 	}
 
-	r.compiler.Compile(r.compiler.Modules)
-	if r.compiler.Failed() {
-		return PartialResult{}, r.compiler.Errors
-	}
-
-	result := PartialResult{
-		compiler: r.compiler,
-		store:    r.store,
-		body:     ast.MustParseBody(fmt.Sprintf("data.%v.__result__", partialNamespace)),
-	}
-
-	return result, nil
+	return partialNamespace, partials, support, nil
 }
 
 func (r *Rego) rewriteQueryToCaptureValue(qc ast.QueryCompiler, query ast.Body) (ast.Body, error) {
@@ -7,7 +7,9 @@ package rego
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -147,6 +149,36 @@ func TestRegoRewrittenVarsCapture(t *testing.T) {
 
 }
 
+func TestRegoQueryEarlyExit(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		note     string
+		query    string
+		expected int
+	}{
+		{"existence", `input.roles[_] = "admin"`, 1},
+		{"named vars", `input.roles[i] = "admin"`, 2},
+		{"captured values", `input.roles[_]`, 3},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			rs, err := New(
+				Query(tc.query),
+				Input(map[string]interface{}{"roles": []interface{}{"admin", "dev", "admin"}}),
+			).Eval(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rs) != tc.expected {
+				t.Fatalf("Expected %d results but got: %v", tc.expected, rs)
+			}
+		})
+	}
+}
+
 func TestRegoCancellation(t *testing.T) {
 
 	ast.RegisterBuiltin(&ast.Builtin{
@@ -174,3 +206,298 @@ func TestRegoCancellation(t *testing.T) {
 		t.Fatalf("Got unexpected error: %v", err)
 	}
 }
+
+func TestRegoCustomBuiltins(t *testing.T) {
+
+	decl := &Function{
+		Name: "tenant.greet",
+		Decl: types.NewFunction(types.Args(types.S), types.S),
+	}
+
+	module := `package test
+
+	p = tenant.greet(input.name)`
+
+	newRego := func(prefix string) *Rego {
+		return New(
+			Query("data.test.p"),
+			Module("test.rego", module),
+			Input(map[string]interface{}{"name": "bob"}),
+			Function1(decl, func(_ BuiltinContext, a *ast.Term) (*ast.Term, error) {
+				s, ok := a.Value.(ast.String)
+				if !ok {
+					return nil, fmt.Errorf("bad name")
+				}
+				return ast.StringTerm(prefix + string(s)), nil
+			}),
+		)
+	}
+
+	for prefix, expected := range map[string]string{"hello ": "hello bob", "bonjour ": "bonjour bob"} {
+		rs, err := newRego(prefix).Eval(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rs) != 1 || rs[0].Expressions[0].Value != expected {
+			t.Fatalf("Expected %q but got: %v", expected, rs)
+		}
+	}
+
+	// Custom built-ins are not visible to other Rego objects.
+	_, err := New(Query(`tenant.greet("bob", x)`)).Eval(context.Background())
+	if err == nil {
+		t.Fatal("Expected undefined function error")
+	}
+}
+
+func TestRegoCustomBuiltinsSharedCompiler(t *testing.T) {
+
+	compiler := ast.NewCompiler()
+	compiler.Compile(map[string]*ast.Module{
+		"test.rego": ast.MustParseModule(`package test
+
+		p = 1`),
+	})
+
+	if compiler.Failed() {
+		t.Fatal(compiler.Errors)
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("tenant%d.f", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rs, err := New(
+				Compiler(compiler),
+				Query(fmt.Sprintf("x = %v(data.test.p)", name)),
+				Function1(&Function{
+					Name: name,
+					Decl: types.NewFunction(types.Args(types.N), types.N),
+				}, func(_ BuiltinContext, a *ast.Term) (*ast.Term, error) {
+					return a, nil
+				}),
+			).Eval(context.Background())
+			if err != nil || len(rs) != 1 || !reflect.DeepEqual(rs[0].Bindings["x"], json.Number("1")) {
+				t.Errorf("Unexpected result for %v: %v (err: %v)", name, rs, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// Custom built-ins are not added to the shared compiler.
+	if compiler.GetArity(ast.MustParseRef("tenant0.f")) != -1 {
+		t.Fatal("Expected custom built-in to be absent from shared compiler")
+	}
+
+	_, err := New(Compiler(compiler), Query("tenant0.f(1, x)")).Eval(context.Background())
+	if err == nil {
+		t.Fatal("Expected undefined function error")
+	}
+}
+
+func TestRegoCustomBuiltinContextAndErrors(t *testing.T) {
+
+	type ctxKey string
+
+	ctx := context.WithValue(context.Background(), ctxKey("tenant"), "acme")
+
+	r := New(
+		Query(`x = tenant.lookup("tenant"); y = tenant.sum(1, 2, 3); tenant.fail(1)`),
+		Function1(&Function{
+			Name: "tenant.lookup",
+			Decl: types.NewFunction(types.Args(types.S), types.A),
+		}, func(bctx BuiltinContext, a *ast.Term) (*ast.Term, error) {
+			v, ok := bctx.Context.Value(ctxKey(a.Value.(ast.String))).(string)
+			if !ok {
+				return nil, nil
+			}
+			return ast.StringTerm(v), nil
+		}),
+		FunctionDyn(&Function{
+			Name: "tenant.sum",
+			Decl: types.NewFunction(types.Args(types.N, types.N, types.N), types.N),
+		}, func(_ BuiltinContext, terms []*ast.Term) (*ast.Term, error) {
+			sum := 0
+			for _, t := range terms {
+				n, _ := t.Value.(ast.Number).Int()
+				sum += n
+			}
+			return ast.IntNumberTerm(sum), nil
+		}),
+		Function1(&Function{
+			Name: "tenant.fail",
+			Decl: types.NewFunction(types.Args(types.N), types.B),
+		}, func(_ BuiltinContext, a *ast.Term) (*ast.Term, error) {
+			return nil, fmt.Errorf("connection refused")
+		}),
+	)
+
+	_, err := r.Eval(ctx)
+	topdownErr, ok := err.(*topdown.Error)
+	if !ok || topdownErr.Code != topdown.BuiltinErr || topdownErr.Message != "tenant.fail: connection refused" {
+		t.Fatalf("Expected builtin error but got: %v", err)
+	}
+
+	r = New(
+		Query(`x = tenant.lookup("tenant")`),
+		Function1(&Function{
+			Name: "tenant.lookup",
+			Decl: types.NewFunction(types.Args(types.S), types.A),
+		}, func(bctx BuiltinContext, a *ast.Term) (*ast.Term, error) {
+			v, ok := bctx.Context.Value(ctxKey(a.Value.(ast.String))).(string)
+			if !ok {
+				return nil, nil
+			}
+			return ast.StringTerm(v), nil
+		}),
+	)
+
+	rs, err := r.Eval(ctx)
+	if err != nil || len(rs) != 1 || rs[0].Bindings["x"] != "acme" {
+		t.Fatalf("Unexpected result: %v (err: %v)", rs, err)
+	}
+
+	rs, err = r.Eval(context.Background())
+	if err != nil || len(rs) != 0 {
+		t.Fatalf("Expected undefined result but got: %v (err: %v)", rs, err)
+	}
+}
+
+func TestRegoCustomBuiltinPartialEval(t *testing.T) {
+
+	var calls int
+
+	impl := func(_ BuiltinContext, a *ast.Term) (*ast.Term, error) {
+		calls++
+		return ast.BooleanTerm(true), nil
+	}
+
+	tests := []struct {
+		note             string
+		nondeterministic bool
+		expected         string
+		calls            int
+	}{
+		{"deterministic", false, `input.name = "bob"; _ = true`, 1},
+		{"non-deterministic", true, `tenant.check("bob"); input.name = "bob"; _ = true`, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			calls = 0
+			decl := &Function{
+				Name:             "tenant.check",
+				Decl:             types.NewFunction(types.Args(types.S), types.B),
+				Nondeterministic: tc.nondeterministic,
+			}
+			r := New(
+				Query("data.test.p"),
+				Module("test.rego", `package test
+
+				p { x = "bob"; tenant.check(x); input.name = x }`),
+				Function1(decl, impl),
+			)
+			pq, err := r.PartialEval(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			rules := pq.compiler.Modules["__partialresult__"].Rules
+			if len(rules) != 1 || rules[0].Body.String() != tc.expected {
+				t.Fatalf("Expected %v but got: %v", tc.expected, rules)
+			}
+			rs, err := pq.Rego(Input(map[string]interface{}{"name": "bob"})).Eval(context.Background())
+			if err != nil || len(rs) != 1 {
+				t.Fatalf("Unexpected result: %v (err: %v)", rs, err)
+			}
+			if calls != tc.calls {
+				t.Fatalf("Expected %d call(s) but got %d", tc.calls, calls)
+			}
+		})
+	}
+}
+
+func TestRegoPartial(t *testing.T) {
+
+	module := `package test
+
+	p { input.x = 1; q[input.y] }
+	q[x] { x = input.z }`
+
+	tests := []struct {
+		note            string
+		disableInlining []string
+		shallowInlining bool
+		copyPropagation bool
+		queries         []string
+		support         []string
+	}{
+		{
+			note:    "inlined",
+			queries: []string{`input.x = 1; __local0__1 = input.y; x2 = __local0__1; x2 = input.z; x2 = _; neq(_, false); _ = true`},
+		},
+		{
+			note:            "disable inlining",
+			disableInlining: []string{"data.test.q"},
+			queries:         []string{`input.x = 1; __local0__1 = input.y; data.partial.test.q[__local0__1] = _; neq(_, false); _ = true`},
+			support: []string{`package partial.test
+
+			q[x] { x = input.z }`},
+		},
+		{
+			note:            "copy propagation",
+			copyPropagation: true,
+			queries:         []string{`input.x = 1; input.y = input.z; neq(input.y, false)`},
+		},
+		{
+			note:            "shallow inlining",
+			shallowInlining: true,
+			queries:         []string{`data.partial.test.p = _; neq(_, false)`},
+			support: []string{`package partial.test
+
+			q[x] { x = input.z }
+			p { input.x = 1; __local0__ = input.y; data.partial.test.q[__local0__] = _; neq(_, false) }`},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			r := New(
+				Query("data.test.p"),
+				Module("test.rego", module),
+				DisableInlining(tc.disableInlining),
+				ShallowInlining(tc.shallowInlining),
+				CopyPropagation(tc.copyPropagation),
+			)
+
+			pq, err := r.Partial(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(pq.Queries) != len(tc.queries) {
+				t.Fatalf("Expected %d queries but got: %v", len(tc.queries), pq.Queries)
+			}
+
+			for i := range tc.queries {
+				if pq.Queries[i].String() != tc.queries[i] {
+					t.Fatalf("Expected query %d to be %v but got: %v", i, tc.queries[i], pq.Queries[i])
+				}
+			}
+
+			if len(pq.Support) != len(tc.support) {
+				t.Fatalf("Expected %d support modules but got: %v", len(tc.support), pq.Support)
+			}
+
+			for i := range tc.support {
+				// Compare strings because wildcards are renamed during parsing.
+				if pq.Support[i].String() != ast.MustParseModule(tc.support[i]).String() {
+					t.Fatalf("Expected support module %d to be %v but got: %v", i, tc.support[i], pq.Support[i])
+				}
+			}
+		})
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/format"
 	"github.com/open-policy-agent/opa/metrics"
+	"github.com/open-policy-agent/opa/profiler"
 	"github.com/open-policy-agent/opa/storage"
 	"github.com/open-policy-agent/opa/topdown"
 	"github.com/open-policy-agent/opa/version"
@@ -47,6 +48,7 @@ type REPL struct {
 	outputFormat      string
 	explain           explainMode
 	instrument        bool
+	profile           bool
 	historyPath       string
 	initPrompt        string
 	bufferPrompt      string
@@ -68,6 +70,8 @@ const (
 
 const defaultPrettyLimit = 80
 
+const defaultProfileLimit = 10
+
 const exitPromptMessage = "Do you want to exit ([y]/n)? "
 
 // New returns a new instance of the REPL.
@@ -259,6 +263,8 @@ func (r *REPL) OneShot(ctx context.Context, line string) error {
 				return r.cmdMetrics()
 			case "instrument":
 				return r.cmdInstrument()
+			case "profile":
+				return r.cmdProfile()
 			case "types":
 				return r.cmdTypes()
 			case "partial":
@@ -446,6 +452,11 @@ func (r *REPL) cmdInstrument() error {
 	return nil
 }
 
+func (r *REPL) cmdProfile() error {
+	r.profile = !r.profile
+	return nil
+}
+
 func (r *REPL) cmdTypes() error {
 	r.types = !r.types
 	return nil
@@ -790,6 +801,12 @@ func (r *REPL) evalBody(ctx context.Context, compiler *ast.Compiler, input ast.V
 		buf = topdown.NewBufferTracer()
 	}
 
+	var prof *profiler.Profiler
+
+	if r.profile {
+		prof = profiler.New()
+	}
+
 	eval := rego.New(
 		rego.Compiler(compiler),
 		rego.Store(r.store),
@@ -800,6 +817,7 @@ func (r *REPL) evalBody(ctx context.Context, compiler *ast.Compiler, input ast.V
 		rego.ParsedInput(input),
 		rego.Metrics(r.metrics),
 		rego.Tracer(buf),
+		rego.Tracer(prof),
 		rego.Instrument(r.instrument),
 	)
 
@@ -813,6 +831,10 @@ func (r *REPL) evalBody(ctx context.Context, compiler *ast.Compiler, input ast.V
 		r.printMetrics(r.metrics)
 	}
 
+	if prof != nil {
+		r.printProfile(prof)
+	}
+
 	if err != nil {
 		return err
 	}
@@ -882,6 +904,13 @@ func (r *REPL) evalPartial(ctx context.Context, compiler *ast.Compiler, input as
 		q = q.WithTracer(buf)
 	}
 
+	var prof *profiler.Profiler
+
+	if r.profile {
+		prof = profiler.New()
+		q = q.WithTracer(prof)
+	}
+
 	queries, support, err := q.PartialRun(ctx)
 	if err != nil {
 		return err
@@ -891,6 +920,10 @@ func (r *REPL) evalPartial(ctx context.Context, compiler *ast.Compiler, input as
 		r.printTrace(ctx, compiler, *buf)
 	}
 
+	if prof != nil {
+		r.printProfile(prof)
+	}
+
 	for i := range queries {
 		fmt.Fprintln(r.output, queries[i])
 	}
@@ -1047,6 +1080,10 @@ func (r *REPL) printMetrics(metrics metrics.Metrics) {
 	fmt.Fprintln(r.output)
 }
 
+func (r *REPL) printProfile(prof *profiler.Profiler) {
+	profiler.PrettyPrint(r.output, prof.ReportTopN(defaultProfileLimit))
+}
+
 func (r *REPL) printTypes(ctx context.Context, typeEnv *ast.TypeEnv, body ast.Body) {
 
 	ast.WalkRefs(body, func(ref ast.Ref) bool {
@@ -1145,6 +1182,7 @@ var builtin = [...]commandDesc{
 	{"trace", []string{}, "toggle full trace"},
 	{"metrics", []string{}, "toggle metrics"},
 	{"instrument", []string{}, "toggle instrumentation"},
+	{"profile", []string{}, "toggle profiling"},
 	{"types", []string{}, "toggle type information"},
 	{"partial", []string{"[ref-1 [ref-2 [...]]]"}, "toggle partial evaluation mode"},
 	{"dump", []string{"[path]"}, "dump raw data in storage"},
@@ -1229,6 +1229,32 @@ func TestInstrument(t *testing.T) {
 
 }
 
+func TestProfile(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore()
+	var buffer bytes.Buffer
+
+	repl := newRepl(store, &buffer)
+	repl.OneShot(ctx, "profile")
+	repl.OneShot(ctx, "a = [1,2,3]; a[_] > 1")
+
+	result := buffer.String()
+
+	for _, exp := range []string{"Num Eval", "Num Redo", "1:1", "1:14"} {
+		if !strings.Contains(result, exp) {
+			t.Fatalf("Expected output to contain %q but got: %v", exp, result)
+		}
+	}
+
+	buffer.Reset()
+	repl.OneShot(ctx, "profile")
+	repl.OneShot(ctx, "a = [1,2,3]; a[_] > 1")
+
+	if strings.Contains(buffer.String(), "Num Eval") {
+		t.Fatal("Expected profile to be disabled but got:", buffer.String())
+	}
+}
+
 func TestEvalTrace(t *testing.T) {
 	ctx := context.Background()
 	store := newTestStore()
@@ -24,6 +24,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/filter"
 	"github.com/open-policy-agent/opa/metrics"
 	"github.com/open-policy-agent/opa/plugins"
 	"github.com/open-policy-agent/opa/rego"
@@ -67,6 +68,7 @@ const (
 	PromHandlerV1Data     = "v1/data"
 	PromHandlerV1Query    = "v1/query"
 	PromHandlerV1Policies = "v1/policies"
+	PromHandlerV1Compile  = "v1/compile"
 	PromHandlerIndex      = "index"
 	PromHandlerCatch      = "catchall"
 )
@@ -116,6 +118,7 @@ func New() *Server {
 	v1DataDur := duration.MustCurryWith(prometheus.Labels{"handler": PromHandlerV1Data})
 	v1PoliciesDur := duration.MustCurryWith(prometheus.Labels{"handler": PromHandlerV1Policies})
 	v1QueryDur := duration.MustCurryWith(prometheus.Labels{"handler": PromHandlerV1Query})
+	v1CompileDur := duration.MustCurryWith(prometheus.Labels{"handler": PromHandlerV1Compile})
 	indexDur := duration.MustCurryWith(prometheus.Labels{"handler": PromHandlerIndex})
 	catchAllDur := duration.MustCurryWith(prometheus.Labels{"handler": PromHandlerCatch})
 	promRegistry.MustRegister(duration)
@@ -141,6 +144,7 @@ func New() *Server {
 	s.registerHandler(router, 1, "/policies/{path:.+}", http.MethodGet, promhttp.InstrumentHandlerDuration(v1PoliciesDur, http.HandlerFunc(s.v1PoliciesGet)))
 	s.registerHandler(router, 1, "/policies/{path:.+}", http.MethodPut, promhttp.InstrumentHandlerDuration(v1PoliciesDur, http.HandlerFunc(s.v1PoliciesPut)))
 	s.registerHandler(router, 1, "/query", http.MethodGet, promhttp.InstrumentHandlerDuration(v1QueryDur, http.HandlerFunc(s.v1QueryGet)))
+	s.registerHandler(router, 1, "/compile", http.MethodPost, promhttp.InstrumentHandlerDuration(v1CompileDur, http.HandlerFunc(s.v1CompilePost)))
 	router.HandleFunc("/", promhttp.InstrumentHandlerDuration(indexDur, http.HandlerFunc(s.unversionedPost))).Methods(http.MethodPost)
 	router.HandleFunc("/", promhttp.InstrumentHandlerDuration(indexDur, http.HandlerFunc(s.indexGet))).Methods(http.MethodGet)
 	// These are catch all handlers that respond 405 for resources that exist but the method is not allowed
@@ -166,6 +170,9 @@ func New() *Server {
 		http.MethodConnect, http.MethodDelete, http.MethodOptions, http.MethodTrace, http.MethodPost, http.MethodPut, http.MethodPatch)
 	router.HandleFunc("/v1/query", promhttp.InstrumentHandlerDuration(catchAllDur, http.HandlerFunc(writer.HTTPStatus(405)))).Methods(http.MethodHead,
 		http.MethodConnect, http.MethodDelete, http.MethodOptions, http.MethodTrace, http.MethodPost, http.MethodPut, http.MethodPatch)
+	// Compile catch all
+	router.HandleFunc("/v1/compile", promhttp.InstrumentHandlerDuration(catchAllDur, http.HandlerFunc(writer.HTTPStatus(405)))).Methods(http.MethodGet, http.MethodHead,
+		http.MethodConnect, http.MethodDelete, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodPatch)
 
 	s.Handler = router
 	return &s
@@ -1139,6 +1146,104 @@ func (s *Server) v1QueryGet(w http.ResponseWriter, r *http.Request) {
 	writer.JSON(w, 200, results, pretty)
 }
 
+func (s *Server) v1CompilePost(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	pretty := getBoolParam(r.URL, types.ParamPrettyV1, true)
+	explainMode := getExplain(r.URL.Query()[types.ParamExplainV1], types.ExplainOffV1)
+	includeMetrics := getBoolParam(r.URL, types.ParamMetricsV1, true)
+	includeInstrumentation := getBoolParam(r.URL, types.ParamInstrumentV1, true)
+
+	m := metrics.New()
+
+	m.Timer(metrics.RegoQueryParse).Start()
+
+	request, input, err := readCompileRequestV1(r.Body)
+	if err != nil {
+		writer.ErrorString(w, http.StatusBadRequest, types.CodeInvalidParameter, err)
+		return
+	}
+
+	query, err := ast.ParseBody(request.Query)
+	if err != nil {
+		switch err := err.(type) {
+		case ast.Errors:
+			writer.Error(w, http.StatusBadRequest, types.NewErrorV1(types.CodeInvalidParameter, types.MsgParseQueryError).WithASTErrors(err))
+		default:
+			writer.ErrorString(w, http.StatusBadRequest, types.CodeInvalidParameter, err)
+		}
+		return
+	}
+
+	m.Timer(metrics.RegoQueryParse).Stop()
+
+	unknowns := []string{"input"}
+	if request.Unknowns != nil {
+		unknowns = *request.Unknowns
+	}
+
+	txn, err := s.store.NewTransaction(ctx)
+	if err != nil {
+		writer.ErrorAuto(w, err)
+		return
+	}
+
+	defer s.store.Abort(ctx, txn)
+
+	var buf *topdown.BufferTracer
+	if explainMode != types.ExplainOffV1 {
+		buf = topdown.NewBufferTracer()
+	}
+
+	eval := rego.New(
+		rego.Compiler(s.getCompiler()),
+		rego.Store(s.store),
+		rego.Transaction(txn),
+		rego.ParsedQuery(query),
+		rego.ParsedInput(input),
+		rego.Unknowns(unknowns),
+		rego.Metrics(m),
+		rego.Instrument(includeInstrumentation),
+		rego.Tracer(buf),
+	)
+
+	pq, err := eval.Partial(ctx)
+	if err != nil {
+		switch err := err.(type) {
+		case ast.Errors:
+			writer.Error(w, http.StatusBadRequest, types.NewErrorV1(types.CodeInvalidParameter, types.MsgCompileQueryError).WithASTErrors(err))
+		default:
+			writer.ErrorAuto(w, err)
+		}
+		return
+	}
+
+	result := types.CompileResponseV1{
+		Result: &types.CompileResultV1{
+			Queries: pq.Queries,
+			Support: pq.Support,
+		},
+	}
+
+	if request.Translate != "" {
+		result.Result.Filter, err = filter.TranslateTarget(request.Translate, pq, request.Mapping)
+		if err != nil {
+			writer.Error(w, http.StatusBadRequest, types.NewErrorV1(types.CodeInvalidParameter, types.MsgTranslateQueryError).WithError(err))
+			return
+		}
+	}
+
+	if includeMetrics || includeInstrumentation {
+		result.Metrics = m.All()
+	}
+
+	if explainMode != types.ExplainOffV1 {
+		result.Explanation = s.getExplainResponse(explainMode, *buf, pretty)
+	}
+
+	writer.JSON(w, http.StatusOK, result, pretty)
+}
+
 func (s *Server) watchQuery(query string, w http.ResponseWriter, r *http.Request, data bool) {
 	pretty := getBoolParam(r.URL, types.ParamPrettyV1, true)
 	explainMode := getExplain(r.URL.Query()["explain"], types.ExplainOffV1)
@@ -1593,6 +1698,30 @@ func readInputPostV1(r io.ReadCloser) (ast.Value, error) {
 	return nil, nil
 }
 
+func readCompileRequestV1(r io.ReadCloser) (*types.CompileRequestV1, ast.Value, error) {
+
+	var request types.CompileRequestV1
+
+	if err := util.NewJSONDecoder(r).Decode(&request); err != nil {
+		return nil, nil, errors.Wrapf(err, "error(s) occurred while decoding request")
+	}
+
+	if request.Query == "" {
+		return nil, nil, errors.New("missing required 'query' value")
+	}
+
+	if request.Input == nil {
+		return &request, nil, nil
+	}
+
+	input, err := ast.InterfaceToValue(*request.Input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &request, input, nil
+}
+
 func renderBanner(w http.ResponseWriter) {
 	fmt.Fprintln(w, `<pre>
  ________      ________    ________
@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/filter"
 	"github.com/open-policy-agent/opa/plugins"
 	"github.com/open-policy-agent/opa/server/identifier"
 	"github.com/open-policy-agent/opa/server/types"
@@ -135,6 +136,16 @@ func Test405StatusCodev1(t *testing.T) {
 			tr{http.MethodPut, "/query/lvl1", "", 405, ""},
 			tr{http.MethodPatch, "/query/lvl1", "", 405, ""},
 		}},
+		{"v1 compile 405", []tr{
+			tr{http.MethodHead, "/compile", "", 405, ""},
+			tr{http.MethodConnect, "/compile", "", 405, ""},
+			tr{http.MethodDelete, "/compile", "", 405, ""},
+			tr{http.MethodGet, "/compile", "", 405, ""},
+			tr{http.MethodOptions, "/compile", "", 405, ""},
+			tr{http.MethodTrace, "/compile", "", 405, ""},
+			tr{http.MethodPut, "/compile", "", 405, ""},
+			tr{http.MethodPatch, "/compile", "", 405, ""},
+		}},
 		{"v1 query 405", []tr{
 			tr{http.MethodHead, "/query", "", 405, ""},
 			tr{http.MethodConnect, "/query", "", 405, ""},
@@ -1984,6 +1995,105 @@ func TestQueryV1(t *testing.T) {
 	}
 }
 
+func TestCompileV1(t *testing.T) {
+	f := newFixture(t)
+
+	module := `package test
+
+	allow { data.posts[x].owner = input.user }
+	allow { data.posts[x].likes > 10 }
+	`
+
+	if err := f.v1(http.MethodPut, "/policies/test", module, 200, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		note string
+		body string
+		code int
+		sql  string
+		args []interface{}
+	}{
+		{
+			note: "partial",
+			body: `{"query": "data.test.allow = true", "input": {"user": "bob"}, "unknowns": ["data.posts"]}`,
+			code: 200,
+		},
+		{
+			note: "translate",
+			body: `{"query": "data.test.allow = true", "input": {"user": "bob"}, "unknowns": ["data.posts"],
+				"translate": "sql", "mapping": {"data.posts": {"name": "posts"}}}`,
+			code: 200,
+			sql:  "(posts.owner = ? OR posts.likes > ?)",
+			args: []interface{}{"bob", json.Number("10")},
+		},
+		{
+			note: "missing query",
+			body: `{"input": {"user": "bob"}}`,
+			code: 400,
+		},
+		{
+			note: "bad query",
+			body: `{"query": "data.test.allow = "}`,
+			code: 400,
+		},
+		{
+			note: "translate error",
+			body: `{"query": "data.test.allow = true", "unknowns": ["data.posts"], "translate": "sql"}`,
+			code: 400,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			f.reset()
+			f.server.Handler.ServeHTTP(f.recorder, newReqV1(http.MethodPost, "/compile", tc.body))
+
+			if f.recorder.Code != tc.code {
+				t.Fatalf("Expected code %v but got: %v", tc.code, f.recorder)
+			}
+
+			if tc.code != 200 {
+				return
+			}
+
+			var result struct {
+				Result struct {
+					Queries []interface{} `json:"queries"`
+					Filter  *struct {
+						SQL filter.SQLResult `json:"sql"`
+					} `json:"filter"`
+				} `json:"result"`
+			}
+
+			if err := util.NewJSONDecoder(f.recorder.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(result.Result.Queries) != 2 {
+				t.Fatalf("Expected 2 queries but got: %v", result.Result.Queries)
+			}
+
+			if tc.sql == "" {
+				if result.Result.Filter != nil {
+					t.Fatalf("Expected no filter but got: %v", result.Result.Filter)
+				}
+				return
+			}
+
+			if result.Result.Filter == nil {
+				t.Fatal("Expected filter")
+			}
+
+			sql := result.Result.Filter.SQL
+			if sql.Where != tc.sql || !reflect.DeepEqual(sql.Args, tc.args) {
+				t.Fatalf("Expected %v %v but got: %v %v", tc.sql, tc.args, sql.Where, sql.Args)
+			}
+		})
+	}
+}
+
 func TestUnversionedPost(t *testing.T) {
 
 	f := newFixture(t)
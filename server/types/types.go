@@ -12,6 +12,7 @@ import (
 	"strings"
 
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/filter"
 	"github.com/open-policy-agent/opa/topdown"
 	"github.com/open-policy-agent/opa/util"
 )
@@ -70,11 +71,13 @@ func (e *ErrorV1) Bytes() []byte {
 const (
 	MsgCompileModuleError         = "error(s) occurred while compiling module(s)"
 	MsgCompileQueryError          = "error(s) occurred while compiling query"
+	MsgParseQueryError            = "error(s) occurred while parsing query"
 	MsgEvaluationError            = "error(s) occurred while evaluating query"
 	MsgUnauthorizedUndefinedError = "authorization policy missing or undefined"
 	MsgUnauthorizedError          = "request rejected by administrative policy"
 	MsgUndefinedError             = "document missing or undefined"
 	MsgDiagnosticsDisabled        = "diagnostics are not enabled"
+	MsgTranslateQueryError        = "error(s) occurred while translating query"
 )
 
 // PatchV1 models a single patch operation against a document.
@@ -159,6 +162,31 @@ type QueryResponseV1 struct {
 	Result      AdhocQueryResultSetV1 `json:"result,omitempty"`
 }
 
+// CompileRequestV1 models the request message for Compile API operations.
+type CompileRequestV1 struct {
+	Query     string         `json:"query"`
+	Input     *interface{}   `json:"input"`
+	Unknowns  *[]string      `json:"unknowns"`
+	Translate string         `json:"translate,omitempty"`
+	Mapping   filter.Mapping `json:"mapping,omitempty"`
+}
+
+// CompileResponseV1 models the response message for Compile API operations.
+type CompileResponseV1 struct {
+	Explanation TraceV1          `json:"explanation,omitempty"`
+	Metrics     MetricsV1        `json:"metrics,omitempty"`
+	Result      *CompileResultV1 `json:"result,omitempty"`
+}
+
+// CompileResultV1 models the partially evaluated queries and support modules
+// returned by the Compile API. If a translation target was requested, Filter
+// contains the translated queries.
+type CompileResultV1 struct {
+	Queries []ast.Body     `json:"queries,omitempty"`
+	Support []*ast.Module  `json:"support,omitempty"`
+	Filter  *filter.Result `json:"filter,omitempty"`
+}
+
 // WatchResponseV1 models a message in the response stream for a watch.
 type WatchResponseV1 struct {
 	Explanation TraceV1     `json:"explanation,omitempty"`
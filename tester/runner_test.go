@@ -22,6 +22,7 @@ func TestRun(t *testing.T) {
 	files := map[string]string{
 		"/a.rego": `package foo
 			allow { true }
+			status = http.send({"method": "get", "url": "http://example.com"}) { true }
 			`,
 		"/a_test.rego": `package foo
 			test_pass { allow }
@@ -31,6 +32,8 @@ func TestRun(t *testing.T) {
 			test_err { conflict }
 			conflict = true
 			conflict = false
+			mock_send(req) = {"status_code": 418} { true }
+			test_mock { status.status_code == 418 with http.send as mock_send }
 			`,
 	}
 
@@ -42,6 +45,7 @@ func TestRun(t *testing.T) {
 		{"data.foo", "test_fail"}:          {false, true},
 		{"data.foo", "test_fail_non_bool"}: {false, true},
 		{"data.foo", "test_err"}:           {true, false},
+		{"data.foo", "test_mock"}:          {false, false},
 	}
 
 	test.WithTempFS(files, func(d string) {
@@ -154,6 +154,47 @@ func builtinSort(a ast.Value) (ast.Value, error) {
 	return nil, builtins.NewOperandTypeErr(1, a, "set", "array")
 }
 
+func builtinAll(a ast.Value) (ast.Value, error) {
+	switch val := a.(type) {
+	case ast.Set:
+		res := true
+		match := ast.BooleanTerm(true)
+		val.Until(func(term *ast.Term) bool {
+			if !match.Equal(term) {
+				res = false
+				return true
+			}
+			return false
+		})
+		return ast.Boolean(res), nil
+	case ast.Array:
+		for _, term := range val {
+			if !ast.BooleanTerm(true).Equal(term) {
+				return ast.Boolean(false), nil
+			}
+		}
+		return ast.Boolean(true), nil
+	default:
+		return nil, builtins.NewOperandTypeErr(1, a, "array", "set")
+	}
+}
+
+func builtinAny(a ast.Value) (ast.Value, error) {
+	switch val := a.(type) {
+	case ast.Set:
+		return ast.Boolean(val.Contains(ast.BooleanTerm(true))), nil
+	case ast.Array:
+		for _, term := range val {
+			if ast.BooleanTerm(true).Equal(term) {
+				return ast.Boolean(true), nil
+			}
+		}
+		return ast.Boolean(false), nil
+	default:
+		return nil, builtins.NewOperandTypeErr(1, a, "array", "set")
+	}
+}
+
 func init() {
 	RegisterFunctionalBuiltin1(ast.Count.Name, builtinCount)
 	RegisterFunctionalBuiltin1(ast.Sum.Name, builtinSum)
@@ -161,4 +202,6 @@ func init() {
 	RegisterFunctionalBuiltin1(ast.Max.Name, builtinMax)
 	RegisterFunctionalBuiltin1(ast.Min.Name, builtinMin)
 	RegisterFunctionalBuiltin1(ast.Sort.Name, builtinSort)
+	RegisterFunctionalBuiltin1(ast.All.Name, builtinAll)
+	RegisterFunctionalBuiltin1(ast.Any.Name, builtinAny)
 }
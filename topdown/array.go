@@ -0,0 +1,80 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+)
+
+func builtinArrayConcat(a, b ast.Value) (ast.Value, error) {
+	arrA, err := builtins.ArrayOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	arrB, err := builtins.ArrayOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	arrC := make(ast.Array, 0, len(arrA)+len(arrB))
+	arrC = append(arrC, arrA...)
+	arrC = append(arrC, arrB...)
+
+	return arrC, nil
+}
+
+func builtinArraySlice(a, b, c ast.Value) (ast.Value, error) {
+	arr, err := builtins.ArrayOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	startIndex, err := builtins.IntOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	stopIndex, err := builtins.IntOperand(c, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clamp the indices so that slicing never fails.
+	if startIndex < 0 {
+		startIndex = 0
+	}
+
+	if stopIndex > len(arr) {
+		stopIndex = len(arr)
+	}
+
+	if startIndex >= stopIndex {
+		return ast.Array{}, nil
+	}
+
+	return arr[startIndex:stopIndex], nil
+}
+
+func builtinArrayReverse(a ast.Value) (ast.Value, error) {
+	arr, err := builtins.ArrayOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	reversed := make(ast.Array, len(arr))
+	for i := range arr {
+		reversed[len(arr)-1-i] = arr[i]
+	}
+
+	return reversed, nil
+}
+
+func init() {
+	RegisterFunctionalBuiltin2(ast.ArrayConcat.Name, builtinArrayConcat)
+	RegisterFunctionalBuiltin3(ast.ArraySlice.Name, builtinArraySlice)
+	RegisterFunctionalBuiltin1(ast.ArrayReverse.Name, builtinArrayReverse)
+}
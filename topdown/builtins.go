@@ -5,6 +5,7 @@
 package topdown
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/open-policy-agent/opa/ast"
@@ -45,7 +46,8 @@ type (
 	// BuiltinContext contains context from the evaluator that may be used by
 	// built-in functions.
 	BuiltinContext struct {
-		Cache    builtins.Cache
+		Context  context.Context // request context that was passed when query started
+		Cache    builtins.Cache  // built-in function state cache
 		Location *ast.Location
 		Tracer   Tracer
 		QueryID  uint64
@@ -58,6 +60,14 @@ type (
 	// operands and invoke the iteraror for each successful/defined output
 	// value.
 	BuiltinFunc func(bctx BuiltinContext, operands []*ast.Term, iter func(*ast.Term) error) error
+
+	// Builtin represents a built-in function that is supplied to a single
+	// query (as opposed to being registered globally.) The Decl describes the
+	// name and type of the built-in function and Func implements it.
+	Builtin struct {
+		Decl *ast.Builtin
+		Func BuiltinFunc
+	}
 )
 
 // RegisterBuiltinFunc adds a new built-in function to the evaluation engine.
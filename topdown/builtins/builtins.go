@@ -92,6 +92,23 @@ func IntOperand(x ast.Value, pos int) (int, error) {
 	return i, nil
 }
 
+// BigIntOperand converts x to a big int. If the cast fails, a descriptive
+// error is returned.
+func BigIntOperand(x ast.Value, pos int) (*big.Int, error) {
+	n, err := NumberOperand(x, pos)
+	if err != nil {
+		return nil, err
+	}
+
+	f := NumberToFloat(n)
+	if !f.IsInt() {
+		return nil, NewOperandErr(pos, "must be integer number but got floating-point number")
+	}
+
+	i, _ := f.Int(nil)
+	return i, nil
+}
+
 // NumberOperand converts x to a number. If the cast fails, a descriptive error is
 // returned.
 func NumberOperand(x ast.Value, pos int) (ast.Number, error) {
@@ -102,6 +119,16 @@ func NumberOperand(x ast.Value, pos int) (ast.Number, error) {
 	return n, nil
 }
 
+// ArrayOperand converts x to an array. If the cast fails, a descriptive
+// error is returned.
+func ArrayOperand(x ast.Value, pos int) (ast.Array, error) {
+	a, ok := x.(ast.Array)
+	if !ok {
+		return nil, NewOperandTypeErr(pos, x, "array")
+	}
+	return a, nil
+}
+
 // SetOperand converts x to a set. If the cast fails, a descriptive error is
 // returned.
 func SetOperand(x ast.Value, pos int) (ast.Set, error) {
@@ -6,6 +6,7 @@ package topdown
 
 import (
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/util"
 )
 
 type virtualCache struct {
@@ -28,7 +29,7 @@ func (c *virtualCache) Push() {
 }
 
 func (c *virtualCache) Pop() {
-	c.stack = c.stack[:len(c.stack)]
+	c.stack = c.stack[:len(c.stack)-1]
 }
 
 func (c *virtualCache) Get(ref ast.Ref) *ast.Term {
@@ -63,3 +64,85 @@ func newVirtualCacheElem() *virtualCacheElem {
 		children: map[ast.Value]*virtualCacheElem{},
 	}
 }
+
+// comprehensionCache stores the results of indexed comprehensions. The
+// results are grouped by the values of the variables that the comprehension
+// closes over.
+type comprehensionCache struct {
+	stack []map[*ast.Term]*comprehensionCacheElem
+}
+
+type comprehensionCacheElem struct {
+	values    *ast.ValueMap
+	conflicts ast.Set
+}
+
+func newComprehensionCache() *comprehensionCache {
+	cache := &comprehensionCache{}
+	cache.Push()
+	return cache
+}
+
+func (c *comprehensionCache) Push() {
+	c.stack = append(c.stack, map[*ast.Term]*comprehensionCacheElem{})
+}
+
+func (c *comprehensionCache) Pop() {
+	c.stack = c.stack[:len(c.stack)-1]
+}
+
+func (c *comprehensionCache) Elem(term *ast.Term) (*comprehensionCacheElem, bool) {
+	elem, ok := c.stack[len(c.stack)-1][term]
+	return elem, ok
+}
+
+func (c *comprehensionCache) Set(term *ast.Term, elem *comprehensionCacheElem) {
+	c.stack[len(c.stack)-1][term] = elem
+}
+
+func newComprehensionCacheElem() *comprehensionCacheElem {
+	return &comprehensionCacheElem{
+		values:    ast.NewValueMap(),
+		conflicts: ast.NewSet(),
+	}
+}
+
+// functionCache stores the results of calls to user-defined functions. The
+// results are keyed by the function path and the argument values. A nil result
+// indicates the call was undefined.
+type functionCache struct {
+	stack         []*util.HashMap
+	deterministic map[string]bool
+}
+
+func newFunctionCache() *functionCache {
+	cache := &functionCache{
+		deterministic: map[string]bool{},
+	}
+	cache.Push()
+	return cache
+}
+
+func (c *functionCache) Push() {
+	c.stack = append(c.stack, util.NewHashMap(func(a, b util.T) bool {
+		return a.(ast.Value).Compare(b.(ast.Value)) == 0
+	}, func(x util.T) int {
+		return x.(ast.Value).Hash()
+	}))
+}
+
+func (c *functionCache) Pop() {
+	c.stack = c.stack[:len(c.stack)-1]
+}
+
+func (c *functionCache) Get(key ast.Value) (*ast.Term, bool) {
+	result, ok := c.stack[len(c.stack)-1].Get(key)
+	if !ok {
+		return nil, false
+	}
+	return result.(*ast.Term), true
+}
+
+func (c *functionCache) Put(key ast.Value, result *ast.Term) {
+	c.stack[len(c.stack)-1].Put(key, result)
+}
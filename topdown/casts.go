@@ -32,6 +32,55 @@ func builtinToNumber(a ast.Value) (ast.Value, error) {
 	return nil, builtins.NewOperandTypeErr(1, a, "null", "boolean", "number", "string")
 }
 
+func builtinCastArray(a ast.Value) (ast.Value, error) {
+	switch val := a.(type) {
+	case ast.Array:
+		return val, nil
+	case ast.Set:
+		return val.Sorted(), nil
+	}
+	return nil, builtins.NewOperandTypeErr(1, a, "array", "set")
+}
+
+func builtinCastSet(a ast.Value) (ast.Value, error) {
+	switch val := a.(type) {
+	case ast.Array:
+		return ast.NewSet(val...), nil
+	case ast.Set:
+		return val, nil
+	}
+	return nil, builtins.NewOperandTypeErr(1, a, "array", "set")
+}
+
+func builtinCastString(a ast.Value) (ast.Value, error) {
+	switch val := a.(type) {
+	case ast.String:
+		return val, nil
+	}
+	return nil, builtins.NewOperandTypeErr(1, a, "string")
+}
+
+func builtinCastBoolean(a ast.Value) (ast.Value, error) {
+	switch val := a.(type) {
+	case ast.Boolean:
+		return val, nil
+	}
+	return nil, builtins.NewOperandTypeErr(1, a, "boolean")
+}
+
+func builtinCastObject(a ast.Value) (ast.Value, error) {
+	switch val := a.(type) {
+	case ast.Object:
+		return val, nil
+	}
+	return nil, builtins.NewOperandTypeErr(1, a, "object")
+}
+
 func init() {
 	RegisterFunctionalBuiltin1(ast.ToNumber.Name, builtinToNumber)
+	RegisterFunctionalBuiltin1(ast.CastArray.Name, builtinCastArray)
+	RegisterFunctionalBuiltin1(ast.CastSet.Name, builtinCastSet)
+	RegisterFunctionalBuiltin1(ast.CastString.Name, builtinCastString)
+	RegisterFunctionalBuiltin1(ast.CastBoolean.Name, builtinCastBoolean)
+	RegisterFunctionalBuiltin1(ast.CastObject.Name, builtinCastObject)
 }
@@ -0,0 +1,305 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"fmt"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+// copyPropagateQueries simplifies the partially evaluated queries and removes
+// duplicates. The vars are the variables in the original query that must be
+// preserved for the caller. Queries that only differ in the names of the other
+// variables are considered duplicates.
+func copyPropagateQueries(queries []ast.Body, vars ast.VarSet) []ast.Body {
+	result := make([]ast.Body, 0, len(queries))
+	seen := make([]ast.Body, 0, len(queries))
+	for _, query := range queries {
+		query = copyPropagate(query, vars)
+		canonical := canonicalVars(query, vars)
+		if !containsBody(seen, canonical) {
+			result = append(result, query)
+			seen = append(seen, canonical)
+		}
+	}
+	return result
+}
+
+// canonicalVars returns a copy of body where the variables that are not live
+// are renamed in the order they appear.
+func canonicalVars(body ast.Body, live ast.VarSet) ast.Body {
+	names := map[ast.Var]ast.Var{}
+	n := 0
+	ast.WalkVars(body, func(v ast.Var) bool {
+		if _, ok := names[v]; ok || live.Contains(v) {
+			return false
+		}
+		for {
+			name := ast.Var(fmt.Sprintf("%v%d", ast.WildcardPrefix, n))
+			n++
+			if !live.Contains(name) {
+				names[v] = name
+				break
+			}
+		}
+		return false
+	})
+	result, err := ast.TransformVars(body.Copy(), func(v ast.Var) (ast.Value, error) {
+		if name, ok := names[v]; ok {
+			return name, nil
+		}
+		return v, nil
+	})
+	if err != nil {
+		return body
+	}
+	return result.(ast.Body)
+}
+
+// copyPropagateModule simplifies the bodies of the support rules in the module
+// and removes duplicate rules. The variables in the rule heads are preserved.
+func copyPropagateModule(module *ast.Module) {
+	rules := make([]*ast.Rule, 0, len(module.Rules))
+	for _, rule := range module.Rules {
+		vis := ast.NewVarVisitor()
+		ast.Walk(vis, rule.Head)
+		rule.Body = copyPropagate(rule.Body, vis.Vars())
+		if !containsRule(rules, rule) {
+			rules = append(rules, rule)
+		}
+	}
+	module.Rules = rules
+}
+
+// copyPropagate simplifies a partially evaluated query. Equality expressions
+// that bind variables which are not live (i.e., not needed by the caller) are
+// removed and the values are substituted into the remaining expressions. E.g.,
+// "__local0__1 = input.x; __local0__1 > 1" becomes "input.x > 1". Trivial
+// equalities and duplicate expressions are removed afterwards.
+func copyPropagate(body ast.Body, live ast.VarSet) ast.Body {
+
+	exprs := make([]*ast.Expr, 0, len(body))
+	for _, expr := range body.Copy() {
+		if !isTrivialEquality(expr) {
+			exprs = append(exprs, expr)
+		}
+	}
+
+	for {
+		i, v, t := nextCopy(exprs, live)
+		if i < 0 {
+			break
+		}
+		exprs = append(exprs[:i], exprs[i+1:]...)
+		for j := range exprs {
+			exprs[j] = substitute(exprs[j], v, t)
+		}
+	}
+
+	result := ast.NewBody()
+
+	for _, expr := range exprs {
+		if isTrivialEquality(expr) || containsExpr(result, expr) {
+			continue
+		}
+		result.Append(expr)
+	}
+
+	if len(result) == 0 && len(body) > 0 {
+		result.Append(ast.NewExpr(ast.BooleanTerm(true)))
+	}
+
+	return result
+}
+
+// nextCopy returns the index of an equality expression that binds a variable
+// that can be eliminated, the variable and the value bound to it. If no such
+// expression exists, the index is negative.
+func nextCopy(exprs []*ast.Expr, live ast.VarSet) (int, ast.Var, *ast.Term) {
+	for i, expr := range exprs {
+		if expr.Negated || len(expr.With) > 0 || !expr.IsEquality() {
+			continue
+		}
+		a, b := expr.Operand(0), expr.Operand(1)
+		if v, ok := a.Value.(ast.Var); ok && canCopy(exprs, i, live, v, b) {
+			return i, v, b
+		}
+		if v, ok := b.Value.(ast.Var); ok && canCopy(exprs, i, live, v, a) {
+			return i, v, a
+		}
+	}
+	return -1, "", nil
+}
+
+// canCopy returns true if the variable v bound to t by the expression at index
+// i can be replaced by t in the other expressions.
+func canCopy(exprs []*ast.Expr, i int, live ast.VarSet, v ast.Var, t *ast.Term) bool {
+
+	if live.Contains(v) || termVars(t).Contains(v) {
+		return false
+	}
+
+	_, isVar := t.Value.(ast.Var)
+	_, isRef := t.Value.(ast.Ref)
+
+	// The expression asserts that t is defined. The assertion is only
+	// preserved if v is substituted into another expression that is not
+	// negated (outside of closures, which are defined regardless of t.)
+	asserted := isDefined(t)
+
+	// Wildcards in t would be printed as independent variables if t was
+	// substituted for more than one occurrence of v.
+	wildcards := hasWildcard(t)
+	occurrences := 0
+
+	for j, expr := range exprs {
+		if j == i {
+			continue
+		}
+		for _, w := range expr.With {
+			if termVars(w.Target).Contains(v) || termVars(w.Value).Contains(v) {
+				return false
+			}
+		}
+		if !isVar && !isRef && refHeadVars(expr).Contains(v) {
+			return false
+		}
+		if !expr.Negated && exprVarsSkipClosures(expr).Contains(v) {
+			asserted = true
+		}
+		if wildcards {
+			if occurrences += countVar(expr, v); occurrences > 1 {
+				return false
+			}
+		}
+	}
+
+	return asserted
+}
+
+// substitute replaces occurrences of v in expr with t. References with v as
+// the head are concatenated onto t if t is a reference.
+func substitute(expr *ast.Expr, v ast.Var, t *ast.Term) *ast.Expr {
+	result, err := ast.Transform(ast.NewGenericTransformer(func(x interface{}) (interface{}, error) {
+		switch x := x.(type) {
+		case ast.Ref:
+			if head, ok := t.Value.(ast.Ref); ok && x[0].Value.Compare(v) == 0 {
+				return append(head.Copy(), x[1:]...), nil
+			}
+		case ast.Var:
+			if x.Equal(v) {
+				return t.Value, nil
+			}
+		}
+		return x, nil
+	}), expr)
+	if err != nil {
+		return expr
+	}
+	return result.(*ast.Expr)
+}
+
+// isDefined returns true if t is always defined, i.e., t does not contain
+// references or comprehensions.
+func isDefined(t *ast.Term) bool {
+	defined := true
+	ast.WalkTerms(t, func(x *ast.Term) bool {
+		switch x.Value.(type) {
+		case ast.Ref, *ast.ArrayComprehension, *ast.ObjectComprehension, *ast.SetComprehension:
+			defined = false
+		}
+		return !defined
+	})
+	return defined
+}
+
+func isTrivialEquality(expr *ast.Expr) bool {
+	if expr.Negated || len(expr.With) > 0 || !expr.IsEquality() {
+		return false
+	}
+	a, b := expr.Operand(0), expr.Operand(1)
+	return a.Equal(b) && isDefined(a)
+}
+
+func containsBody(bodies []ast.Body, body ast.Body) bool {
+	for _, other := range bodies {
+		if other.Equal(body) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsRule(rules []*ast.Rule, rule *ast.Rule) bool {
+	for _, other := range rules {
+		if other.Equal(rule) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsExpr(body ast.Body, expr *ast.Expr) bool {
+	for _, other := range body {
+		cpy := *expr
+		cpy.Index = other.Index
+		if other.Equal(&cpy) {
+			return true
+		}
+	}
+	return false
+}
+
+func termVars(t *ast.Term) ast.VarSet {
+	vis := ast.NewVarVisitor()
+	ast.Walk(vis, t)
+	return vis.Vars()
+}
+
+func queryVars(query ast.Body) ast.VarSet {
+	vis := ast.NewVarVisitor()
+	ast.Walk(vis, query)
+	return vis.Vars()
+}
+
+func exprVarsSkipClosures(expr *ast.Expr) ast.VarSet {
+	vis := ast.NewVarVisitor().WithParams(ast.VarVisitorParams{
+		SkipClosures: true,
+	})
+	ast.Walk(vis, expr)
+	return vis.Vars()
+}
+
+func countVar(expr *ast.Expr, v ast.Var) int {
+	n := 0
+	ast.WalkVars(expr, func(x ast.Var) bool {
+		if x.Equal(v) {
+			n++
+		}
+		return false
+	})
+	return n
+}
+
+func hasWildcard(t *ast.Term) bool {
+	for v := range termVars(t) {
+		if v.IsWildcard() {
+			return true
+		}
+	}
+	return false
+}
+
+func refHeadVars(expr *ast.Expr) ast.VarSet {
+	result := ast.NewVarSet()
+	ast.WalkRefs(expr, func(ref ast.Ref) bool {
+		if v, ok := ref[0].Value.(ast.Var); ok {
+			result.Add(v)
+		}
+		return false
+	})
+	return result
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+func TestCopyPropagate(t *testing.T) {
+
+	tests := []struct {
+		note     string
+		body     string
+		live     []string
+		expected string
+	}{
+		{
+			note:     "substitute",
+			body:     `x = input.a; y = x; y > 1; z = 1; plus(y, z, w)`,
+			live:     []string{"w"},
+			expected: `input.a > 1; plus(input.a, 1, w)`,
+		},
+		{
+			note:     "closure does not assert definedness",
+			body:     `x = input.a; __l = [1 | x[_]]; count(__l, n); n = 0`,
+			expected: `x = input.a; count([1 | x[_]], 0)`,
+		},
+		{
+			note:     "wildcard single occurrence",
+			body:     `x = input.a[_]; x > 1`,
+			expected: `input.a[_] > 1`,
+		},
+		{
+			note:     "wildcard multiple expressions",
+			body:     `x = input.a[_]; x > 1; x < 5`,
+			expected: `x = input.a[_]; x > 1; x < 5`,
+		},
+		{
+			note:     "wildcard multiple occurrences",
+			body:     `x = input.a[_]; plus(x, x, y)`,
+			live:     []string{"y"},
+			expected: `x = input.a[_]; plus(x, x, y)`,
+		},
+		{
+			note:     "named var multiple expressions",
+			body:     `x = input.a[i]; x > 1; x < 5`,
+			live:     []string{"i"},
+			expected: `input.a[i] > 1; input.a[i] < 5`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			live := ast.NewVarSet()
+			for _, v := range tc.live {
+				live.Add(ast.Var(v))
+			}
+			result := copyPropagate(ast.MustParseBody(tc.body), live)
+			expected := ast.MustParseBody(tc.expected)
+			if result.String() != expected.String() {
+				t.Fatalf("Expected %v but got: %v", expected, result)
+			}
+		})
+	}
+}
@@ -5,39 +5,423 @@
 package topdown
 
 import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+	"time"
 
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown/builtins"
 	"github.com/open-policy-agent/opa/util"
 )
 
 func builtinCryptoX509ParseCertificates(a ast.Value) (ast.Value, error) {
 
-	str, err := builtinBase64Decode(a)
+	str, err := builtins.StringOperand(a, 1)
 	if err != nil {
 		return nil, err
 	}
 
-	certs, err := x509.ParseCertificates([]byte(str.(ast.String)))
+	certs, err := getX509CertsFromString(string(str))
 	if err != nil {
 		return nil, err
 	}
 
-	bs, err := json.Marshal(certs)
+	return certsToValue(certs)
+}
+
+func builtinCryptoX509ParseAndVerifyCertificates(a, b, c ast.Value) (ast.Value, error) {
+
+	str, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	rootsStr, err := builtins.StringOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := builtins.ObjectOperand(c, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := getX509VerifyOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	invalid := ast.Array{ast.BooleanTerm(false), ast.ArrayTerm()}
+
+	certs, err := getX509CertsFromString(string(str))
+	if err != nil || len(certs) == 0 {
+		return invalid, nil
+	}
+
+	roots, err := getX509CertsFromString(string(rootsStr))
+	if err != nil {
+		return nil, builtins.NewOperandErr(2, "must contain valid root certificates: %v", err)
+	} else if len(roots) == 0 {
+		return nil, builtins.NewOperandErr(2, "must contain at least one root certificate")
+	}
+
+	opts.Roots = x509.NewCertPool()
+	for _, root := range roots {
+		opts.Roots.AddCert(root)
+	}
+
+	opts.Intermediates = x509.NewCertPool()
+	for _, intermediate := range certs[1:] {
+		opts.Intermediates.AddCert(intermediate)
+	}
+
+	if _, err := certs[0].Verify(opts); err != nil {
+		return invalid, nil
+	}
+
+	value, err := certsToValue(certs)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.Array{ast.BooleanTerm(true), ast.NewTerm(value)}, nil
+}
+
+var x509KeyUsages = map[string]x509.ExtKeyUsage{
+	"KeyUsageAny":             x509.ExtKeyUsageAny,
+	"KeyUsageServerAuth":      x509.ExtKeyUsageServerAuth,
+	"KeyUsageClientAuth":      x509.ExtKeyUsageClientAuth,
+	"KeyUsageCodeSigning":     x509.ExtKeyUsageCodeSigning,
+	"KeyUsageEmailProtection": x509.ExtKeyUsageEmailProtection,
+	"KeyUsageIPSECEndSystem":  x509.ExtKeyUsageIPSECEndSystem,
+	"KeyUsageIPSECTunnel":     x509.ExtKeyUsageIPSECTunnel,
+	"KeyUsageIPSECUser":       x509.ExtKeyUsageIPSECUser,
+	"KeyUsageTimeStamping":    x509.ExtKeyUsageTimeStamping,
+	"KeyUsageOCSPSigning":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// getX509VerifyOptions returns the verification options from the options
+// object. If no key usages are given, any key usage is accepted.
+func getX509VerifyOptions(options ast.Object) (x509.VerifyOptions, error) {
+
+	opts := x509.VerifyOptions{
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+
+	err := options.Iter(func(k, v *ast.Term) error {
+		key, ok := k.Value.(ast.String)
+		if !ok {
+			return builtins.NewOperandErr(3, "must be object with string keys but got %v key", ast.TypeName(k.Value))
+		}
+		switch key {
+		case "current_time":
+			n, err := builtins.NumberOperand(v.Value, 3)
+			if err != nil {
+				return err
+			}
+			i64, acc := builtins.NumberToFloat(n).Int64()
+			if acc != big.Exact {
+				return builtins.NewOperandErr(3, "must contain integer \"current_time\" nanoseconds")
+			}
+			opts.CurrentTime = time.Unix(0, i64).UTC()
+		case "dns_name":
+			s, err := builtins.StringOperand(v.Value, 3)
+			if err != nil {
+				return err
+			}
+			opts.DNSName = string(s)
+		case "key_usages":
+			arr, ok := v.Value.(ast.Array)
+			if !ok {
+				return builtins.NewOperandErr(3, "must contain array \"key_usages\" but got %v", ast.TypeName(v.Value))
+			}
+			opts.KeyUsages = nil
+			for i := range arr {
+				s, ok := arr[i].Value.(ast.String)
+				if !ok {
+					return builtins.NewOperandElementErr(3, arr, arr[i].Value, "string")
+				}
+				usage, ok := x509KeyUsages[string(s)]
+				if !ok {
+					return builtins.NewOperandErr(3, "must contain known key usages but got %v", s)
+				}
+				opts.KeyUsages = append(opts.KeyUsages, usage)
+			}
+		default:
+			return builtins.NewOperandErr(3, "must contain only keys {current_time, dns_name, key_usages} but got %v", key)
+		}
+		return nil
+	})
+
+	return opts, err
+}
+
+func builtinCryptoX509ParseCertificateRequest(a ast.Value) (ast.Value, error) {
+
+	str, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	bs, err := getDERFromString(string(str), "CERTIFICATE REQUEST")
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := x509.ParseCertificateRequest(bs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := csr.CheckSignature(); err != nil {
+		return nil, err
+	}
+
+	return jsonToValue(csr)
+}
+
+func builtinCryptoParsePrivateKeys(a ast.Value) (ast.Value, error) {
+
+	str, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	result := ast.Array{}
+	rest := []byte(str)
+
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		var key interface{}
+
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		jwk, err := privateKeyToJWK(key)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, ast.NewTerm(jwk))
+	}
+
+	return result, nil
+}
+
+// privateKeyToJWK converts the private key into a JSON Web Key (RFC 7517)
+// object.
+func privateKeyToJWK(key interface{}) (ast.Value, error) {
+
+	enc := func(i *big.Int, size int) *ast.Term {
+		bs := i.Bytes()
+		if len(bs) < size {
+			bs = append(make([]byte, size-len(bs)), bs...)
+		}
+		return ast.StringTerm(base64.RawURLEncoding.EncodeToString(bs))
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		key.Precompute()
+		return ast.NewObject(
+			ast.Item(ast.StringTerm("kty"), ast.StringTerm("RSA")),
+			ast.Item(ast.StringTerm("n"), enc(key.N, 0)),
+			ast.Item(ast.StringTerm("e"), enc(big.NewInt(int64(key.E)), 0)),
+			ast.Item(ast.StringTerm("d"), enc(key.D, 0)),
+			ast.Item(ast.StringTerm("p"), enc(key.Primes[0], 0)),
+			ast.Item(ast.StringTerm("q"), enc(key.Primes[1], 0)),
+			ast.Item(ast.StringTerm("dp"), enc(key.Precomputed.Dp, 0)),
+			ast.Item(ast.StringTerm("dq"), enc(key.Precomputed.Dq, 0)),
+			ast.Item(ast.StringTerm("qi"), enc(key.Precomputed.Qinv, 0)),
+		), nil
+	case *ecdsa.PrivateKey:
+		params := key.Curve.Params()
+		size := (params.BitSize + 7) / 8
+		return ast.NewObject(
+			ast.Item(ast.StringTerm("kty"), ast.StringTerm("EC")),
+			ast.Item(ast.StringTerm("crv"), ast.StringTerm(params.Name)),
+			ast.Item(ast.StringTerm("x"), enc(key.X, size)),
+			ast.Item(ast.StringTerm("y"), enc(key.Y, size)),
+			ast.Item(ast.StringTerm("d"), enc(key.D, size)),
+		), nil
+	}
+
+	return nil, fmt.Errorf("unsupported private key type %T", key)
+}
+
+// getX509CertsFromString returns the certificates contained in str. The
+// certificates may be PEM encoded or base64 encoded DER certificates that
+// have been concatenated.
+func getX509CertsFromString(str string) ([]*x509.Certificate, error) {
+	bs, err := getDERFromString(str, "CERTIFICATE")
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificates(bs)
+}
+
+// getDERFromString returns the DER bytes from str which is either PEM
+// encoded (only blocks of the given type are used) or base64 encoded.
+func getDERFromString(str string, blockType string) ([]byte, error) {
+
+	if !strings.HasPrefix(strings.TrimSpace(str), "-----BEGIN") {
+		return base64.StdEncoding.DecodeString(str)
+	}
+
+	var result []byte
+	rest := []byte(str)
+
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == blockType {
+			result = append(result, block.Bytes...)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no %v PEM blocks found", strings.ToLower(blockType))
+	}
+
+	return result, nil
+}
+
+func certsToValue(certs []*x509.Certificate) (ast.Value, error) {
+	return jsonToValue(certs)
+}
+
+func jsonToValue(x interface{}) (ast.Value, error) {
+
+	bs, err := json.Marshal(x)
+	if err != nil {
+		return nil, err
+	}
+
+	var y interface{}
+
+	if err := util.UnmarshalJSON(bs, &y); err != nil {
+		return nil, err
+	}
+
+	return ast.InterfaceToValue(y)
+}
+
+func hashHelper(a ast.Value, h func(ast.String) string) (ast.Value, error) {
+	s, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+	return ast.String(h(s)), nil
+}
+
+func builtinCryptoMd5(a ast.Value) (ast.Value, error) {
+	return hashHelper(a, func(s ast.String) string { return hex.EncodeToString(hashBytes(md5.New(), []byte(s))) })
+}
+
+func builtinCryptoSha1(a ast.Value) (ast.Value, error) {
+	return hashHelper(a, func(s ast.String) string { return hex.EncodeToString(hashBytes(sha1.New(), []byte(s))) })
+}
+
+func builtinCryptoSha256(a ast.Value) (ast.Value, error) {
+	return hashHelper(a, func(s ast.String) string { return hex.EncodeToString(hashBytes(sha256.New(), []byte(s))) })
+}
+
+func hashBytes(h hash.Hash, bs []byte) []byte {
+	h.Write(bs)
+	return h.Sum(nil)
+}
+
+func hmacHelper(a, b ast.Value, h func() hash.Hash) (ast.Value, error) {
+	message, err := builtins.StringOperand(a, 1)
 	if err != nil {
 		return nil, err
 	}
 
-	var x interface{}
+	key, err := builtins.StringOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(h, []byte(key))
+	mac.Write([]byte(message))
+	return ast.String(hex.EncodeToString(mac.Sum(nil))), nil
+}
+
+func builtinCryptoHmacMd5(a, b ast.Value) (ast.Value, error) {
+	return hmacHelper(a, b, md5.New)
+}
+
+func builtinCryptoHmacSha1(a, b ast.Value) (ast.Value, error) {
+	return hmacHelper(a, b, sha1.New)
+}
 
-	if err := util.UnmarshalJSON(bs, &x); err != nil {
+func builtinCryptoHmacSha256(a, b ast.Value) (ast.Value, error) {
+	return hmacHelper(a, b, sha256.New)
+}
+
+func builtinCryptoHmacSha512(a, b ast.Value) (ast.Value, error) {
+	return hmacHelper(a, b, sha512.New)
+}
+
+func builtinCryptoHmacEqual(a, b ast.Value) (ast.Value, error) {
+	mac1, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	mac2, err := builtins.StringOperand(b, 2)
+	if err != nil {
 		return nil, err
 	}
 
-	return ast.InterfaceToValue(x)
+	return ast.Boolean(hmac.Equal([]byte(mac1), []byte(mac2))), nil
 }
 
 func init() {
 	RegisterFunctionalBuiltin1(ast.CryptoX509ParseCertificates.Name, builtinCryptoX509ParseCertificates)
+	RegisterFunctionalBuiltin3(ast.CryptoX509ParseAndVerifyCertificates.Name, builtinCryptoX509ParseAndVerifyCertificates)
+	RegisterFunctionalBuiltin1(ast.CryptoX509ParseCertificateRequest.Name, builtinCryptoX509ParseCertificateRequest)
+	RegisterFunctionalBuiltin1(ast.CryptoParsePrivateKeys.Name, builtinCryptoParsePrivateKeys)
+	RegisterFunctionalBuiltin1(ast.CryptoMd5.Name, builtinCryptoMd5)
+	RegisterFunctionalBuiltin1(ast.CryptoSha1.Name, builtinCryptoSha1)
+	RegisterFunctionalBuiltin1(ast.CryptoSha256.Name, builtinCryptoSha256)
+	RegisterFunctionalBuiltin2(ast.CryptoHmacMd5.Name, builtinCryptoHmacMd5)
+	RegisterFunctionalBuiltin2(ast.CryptoHmacSha1.Name, builtinCryptoHmacSha1)
+	RegisterFunctionalBuiltin2(ast.CryptoHmacSha256.Name, builtinCryptoHmacSha256)
+	RegisterFunctionalBuiltin2(ast.CryptoHmacSha512.Name, builtinCryptoHmacSha512)
+	RegisterFunctionalBuiltin2(ast.CryptoHmacEqual.Name, builtinCryptoHmacEqual)
 }
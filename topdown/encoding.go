@@ -7,8 +7,11 @@ package topdown
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"sort"
 	"strings"
 
 	ghodss "github.com/ghodss/yaml"
@@ -102,6 +105,171 @@ func builtinBase64UrlDecode(a ast.Value) (ast.Value, error) {
 	return ast.String(result), err
 }
 
+func builtinBase64UrlEncodeNoPad(a ast.Value) (ast.Value, error) {
+	str, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.String(base64.RawURLEncoding.EncodeToString([]byte(str))), nil
+}
+
+func builtinURLQueryEncode(a ast.Value) (ast.Value, error) {
+	str, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.String(url.QueryEscape(string(str))), nil
+}
+
+func builtinURLQueryDecode(a ast.Value) (ast.Value, error) {
+	str, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := url.QueryUnescape(string(str))
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.String(s), nil
+}
+
+func builtinURLQueryEncodeObject(a ast.Value) (ast.Value, error) {
+	obj, err := builtins.ObjectOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+
+	err = obj.Iter(func(k, v *ast.Term) error {
+		key, ok := k.Value.(ast.String)
+		if !ok {
+			return builtins.NewOperandErr(1, "must be object with string keys but got %v key", ast.TypeName(k.Value))
+		}
+
+		switch v := v.Value.(type) {
+		case ast.String:
+			query.Add(string(key), string(v))
+		case ast.Array:
+			for i := range v {
+				s, ok := v[i].Value.(ast.String)
+				if !ok {
+					return builtins.NewOperandElementErr(1, v, v[i].Value, "string")
+				}
+				query.Add(string(key), string(s))
+			}
+		case ast.Set:
+			return v.Iter(func(t *ast.Term) error {
+				s, ok := t.Value.(ast.String)
+				if !ok {
+					return builtins.NewOperandElementErr(1, v, t.Value, "string")
+				}
+				query.Add(string(key), string(s))
+				return nil
+			})
+		default:
+			return builtins.NewOperandErr(1, "must contain string, array or set values but got %v", ast.TypeName(v))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.String(query.Encode()), nil
+}
+
+func builtinURLQueryDecodeObject(a ast.Value) (ast.Value, error) {
+	str, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := url.ParseQuery(string(str))
+	if err != nil {
+		return nil, err
+	}
+
+	return queryToObject(query), nil
+}
+
+func builtinHexEncode(a ast.Value) (ast.Value, error) {
+	str, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.String(hex.EncodeToString([]byte(str))), nil
+}
+
+func builtinHexDecode(a ast.Value) (ast.Value, error) {
+	str, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	bs, err := hex.DecodeString(string(str))
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.String(bs), nil
+}
+
+func builtinParseURL(a ast.Value) (ast.Value, error) {
+	str, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(string(str))
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.NewObject(
+		ast.Item(ast.StringTerm("scheme"), ast.StringTerm(u.Scheme)),
+		ast.Item(ast.StringTerm("host"), ast.StringTerm(u.Hostname())),
+		ast.Item(ast.StringTerm("port"), ast.StringTerm(u.Port())),
+		ast.Item(ast.StringTerm("path"), ast.StringTerm(u.Path)),
+		ast.Item(ast.StringTerm("raw_query"), ast.StringTerm(u.RawQuery)),
+		ast.Item(ast.StringTerm("query"), ast.NewTerm(queryToObject(query))),
+		ast.Item(ast.StringTerm("fragment"), ast.StringTerm(u.Fragment)),
+	), nil
+}
+
+// queryToObject returns an object that maps each query parameter to the array
+// of its values.
+func queryToObject(query url.Values) ast.Object {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	obj := ast.NewObject()
+	for _, k := range keys {
+		values := make(ast.Array, len(query[k]))
+		for i := range query[k] {
+			values[i] = ast.StringTerm(query[k][i])
+		}
+		obj.Insert(ast.StringTerm(k), ast.NewTerm(values))
+	}
+
+	return obj
+}
+
 func builtinYAMLMarshal(a ast.Value) (ast.Value, error) {
 
 	asJSON, err := ast.JSON(a)
@@ -153,6 +321,14 @@ func init() {
 	RegisterFunctionalBuiltin1(ast.Base64Decode.Name, builtinBase64Decode)
 	RegisterFunctionalBuiltin1(ast.Base64UrlEncode.Name, builtinBase64UrlEncode)
 	RegisterFunctionalBuiltin1(ast.Base64UrlDecode.Name, builtinBase64UrlDecode)
+	RegisterFunctionalBuiltin1(ast.Base64UrlEncodeNoPad.Name, builtinBase64UrlEncodeNoPad)
+	RegisterFunctionalBuiltin1(ast.URLQueryEncode.Name, builtinURLQueryEncode)
+	RegisterFunctionalBuiltin1(ast.URLQueryDecode.Name, builtinURLQueryDecode)
+	RegisterFunctionalBuiltin1(ast.URLQueryEncodeObject.Name, builtinURLQueryEncodeObject)
+	RegisterFunctionalBuiltin1(ast.URLQueryDecodeObject.Name, builtinURLQueryDecodeObject)
+	RegisterFunctionalBuiltin1(ast.HexEncode.Name, builtinHexEncode)
+	RegisterFunctionalBuiltin1(ast.HexDecode.Name, builtinHexDecode)
+	RegisterFunctionalBuiltin1(ast.ParseURL.Name, builtinParseURL)
 	RegisterFunctionalBuiltin1(ast.YAMLMarshal.Name, builtinYAMLMarshal)
 	RegisterFunctionalBuiltin1(ast.YAMLUnmarshal.Name, builtinYAMLUnmarshal)
 }
@@ -24,27 +24,69 @@ func (f *queryIDFactory) Next() uint64 {
 	return f.curr
 }
 
+// earlyExitError is returned by an iterator to stop evaluation once further
+// results cannot change the outcome. It is caught by the caller that owns the
+// eval it refers to.
+type earlyExitError struct {
+	e *eval
+}
+
+func (ee *earlyExitError) Error() string {
+	return "<early exit>"
+}
+
+// isEarlyExit returns true if err was raised to stop the evaluation of e.
+func isEarlyExit(err error, e *eval) bool {
+	ee, ok := err.(*earlyExitError)
+	return ok && ee.e == e
+}
+
+// deferEarlyExit returns an iterator that records early exits raised by iter
+// instead of returning them. Rules that check their results for conflicts use
+// it so that callers stopping early do not hide conflicts.
+func deferEarlyExit(iter unifyIterator, exit *error) unifyIterator {
+	return func() error {
+		if *exit != nil {
+			return nil
+		}
+		err := iter()
+		if _, ok := err.(*earlyExitError); ok {
+			*exit = err
+			return nil
+		}
+		return err
+	}
+}
+
 type eval struct {
-	ctx           context.Context
-	queryID       uint64
-	queryIDFact   *queryIDFactory
-	parent        *eval
-	cancel        Cancel
-	query         ast.Body
-	bindings      *bindings
-	store         storage.Store
-	txn           storage.Transaction
-	compiler      *ast.Compiler
-	input         *ast.Term
-	tracer        Tracer
-	instr         *Instrumentation
-	builtinCache  builtins.Cache
-	virtualCache  *virtualCache
-	saveSet       *saveSet
-	saveStack     *saveStack
-	saveSupport   *saveSupport
-	saveNamespace *ast.Term
-	genvarprefix  string
+	ctx             context.Context
+	queryID         uint64
+	queryIDFact     *queryIDFactory
+	parent          *eval
+	cancel          Cancel
+	query           ast.Body
+	index           int
+	bindings        *bindings
+	store           storage.Store
+	txn             storage.Transaction
+	compiler        *ast.Compiler
+	input           *ast.Term
+	functionMocks   *ast.ValueMap
+	tracer          Tracer
+	instr           *Instrumentation
+	builtinCache    builtins.Cache
+	virtualCache    *virtualCache
+	compCache       *comprehensionCache
+	funcCache       *functionCache
+	saveSet         *saveSet
+	saveStack       *saveStack
+	saveSupport     *saveSupport
+	saveNamespace   *ast.Term
+	disableInlining []ast.Ref
+	shallowInlining bool
+	genvarprefix    string
+	builtins        map[string]*Builtin
+	earlyExit       bool
 }
 
 func (e *eval) Run(iter evalIterator) error {
@@ -78,6 +120,58 @@ func (e *eval) partial() bool {
 	return e.saveSet != nil
 }
 
+// inliningDisabled returns true if the virtual document referred to by ref
+// should not be inlined during partial evaluation.
+func (e *eval) inliningDisabled(ref ast.Ref) bool {
+	for _, path := range e.disableInlining {
+		if ref.HasPrefix(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// dependsOnUnknowns returns true if the rules refer to values that are unknown
+// during partial evaluation, either directly or through the rules they depend
+// on.
+func (e *eval) dependsOnUnknowns(ir *ast.IndexResult) bool {
+
+	visited := map[*ast.Rule]struct{}{}
+	stack := append([]*ast.Rule{}, ir.Rules...)
+	if ir.Default != nil {
+		stack = append(stack, ir.Default)
+	}
+
+	for len(stack) > 0 {
+		rule := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if _, ok := visited[rule]; ok {
+			continue
+		}
+
+		visited[rule] = struct{}{}
+		found := false
+
+		ast.WalkRefs(rule, func(ref ast.Ref) bool {
+			if !found && ast.RootDocumentNames.Contains(ref[0]) && e.saveSet.Contains(ast.NewTerm(ref)) {
+				found = true
+			}
+			return found
+		})
+
+		if found {
+			return true
+		}
+
+		for dep := range e.compiler.Graph.Dependencies(rule) {
+			stack = append(stack, dep.(*ast.Rule))
+		}
+	}
+
+	return false
+}
+
 func (e *eval) traceEnter(x interface{}) {
 	e.traceEvent(EnterOp, x)
 }
@@ -150,19 +244,28 @@ func (e *eval) evalExpr(index int, iter evalIterator) error {
 		return iter(e)
 	}
 
+	prev := e.index
+	e.index = index
+
 	expr := e.query[index]
 	e.traceEval(expr)
 
+	var err error
+
 	if len(expr.With) > 0 {
 		if e.partial() {
-			return e.saveExpr(expr, e.bindings, func() error {
+			err = e.saveExpr(expr, e.bindings, func() error {
 				return e.evalExpr(index+1, iter)
 			})
+		} else {
+			err = e.evalWith(index, iter)
 		}
-		return e.evalWith(index, iter)
+	} else {
+		err = e.evalStep(index, iter)
 	}
 
-	return e.evalStep(index, iter)
+	e.index = prev
+	return err
 }
 
 func (e *eval) evalStep(index int, iter evalIterator) error {
@@ -198,6 +301,9 @@ func (e *eval) evalStep(index int, iter evalIterator) error {
 						break
 					}
 				}
+				if b, ok := e.builtins[terms[0].String()]; ok && b.Decl.Nondeterministic {
+					mustSave = true
+				}
 				if mustSave || e.saveSet.ContainsRecursiveAny(plugSlice(terms[1:], e.bindings)) {
 					return e.saveCall(terms[0], terms[1:len(terms)-1], terms[len(terms)-1], func() error {
 						return e.evalExpr(index+1, iter)
@@ -275,29 +381,74 @@ func (e *eval) evalNot(index int, iter evalIterator) error {
 func (e *eval) evalWith(index int, iter evalIterator) error {
 
 	expr := e.query[index]
-	pairs := make([][2]*ast.Term, len(expr.With))
+	pairs := make([][2]*ast.Term, 0, len(expr.With))
+	mocks := e.functionMocks
 
 	for i := range expr.With {
+		target := expr.With[i].Target
 		plugged := e.bindings.Plug(expr.With[i].Value)
-		pairs[i] = [...]*ast.Term{expr.With[i].Target, plugged}
+		if ref, ok := target.Value.(ast.Ref); ok && !ref.HasPrefix(ast.InputRootRef) {
+			if mocks == e.functionMocks {
+				mocks = copyFunctionMocks(mocks)
+			}
+			mocks.Put(ref, plugged.Value)
+			continue
+		}
+		pairs = append(pairs, [...]*ast.Term{target, plugged})
 	}
 
-	input, err := makeInput(pairs)
-	if err != nil {
-		return &Error{
-			Code:     ConflictErr,
-			Location: expr.Location,
-			Message:  err.Error(),
+	input := e.input
+
+	if len(pairs) > 0 {
+		value, err := makeInput(pairs)
+		if err != nil {
+			return &Error{
+				Code:     ConflictErr,
+				Location: expr.Location,
+				Message:  err.Error(),
+			}
 		}
-	}
+		input = ast.NewTerm(value)
+	}
+
+	// The replacements only apply to this expression so the expression is
+	// evaluated in a closure and subsequent expressions are evaluated by e.
+	noWith := *expr
+	noWith.With = nil
+	child := e.closure(ast.NewBody(&noWith))
+	child.input = input
+	child.functionMocks = mocks
+
+	e.pushCaches()
+	err := child.evalStep(0, func(*eval) error {
+		e.popCaches()
+		err := e.evalExpr(index+1, iter)
+		e.pushCaches()
+		return err
+	})
+	e.popCaches()
+	return err
+}
 
-	old := e.input
-	e.input = ast.NewTerm(input)
+// pushCaches isolates cached values computed while the with keyword replaces
+// the input document or functions.
+func (e *eval) pushCaches() {
 	e.virtualCache.Push()
-	err = e.evalStep(index, iter)
+	e.compCache.Push()
+	e.funcCache.Push()
+}
+
+func (e *eval) popCaches() {
 	e.virtualCache.Pop()
-	e.input = old
-	return err
+	e.compCache.Pop()
+	e.funcCache.Pop()
+}
+
+func copyFunctionMocks(mocks *ast.ValueMap) *ast.ValueMap {
+	if mocks == nil {
+		return ast.NewValueMap()
+	}
+	return mocks.Copy()
 }
 
 func (e *eval) evalNotPartial(index int, iter evalIterator) error {
@@ -373,6 +524,36 @@ func (e *eval) evalCall(index int, operator *ast.Term, terms []*ast.Term, iter u
 
 	ref := operator.Value.(ast.Ref)
 
+	if e.functionMocks != nil {
+		if mock := e.functionMocks.Get(ref); mock != nil {
+			return e.evalCallMock(index, ref, mock, terms, iter)
+		}
+	}
+
+	return e.evalCallRef(index, ref, terms, iter)
+}
+
+// evalCallMock evaluates a call to a function that has been replaced with the
+// with keyword. The replacement is either another function or the value that
+// the call evaluates to.
+func (e *eval) evalCallMock(index int, ref ast.Ref, mock ast.Value, terms []*ast.Term, iter unifyIterator) error {
+
+	if r, ok := mock.(ast.Ref); ok && e.compiler.GetArity(r) >= 0 {
+		return e.evalCallRef(index, r, terms, iter)
+	}
+
+	if len(terms) == e.compiler.GetArity(ref) {
+		if mock.Compare(ast.Boolean(false)) != 0 {
+			return iter()
+		}
+		return nil
+	}
+
+	return e.unify(terms[len(terms)-1], ast.NewTerm(mock), iter)
+}
+
+func (e *eval) evalCallRef(index int, ref ast.Ref, terms []*ast.Term, iter unifyIterator) error {
+
 	if ref[0].Equal(ast.DefaultRootDocument) {
 		eval := evalFunc{
 			e:     e,
@@ -382,14 +563,20 @@ func (e *eval) evalCall(index int, operator *ast.Term, terms []*ast.Term, iter u
 		return eval.eval(iter)
 	}
 
-	bi := ast.BuiltinMap[ref.String()]
-	if bi == nil {
-		return unsupportedBuiltinErr(e.query[index].Location)
-	}
+	var bi *ast.Builtin
+	var f BuiltinFunc
 
-	f := builtinFunctions[bi.Name]
-	if f == nil {
-		return unsupportedBuiltinErr(e.query[index].Location)
+	if b, ok := e.builtins[ref.String()]; ok {
+		bi, f = b.Decl, b.Func
+	} else {
+		bi = ast.BuiltinMap[ref.String()]
+		if bi == nil {
+			return unsupportedBuiltinErr(e.query[index].Location)
+		}
+		f = builtinFunctions[bi.Name]
+		if f == nil {
+			return unsupportedBuiltinErr(e.query[index].Location)
+		}
 	}
 
 	var parentID uint64
@@ -398,6 +585,7 @@ func (e *eval) evalCall(index int, operator *ast.Term, terms []*ast.Term, iter u
 	}
 
 	bctx := BuiltinContext{
+		Context:  e.ctx,
 		Cache:    e.builtinCache,
 		Location: e.query[index].Location,
 		Tracer:   e.tracer,
@@ -538,9 +726,9 @@ func (e *eval) biunifyValues(a, b *ast.Term, b1, b2 *bindings, iter unifyIterato
 	}
 
 	if compA {
-		return e.biunifyComprehension(a.Value, b, b1, b2, iter)
+		return e.biunifyComprehension(a, b, b1, b2, iter)
 	} else if compB {
-		return e.biunifyComprehension(b.Value, a, b2, b1, iter)
+		return e.biunifyComprehension(b, a, b2, b1, iter)
 	}
 
 	// Perform standard unification.
@@ -633,8 +821,16 @@ func (e *eval) biunifyRef(a, b *ast.Term, b1, b2 *bindings, iter unifyIterator)
 	return eval.eval(iter)
 }
 
-func (e *eval) biunifyComprehension(a interface{}, b *ast.Term, b1, b2 *bindings, iter unifyIterator) error {
-	switch a := a.(type) {
+func (e *eval) biunifyComprehension(a, b *ast.Term, b1, b2 *bindings, iter unifyIterator) error {
+
+	value, err := e.lookupComprehensionCache(a, b1)
+	if err != nil {
+		return err
+	} else if value != nil {
+		return e.biunify(value, b, b1, b2, iter)
+	}
+
+	switch a := a.Value.(type) {
 	case *ast.ArrayComprehension:
 		return e.biunifyComprehensionArray(a, b, b1, b2, iter)
 	case *ast.SetComprehension:
@@ -645,6 +841,102 @@ func (e *eval) biunifyComprehension(a interface{}, b *ast.Term, b1, b2 *bindings
 	return fmt.Errorf("illegal comprehension %T", a)
 }
 
+// lookupComprehensionCache returns the value of the comprehension if the
+// compiler indexed it. The first lookup evaluates the comprehension body for
+// all bindings of the closure variables and caches the results for the rest of
+// the query.
+func (e *eval) lookupComprehensionCache(a *ast.Term, b1 *bindings) (*ast.Term, error) {
+
+	index := e.compiler.ComprehensionIndex(a)
+	if index == nil {
+		return nil, nil
+	}
+
+	keys := make(ast.Array, len(index.Keys))
+	for i := range index.Keys {
+		keys[i] = b1.Plug(index.Keys[i])
+		if !keys[i].IsGround() {
+			return nil, nil
+		}
+	}
+
+	elem, ok := e.compCache.Elem(a)
+	if !ok {
+		elem = e.buildComprehensionCache(a, index)
+		e.compCache.Set(a, elem)
+	}
+
+	if elem == nil {
+		return nil, nil
+	}
+
+	if elem.conflicts.Contains(ast.NewTerm(keys)) {
+		return nil, objectDocKeyConflictErr(a.Value.(*ast.ObjectComprehension).Key.Location)
+	}
+
+	if value := elem.values.Get(keys); value != nil {
+		return ast.NewTerm(value), nil
+	}
+
+	switch a.Value.(type) {
+	case *ast.ArrayComprehension:
+		return ast.ArrayTerm(), nil
+	case *ast.SetComprehension:
+		return ast.SetTerm(), nil
+	default:
+		return ast.ObjectTerm(), nil
+	}
+}
+
+// buildComprehensionCache evaluates the indexed comprehension body and groups
+// the results by the values of the closure variables. If evaluation fails, nil
+// is returned and the comprehension is evaluated normally so that errors are
+// only reported for bindings that the query actually uses.
+func (e *eval) buildComprehensionCache(a *ast.Term, index *ast.ComprehensionIndex) *comprehensionCacheElem {
+
+	elem := newComprehensionCacheElem()
+	child := e.child(index.Body)
+
+	err := child.Run(func(child *eval) error {
+		keys := make(ast.Array, len(index.Keys))
+		for i := range index.Keys {
+			keys[i] = child.bindings.Plug(index.Keys[i])
+		}
+		switch x := a.Value.(type) {
+		case *ast.ArrayComprehension:
+			arr, _ := elem.values.Get(keys).(ast.Array)
+			elem.values.Put(keys, append(arr, child.bindings.Plug(x.Term)))
+		case *ast.SetComprehension:
+			set, ok := elem.values.Get(keys).(ast.Set)
+			if !ok {
+				set = ast.NewSet()
+				elem.values.Put(keys, set)
+			}
+			set.Add(child.bindings.Plug(x.Term))
+		case *ast.ObjectComprehension:
+			obj, ok := elem.values.Get(keys).(ast.Object)
+			if !ok {
+				obj = ast.NewObject()
+				elem.values.Put(keys, obj)
+			}
+			key := child.bindings.Plug(x.Key)
+			value := child.bindings.Plug(x.Value)
+			if exist := obj.Get(key); exist != nil && !exist.Equal(value) {
+				elem.conflicts.Add(ast.NewTerm(keys))
+				return nil
+			}
+			obj.Insert(key, value)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil
+	}
+
+	return elem
+}
+
 func (e *eval) biunifyComprehensionArray(x *ast.ArrayComprehension, b *ast.Term, b1, b2 *bindings, iter unifyIterator) error {
 	result := ast.Array{}
 	child := e.closure(x.Body)
@@ -699,6 +991,7 @@ func (e *eval) saveExpr(expr *ast.Expr, b *bindings, iter unifyIterator) error {
 
 func (e *eval) saveUnify(a, b *ast.Term, b1, b2 *bindings, iter unifyIterator) error {
 	expr := ast.Equality.Expr(a, b)
+	expr.Location = e.location()
 	elem := newSaveSetElem(e.getUnifyOutputs(expr))
 	e.saveSet.Push(elem)
 	defer e.saveSet.Pop()
@@ -715,6 +1008,7 @@ func (e *eval) saveVoidCall(operator *ast.Term, args []*ast.Term, iter unifyIter
 		terms[i] = args[i-1]
 	}
 	expr := ast.NewExpr(terms)
+	expr.Location = e.location()
 	e.saveStack.Push(expr, e.bindings, nil)
 	defer e.saveStack.Pop()
 	e.traceSave(expr)
@@ -729,6 +1023,7 @@ func (e *eval) saveCall(operator *ast.Term, args []*ast.Term, result *ast.Term,
 	}
 	terms[len(terms)-1] = result
 	expr := ast.NewExpr(terms)
+	expr.Location = e.location()
 	elem := newSaveSetElem([]*ast.Term{result})
 	e.saveSet.Push(elem)
 	defer e.saveSet.Pop()
@@ -738,6 +1033,16 @@ func (e *eval) saveCall(operator *ast.Term, args []*ast.Term, result *ast.Term,
 	return iter()
 }
 
+// location returns the location of the expression being evaluated. Saved
+// expressions are given the location so that the partially evaluated queries
+// can be traced back to the policy.
+func (e *eval) location() *ast.Location {
+	if e.index < len(e.query) {
+		return e.query[e.index].Location
+	}
+	return nil
+}
+
 func (e *eval) getRules(ref ast.Ref) (*ast.IndexResult, error) {
 
 	e.instr.startTimer(evalOpRuleIndex)
@@ -771,6 +1076,56 @@ func (e *eval) getAllRules(ref ast.Ref) *ast.IndexResult {
 	return ir
 }
 
+// isDeterministicFunc returns false if the function calls non-deterministic
+// built-in functions directly or through other functions. The results of
+// such functions are not cached.
+func (e *eval) isDeterministicFunc(ref ast.Ref) bool {
+
+	key := ref.String()
+
+	if result, ok := e.funcCache.deterministic[key]; ok {
+		return result
+	}
+
+	// The compiler rejects recursive functions but mark the function as
+	// visited before walking the rules to guarantee termination.
+	e.funcCache.deterministic[key] = true
+	result := true
+
+	for _, rule := range e.compiler.GetRulesExact(ref) {
+		ast.WalkExprs(rule, func(expr *ast.Expr) bool {
+			if result && expr.IsCall() {
+				op := expr.Operator()
+				if op.HasPrefix(ast.DefaultRootRef) {
+					result = e.isDeterministicFunc(op)
+				} else {
+					result = !e.isNondeterministicBuiltin(op)
+				}
+			}
+			return !result
+		})
+	}
+
+	e.funcCache.deterministic[key] = result
+	return result
+}
+
+func (e *eval) isNondeterministicBuiltin(op ast.Ref) bool {
+	for _, bi := range ast.IgnoreDuringPartialEval {
+		if bi.Ref().Equal(op) {
+			return true
+		}
+	}
+	name := op.String()
+	if bi, ok := ast.BuiltinMap[name]; ok && bi.Nondeterministic {
+		return true
+	}
+	if bi, ok := e.builtins[name]; ok && bi.Decl.Nondeterministic {
+		return true
+	}
+	return false
+}
+
 func (e *eval) getRulesIndexed(ref ast.Ref) (*ast.IndexResult, error) {
 	index := e.compiler.RuleIndex(ref)
 	if index == nil {
@@ -895,6 +1250,14 @@ type evalFunc struct {
 
 func (e evalFunc) eval(iter unifyIterator) error {
 
+	// Partial evaluation may not produce ground results so function calls
+	// are only cached during normal evaluation.
+	if !e.e.partial() && e.e.isDeterministicFunc(e.ref) {
+		if args, ok := e.groundArgs(); ok {
+			return e.evalCached(args, iter)
+		}
+	}
+
 	ir, err := e.e.getRules(e.ref)
 	if err != nil {
 		return err
@@ -904,16 +1267,24 @@ func (e evalFunc) eval(iter unifyIterator) error {
 		return nil
 	}
 
+	return e.evalRules(ir, iter)
+}
+
+func (e evalFunc) evalRules(ir *ast.IndexResult, iter unifyIterator) error {
+
 	var prev *ast.Term
+	var exit error
+	earlyExit := ir.EarlyExit && e.e.earlyExit && !e.e.partial()
+	iter = deferEarlyExit(iter, &exit)
 
 	for i := range ir.Rules {
-		next, err := e.evalOneRule(iter, ir.Rules[i], prev)
+		next, err := e.evalOneRule(iter, ir.Rules[i], prev, earlyExit)
 		if err != nil {
 			return err
 		}
 		if next == nil {
 			for _, rule := range ir.Else[ir.Rules[i]] {
-				next, err = e.evalOneRule(iter, rule, prev)
+				next, err = e.evalOneRule(iter, rule, prev, earlyExit)
 				if err != nil {
 					return err
 				}
@@ -924,15 +1295,91 @@ func (e evalFunc) eval(iter unifyIterator) error {
 		}
 		if next != nil {
 			prev = next
+			if earlyExit {
+				break
+			}
 		}
 	}
 
-	return nil
+	return exit
+}
+
+// evalCached evaluates the function for the ground arguments once per query
+// and unifies the cached result with the output term for subsequent calls.
+func (e evalFunc) evalCached(args []*ast.Term, iter unifyIterator) error {
+
+	key := make(ast.Array, 0, len(args)+1)
+	key = append(key, ast.NewTerm(e.ref))
+	key = append(key, args...)
+
+	result, ok := e.e.funcCache.Get(key)
+	if !ok {
+		var err error
+		if result, err = e.evalResult(args); err != nil {
+			return err
+		}
+		e.e.funcCache.Put(key, result)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	if len(e.terms) == len(args) {
+		if result.Value.Compare(ast.Boolean(false)) == 0 {
+			return nil
+		}
+		return iter()
+	}
+
+	return e.e.unify(e.terms[len(e.terms)-1], result, iter)
+}
+
+// evalResult returns the value of the function for the ground arguments or
+// nil if the function is undefined. The function is evaluated with fresh
+// bindings so that the output is not constrained by the caller.
+func (e evalFunc) evalResult(args []*ast.Term) (*ast.Term, error) {
+
+	ir, err := e.e.getRules(e.ref)
+	if err != nil || ir.Empty() {
+		return nil, err
+	}
+
+	caller := e.e.child(nil)
+	output := ast.VarTerm("result")
+	terms := make([]*ast.Term, 0, len(args)+1)
+	terms = append(terms, args...)
+	terms = append(terms, output)
+
+	var result *ast.Term
+
+	err = evalFunc{e: caller, ref: e.ref, terms: terms}.evalRules(ir, func() error {
+		result = caller.bindings.Plug(output)
+		return nil
+	})
+
+	return result, err
 }
 
-func (e evalFunc) evalOneRule(iter unifyIterator, rule *ast.Rule, prev *ast.Term) (*ast.Term, error) {
+func (e evalFunc) groundArgs() ([]*ast.Term, bool) {
+	n := e.e.compiler.GetArity(e.ref)
+	if n < 0 || n > len(e.terms) {
+		return nil, false
+	}
+	args := make([]*ast.Term, n)
+	for i := range args {
+		args[i] = e.e.bindings.Plug(e.terms[i])
+		if !args[i].IsGround() {
+			return nil, false
+		}
+	}
+	return args, true
+}
+
+func (e evalFunc) evalOneRule(iter unifyIterator, rule *ast.Rule, prev *ast.Term, earlyExit bool) (*ast.Term, error) {
 
 	child := e.e.child(rule.Body)
+	exit := &earlyExitError{e: child}
 
 	args := make(ast.Array, len(e.terms))
 
@@ -980,10 +1427,19 @@ func (e evalFunc) evalOneRule(iter unifyIterator, rule *ast.Rule, prev *ast.Term
 			}
 
 			child.traceRedo(rule)
+
+			if earlyExit {
+				return exit
+			}
+
 			return nil
 		})
 	})
 
+	if isEarlyExit(err, child) {
+		err = nil
+	}
+
 	return result, err
 }
 
@@ -1204,6 +1660,10 @@ func (e evalVirtual) eval(iter unifyIterator) error {
 		return e.e.saveUnify(ast.NewTerm(e.ref), e.rterm, e.bindings, e.rbindings, iter)
 	}
 
+	if e.e.partial() && (e.e.inliningDisabled(e.plugged[:e.pos+1]) || e.e.shallowInlining && e.e.dependsOnUnknowns(ir)) {
+		return e.partialEvalSupport(ir, iter)
+	}
+
 	switch ir.Kind {
 	case ast.PartialSetDoc:
 		eval := evalVirtualPartial{
@@ -1246,6 +1706,29 @@ func (e evalVirtual) eval(iter unifyIterator) error {
 	}
 }
 
+// partialEvalSupport partially evaluates the rules into support rules instead
+// of inlining them. The reference is rewritten to refer to the support rules.
+func (e evalVirtual) partialEvalSupport(ir *ast.IndexResult, iter unifyIterator) error {
+
+	path := e.plugged[:e.pos+1].Insert(e.e.saveNamespace, 1)
+
+	if !e.e.saveSupport.Exists(path) {
+		for _, rule := range ir.Rules {
+			if err := e.e.partialEvalSupportRule(rule, path); err != nil {
+				return err
+			}
+		}
+		if ir.Default != nil {
+			if err := e.e.partialEvalSupportRule(ir.Default, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	rewritten := ast.NewTerm(e.ref.Insert(e.e.saveNamespace, 1))
+	return e.e.saveUnify(rewritten, e.rterm, e.bindings, e.rbindings, iter)
+}
+
 type evalVirtualPartial struct {
 	e         *eval
 	ref       ast.Ref
@@ -1448,6 +1931,8 @@ func (e evalVirtualComplete) evalValue(iter unifyIterator) error {
 	e.e.instr.counterIncr(evalOpVirtualCacheMiss)
 
 	var prev *ast.Term
+	var exit error
+	iter = deferEarlyExit(iter, &exit)
 
 	for i := range e.ir.Rules {
 		next, err := e.evalValueRule(iter, e.ir.Rules[i], prev)
@@ -1467,6 +1952,9 @@ func (e evalVirtualComplete) evalValue(iter unifyIterator) error {
 		}
 		if next != nil {
 			prev = next
+			if e.ir.EarlyExit && e.e.earlyExit {
+				break
+			}
 		}
 	}
 
@@ -1475,13 +1963,14 @@ func (e evalVirtualComplete) evalValue(iter unifyIterator) error {
 		return err
 	}
 
-	return nil
+	return exit
 }
 
 func (e evalVirtualComplete) evalValueRule(iter unifyIterator, rule *ast.Rule, prev *ast.Term) (*ast.Term, error) {
 
 	child := e.e.child(rule.Body)
 	child.traceEnter(rule)
+	exit := &earlyExitError{e: child}
 	var result *ast.Term
 
 	err := child.eval(func(child *eval) error {
@@ -1506,9 +1995,20 @@ func (e evalVirtualComplete) evalValueRule(iter unifyIterator, rule *ast.Rule, p
 		}
 
 		child.traceRedo(rule)
+
+		// The remaining results would only be checked for conflicts so stop
+		// if the rules cannot conflict.
+		if e.ir.EarlyExit && e.e.earlyExit {
+			return exit
+		}
+
 		return nil
 	})
 
+	if isEarlyExit(err, child) {
+		err = nil
+	}
+
 	return result, err
 }
 
@@ -1546,13 +2046,13 @@ func (e evalVirtualComplete) partialEvalDefault(iter unifyIterator) error {
 	if !e.e.saveSupport.Exists(path) {
 
 		for i := range e.ir.Rules {
-			err := e.partialEvalDefaultRule(iter, e.ir.Rules[i], path)
+			err := e.e.partialEvalSupportRule(e.ir.Rules[i], path)
 			if err != nil {
 				return err
 			}
 		}
 
-		err := e.partialEvalDefaultRule(iter, e.ir.Default, path)
+		err := e.e.partialEvalSupportRule(e.ir.Default, path)
 		if err != nil {
 			return err
 		}
@@ -1562,23 +2062,35 @@ func (e evalVirtualComplete) partialEvalDefault(iter unifyIterator) error {
 	return e.e.saveUnify(rewritten, e.rterm, e.bindings, e.rbindings, iter)
 }
 
-func (e evalVirtualComplete) partialEvalDefaultRule(iter unifyIterator, rule *ast.Rule, path ast.Ref) error {
+// partialEvalSupportRule partially evaluates the rule and inserts the result
+// into the support module for path.
+func (e *eval) partialEvalSupportRule(rule *ast.Rule, path ast.Ref) error {
 
-	child := e.e.child(rule.Body)
+	child := e.child(rule.Body)
 	child.traceEnter(rule)
 
-	e.e.saveStack.PushQuery(nil)
-	defer e.e.saveStack.PopQuery()
+	e.saveStack.PushQuery(nil)
+	defer e.saveStack.PopQuery()
 
 	return child.eval(func(child *eval) error {
 		child.traceExit(rule)
 
-		current := e.e.saveStack.PopQuery()
-		defer e.e.saveStack.PushQuery(current)
+		current := e.saveStack.PopQuery()
+		defer e.saveStack.PushQuery(current)
 		plugged := current.Plug(child.bindings)
 
-		e.e.saveSupport.Insert(path, &ast.Rule{
-			Head:    ast.NewHead(rule.Head.Name, nil, child.bindings.PlugNamespaced(rule.Head.Value, child.bindings)),
+		var key, value *ast.Term
+
+		if rule.Head.Key != nil {
+			key = child.bindings.PlugNamespaced(rule.Head.Key, child.bindings)
+		}
+
+		if rule.Head.Value != nil {
+			value = child.bindings.PlugNamespaced(rule.Head.Value, child.bindings)
+		}
+
+		e.saveSupport.Insert(path, &ast.Rule{
+			Head:    ast.NewHead(rule.Head.Name, key, value),
 			Body:    plugged,
 			Default: rule.Default,
 		})
@@ -0,0 +1,155 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+)
+
+var globCache = newCompiledCache(regexpCacheMaxSize)
+
+func builtinGlobMatch(a, b, c ast.Value) (ast.Value, error) {
+	pattern, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	arr, ok := b.(ast.Array)
+	if !ok {
+		return nil, builtins.NewOperandTypeErr(2, b, "array")
+	}
+
+	delimiters := make([]rune, 0, len(arr))
+	for i := range arr {
+		s, ok := arr[i].Value.(ast.String)
+		if !ok {
+			return nil, builtins.NewOperandElementErr(2, arr, arr[i].Value, "string")
+		}
+		r := []rune(string(s))
+		if len(r) != 1 {
+			return nil, builtins.NewOperandErr(2, "must contain single character delimiters but got %v", s)
+		}
+		delimiters = append(delimiters, r[0])
+	}
+
+	if len(delimiters) == 0 {
+		delimiters = []rune{'.'}
+	}
+
+	match, err := builtins.StringOperand(c, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := getGlob(string(pattern), delimiters)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.Boolean(re.MatchString(string(match))), nil
+}
+
+func getGlob(pattern string, delimiters []rune) (*regexp.Regexp, error) {
+	key := pattern + "\x00" + string(delimiters)
+	return globCache.Get(key, func() (*regexp.Regexp, error) {
+		expr, err := globToRegexp(pattern, delimiters)
+		if err != nil {
+			return nil, err
+		}
+		return regexp.Compile(expr)
+	})
+}
+
+// globToRegexp translates the glob pattern into an anchored regular
+// expression. The "*" and "?" wildcards do not match delimiters whereas the
+// "**" wildcard matches across them. Character classes ("[a-z]", "[!a-z]"),
+// alternatives ("{a,b}") and escapes ("\*") are supported as well.
+func globToRegexp(pattern string, delimiters []rune) (string, error) {
+
+	var nonDelim string
+	for _, d := range delimiters {
+		nonDelim += regexp.QuoteMeta(string(d))
+	}
+	nonDelim = "[^" + nonDelim + "]"
+
+	var buf strings.Builder
+	buf.WriteString("^")
+
+	runes := []rune(pattern)
+	depth := 0
+
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '\\':
+			if i+1 >= len(runes) {
+				return "", fmt.Errorf("unexpected end of pattern after escape")
+			}
+			i++
+			buf.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				i++
+				buf.WriteString(".*")
+			} else {
+				buf.WriteString(nonDelim + "*")
+			}
+		case '?':
+			buf.WriteString(nonDelim)
+		case '[':
+			j := i + 1
+			buf.WriteString("[")
+			if j < len(runes) && runes[j] == '!' {
+				buf.WriteString("^")
+				j++
+			}
+			start := j
+			for ; j < len(runes) && (runes[j] != ']' || j == start); j++ {
+				if runes[j] == '-' && j != start && j+1 < len(runes) && runes[j+1] != ']' {
+					buf.WriteString("-")
+				} else {
+					buf.WriteString(regexp.QuoteMeta(string(runes[j])))
+				}
+			}
+			if j >= len(runes) {
+				return "", fmt.Errorf("unterminated character class in pattern %q", pattern)
+			}
+			buf.WriteString("]")
+			i = j
+		case '{':
+			depth++
+			buf.WriteString("(?:")
+		case '}':
+			if depth == 0 {
+				return "", fmt.Errorf("unexpected '}' in pattern %q", pattern)
+			}
+			depth--
+			buf.WriteString(")")
+		case ',':
+			if depth > 0 {
+				buf.WriteString("|")
+			} else {
+				buf.WriteString(",")
+			}
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	if depth != 0 {
+		return "", fmt.Errorf("unterminated alternative in pattern %q", pattern)
+	}
+
+	buf.WriteString("$")
+	return buf.String(), nil
+}
+
+func init() {
+	RegisterFunctionalBuiltin3(ast.GlobMatch.Name, builtinGlobMatch)
+}
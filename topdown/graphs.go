@@ -0,0 +1,187 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+	"github.com/open-policy-agent/opa/util"
+)
+
+// adjacencyTraversal implements util.Traversal over a graph represented as an
+// object that maps each node to a set or array of neighbouring nodes.
+type adjacencyTraversal struct {
+	graph   ast.Object
+	visited ast.Set
+}
+
+func newAdjacencyTraversal(graph ast.Object) *adjacencyTraversal {
+	return &adjacencyTraversal{
+		graph:   graph,
+		visited: ast.NewSet(),
+	}
+}
+
+func (t *adjacencyTraversal) Edges(u util.T) []util.T {
+	var result []util.T
+	for _, v := range t.neighbours(u.(*ast.Term)) {
+		result = append(result, v)
+	}
+	return result
+}
+
+func (t *adjacencyTraversal) Visited(u util.T) bool {
+	term := u.(*ast.Term)
+	if t.visited.Contains(term) {
+		return true
+	}
+	t.visited.Add(term)
+	return false
+}
+
+func (t *adjacencyTraversal) neighbours(u *ast.Term) []*ast.Term {
+	edges := t.graph.Get(u)
+	if edges == nil {
+		return nil
+	}
+	switch v := edges.Value.(type) {
+	case ast.Set:
+		return v.Sorted()
+	case ast.Array:
+		return v
+	}
+	return nil
+}
+
+func builtinGraphReachable(a, b ast.Value) (ast.Value, error) {
+
+	graph, err := graphOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	initial, err := graphNodesOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	t := newAdjacencyTraversal(graph)
+	for _, node := range initial {
+		util.BFS(t, func(util.T) bool { return false }, node)
+	}
+
+	return t.visited, nil
+}
+
+func builtinGraphReachablePaths(a, b ast.Value) (ast.Value, error) {
+
+	graph, err := graphOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	initial, err := graphNodesOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	t := newPathTraversal(graph, initial)
+
+	for _, node := range initial {
+		util.BFS(t, func(util.T) bool { return false }, node)
+	}
+
+	return t.paths(), nil
+}
+
+// pathTraversal implements util.Traversal and records the node that each node
+// is first reached from. Each node is visited once so the recorded edges form
+// a tree of shortest paths rooted at the initial nodes.
+type pathTraversal struct {
+	*adjacencyTraversal
+	reached ast.Set    // nodes that have been reached
+	parents ast.Object // maps each reached node to the node it was reached from
+	inner   ast.Set    // nodes that other nodes were reached from
+}
+
+func newPathTraversal(graph ast.Object, initial []*ast.Term) *pathTraversal {
+	return &pathTraversal{
+		adjacencyTraversal: newAdjacencyTraversal(graph),
+		reached:            ast.NewSet(initial...),
+		parents:            ast.NewObject(),
+		inner:              ast.NewSet(),
+	}
+}
+
+func (t *pathTraversal) Edges(u util.T) []util.T {
+	term := u.(*ast.Term)
+	var result []util.T
+	for _, v := range t.neighbours(term) {
+		if t.reached.Contains(v) {
+			continue
+		}
+		t.reached.Add(v)
+		t.parents.Insert(v, term)
+		t.inner.Add(term)
+		result = append(result, v)
+	}
+	return result
+}
+
+// paths returns the paths from the initial nodes to the nodes that no other
+// nodes were reached from. The number of paths is bounded by the number of
+// reached nodes.
+func (t *pathTraversal) paths() ast.Set {
+	result := ast.NewSet()
+	t.reached.Foreach(func(node *ast.Term) {
+		if t.inner.Contains(node) {
+			return
+		}
+		path := ast.Array{node}
+		for parent := t.parents.Get(node); parent != nil; parent = t.parents.Get(parent) {
+			path = append(path, parent)
+		}
+		for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+			path[i], path[j] = path[j], path[i]
+		}
+		result.Add(ast.NewTerm(path))
+	})
+	return result
+}
+
+// graphOperand returns the graph operand after checking that each node maps to
+// a set or array of neighbours.
+func graphOperand(x ast.Value, pos int) (ast.Object, error) {
+
+	graph, err := builtins.ObjectOperand(x, pos)
+	if err != nil {
+		return nil, err
+	}
+
+	err = graph.Iter(func(_, v *ast.Term) error {
+		switch v.Value.(type) {
+		case ast.Set, ast.Array:
+			return nil
+		}
+		return builtins.NewOperandErr(pos, "must be object with set or array values but got %v value", ast.TypeName(v.Value))
+	})
+
+	return graph, err
+}
+
+func graphNodesOperand(x ast.Value, pos int) ([]*ast.Term, error) {
+	switch v := x.(type) {
+	case ast.Set:
+		return v.Sorted(), nil
+	case ast.Array:
+		return v, nil
+	}
+	return nil, builtins.NewOperandTypeErr(pos, x, "set", "array")
+}
+
+func init() {
+	RegisterFunctionalBuiltin2(ast.GraphReachable.Name, builtinGraphReachable)
+	RegisterFunctionalBuiltin2(ast.GraphReachablePaths.Name, builtinGraphReachablePaths)
+}
@@ -0,0 +1,476 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+)
+
+// jsonPathTrie represents a set of paths into a JSON document. Leaf nodes
+// mark the end of a path; all documents nested underneath are selected.
+type jsonPathTrie struct {
+	leaf     bool
+	children map[string]*jsonPathTrie
+}
+
+func newJSONPathTrie() *jsonPathTrie {
+	return &jsonPathTrie{children: map[string]*jsonPathTrie{}}
+}
+
+func (t *jsonPathTrie) insert(path []string) {
+	node := t
+	for _, seg := range path {
+		if node.leaf {
+			return
+		}
+		child, ok := node.children[seg]
+		if !ok {
+			child = newJSONPathTrie()
+			node.children[seg] = child
+		}
+		node = child
+	}
+	node.leaf = true
+	node.children = map[string]*jsonPathTrie{}
+}
+
+func (t *jsonPathTrie) child(key *ast.Term) *jsonPathTrie {
+	return t.children[jsonPathSegment(key)]
+}
+
+func builtinJSONFilter(a, b ast.Value) (ast.Value, error) {
+	obj, err := builtins.ObjectOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	trie, err := getJSONPathsParam(b)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ok := jsonFilter(obj, trie)
+	if !ok {
+		return ast.NewObject(), nil
+	}
+
+	return result, nil
+}
+
+func jsonFilter(v ast.Value, node *jsonPathTrie) (ast.Value, bool) {
+
+	if node.leaf {
+		return v, true
+	}
+
+	switch v := v.(type) {
+	case ast.Object:
+		r := ast.NewObject()
+		v.Foreach(func(k, x *ast.Term) {
+			if child := node.child(k); child != nil {
+				if fx, ok := jsonFilter(x.Value, child); ok {
+					r.Insert(k, ast.NewTerm(fx))
+				}
+			}
+		})
+		return r, true
+	case ast.Array:
+		r := ast.Array{}
+		for i := range v {
+			if child := node.child(ast.IntNumberTerm(i)); child != nil {
+				if fx, ok := jsonFilter(v[i].Value, child); ok {
+					r = append(r, ast.NewTerm(fx))
+				}
+			}
+		}
+		return r, true
+	}
+
+	return nil, false
+}
+
+func builtinJSONRemove(a, b ast.Value) (ast.Value, error) {
+	obj, err := builtins.ObjectOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	trie, err := getJSONPathsParam(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonRemove(obj, trie), nil
+}
+
+func jsonRemove(v ast.Value, node *jsonPathTrie) ast.Value {
+	switch v := v.(type) {
+	case ast.Object:
+		r := ast.NewObject()
+		v.Foreach(func(k, x *ast.Term) {
+			child := node.child(k)
+			if child == nil {
+				r.Insert(k, x)
+			} else if !child.leaf {
+				r.Insert(k, ast.NewTerm(jsonRemove(x.Value, child)))
+			}
+		})
+		return r
+	case ast.Array:
+		r := ast.Array{}
+		for i := range v {
+			child := node.child(ast.IntNumberTerm(i))
+			if child == nil {
+				r = append(r, v[i])
+			} else if !child.leaf {
+				r = append(r, ast.NewTerm(jsonRemove(v[i].Value, child)))
+			}
+		}
+		return r
+	}
+	return v
+}
+
+// getJSONPathsParam returns a trie built from an array or set of paths. Each
+// path is either a slash-separated string (e.g., "a/b/c") or an array of path
+// segments (e.g., ["a", "b", "c"]).
+func getJSONPathsParam(x ast.Value) (*jsonPathTrie, error) {
+	var paths []*ast.Term
+
+	switch v := x.(type) {
+	case ast.Array:
+		paths = v
+	case ast.Set:
+		paths = v.Sorted()
+	default:
+		return nil, builtins.NewOperandTypeErr(2, x, "set", "array")
+	}
+
+	trie := newJSONPathTrie()
+
+	for _, p := range paths {
+		switch v := p.Value.(type) {
+		case ast.String:
+			s := strings.Trim(string(v), "/")
+			if s == "" {
+				trie.insert(nil)
+			} else {
+				trie.insert(strings.Split(s, "/"))
+			}
+		case ast.Array:
+			path := make([]string, len(v))
+			for i := range v {
+				path[i] = jsonPathSegment(v[i])
+			}
+			trie.insert(path)
+		default:
+			return nil, builtins.NewOperandElementErr(2, x, p.Value, "string", "array")
+		}
+	}
+
+	return trie, nil
+}
+
+// jsonPathSegment returns the string form of a path segment. Strings are used
+// as-is so that they match object keys and numbers are formatted so that they
+// match array indices.
+func jsonPathSegment(t *ast.Term) string {
+	switch v := t.Value.(type) {
+	case ast.String:
+		return string(v)
+	case ast.Number:
+		if i, ok := v.Int(); ok {
+			return strconv.Itoa(i)
+		}
+		return string(v)
+	}
+	return t.String()
+}
+
+// errJSONPatch indicates that a patch operation could not be applied to the
+// target document. Failed patches are undefined rather than errors.
+type errJSONPatch string
+
+func (e errJSONPatch) Error() string {
+	return string(e)
+}
+
+func builtinJSONPatch(a, b ast.Value) (ast.Value, error) {
+	ops, ok := b.(ast.Array)
+	if !ok {
+		return nil, builtins.NewOperandTypeErr(2, b, "array")
+	}
+
+	result := a
+
+	for i := range ops {
+		op, ok := ops[i].Value.(ast.Object)
+		if !ok {
+			return nil, builtins.NewOperandElementErr(2, ops, ops[i].Value, "object")
+		}
+
+		var err error
+		result, err = applyJSONPatchOp(result, op)
+		if err != nil {
+			if _, ok := err.(errJSONPatch); ok {
+				return nil, BuiltinEmpty{}
+			}
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func applyJSONPatchOp(doc ast.Value, op ast.Object) (ast.Value, error) {
+
+	var name ast.String
+	if t := op.Get(ast.StringTerm("op")); t != nil {
+		name, _ = t.Value.(ast.String)
+	}
+	if name == "" {
+		return nil, builtins.NewOperandErr(2, "must contain operations with an \"op\" string")
+	}
+
+	path, err := getJSONPatchPath(op, "path")
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "add":
+		value, err := getJSONPatchValue(op)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPatchAdd(doc, path, value)
+	case "remove":
+		return jsonPatchRemove(doc, path)
+	case "replace":
+		value, err := getJSONPatchValue(op)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		doc, err = jsonPatchRemove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPatchAdd(doc, path, value)
+	case "move", "copy":
+		from, err := getJSONPatchPath(op, "from")
+		if err != nil {
+			return nil, err
+		}
+		value, ok := jsonPatchGet(doc, from)
+		if !ok {
+			return nil, errJSONPatch("from path not found")
+		}
+		if name == "move" {
+			doc, err = jsonPatchRemove(doc, from)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return jsonPatchAdd(doc, path, value)
+	case "test":
+		value, err := getJSONPatchValue(op)
+		if err != nil {
+			return nil, err
+		}
+		if curr, ok := jsonPatchGet(doc, path); !ok || curr.Compare(value) != 0 {
+			return nil, errJSONPatch("test failed")
+		}
+		return doc, nil
+	}
+
+	return nil, builtins.NewOperandErr(2, "must contain operations with \"op\" one of {add, remove, replace, move, copy, test} but got %v", name)
+}
+
+func getJSONPatchValue(op ast.Object) (ast.Value, error) {
+	value := op.Get(ast.StringTerm("value"))
+	if value == nil {
+		return nil, builtins.NewOperandErr(2, "must contain a \"value\" for %v operations", op.Get(ast.StringTerm("op")))
+	}
+	return value.Value, nil
+}
+
+// getJSONPatchPath returns the path stored under key in the operation. Paths
+// are either JSON pointers (RFC 6901) or arrays of path segments.
+func getJSONPatchPath(op ast.Object, key string) ([]string, error) {
+	term := op.Get(ast.StringTerm(key))
+	if term == nil {
+		return nil, builtins.NewOperandErr(2, "must contain a %q for %v operations", key, op.Get(ast.StringTerm("op")))
+	}
+
+	switch v := term.Value.(type) {
+	case ast.String:
+		if v == "" {
+			return []string{}, nil
+		}
+		if !strings.HasPrefix(string(v), "/") {
+			return nil, builtins.NewOperandErr(2, "must contain a valid JSON pointer for %q but got %v", key, v)
+		}
+		parts := strings.Split(string(v)[1:], "/")
+		for i := range parts {
+			parts[i] = strings.Replace(strings.Replace(parts[i], "~1", "/", -1), "~0", "~", -1)
+		}
+		return parts, nil
+	case ast.Array:
+		parts := make([]string, len(v))
+		for i := range v {
+			parts[i] = jsonPathSegment(v[i])
+		}
+		return parts, nil
+	}
+
+	return nil, builtins.NewOperandErr(2, "must contain a string or array %q but got %v", key, ast.TypeName(term.Value))
+}
+
+func jsonPatchGet(doc ast.Value, path []string) (ast.Value, bool) {
+	for _, seg := range path {
+		switch v := doc.(type) {
+		case ast.Object:
+			t := v.Get(ast.StringTerm(seg))
+			if t == nil {
+				return nil, false
+			}
+			doc = t.Value
+		case ast.Array:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			doc = v[i].Value
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// jsonPatchUpdate returns a copy of doc where the parent of the last path
+// segment has been replaced by the result of f. Documents along the path are
+// copied so that the operand is not modified.
+func jsonPatchUpdate(doc ast.Value, path []string, f func(parent ast.Value, last string) (ast.Value, error)) (ast.Value, error) {
+
+	if len(path) == 1 {
+		return f(doc, path[0])
+	}
+
+	switch v := doc.(type) {
+	case ast.Object:
+		key := ast.StringTerm(path[0])
+		child := v.Get(key)
+		if child == nil {
+			return nil, errJSONPatch(fmt.Sprintf("path %q not found", path[0]))
+		}
+		updated, err := jsonPatchUpdate(child.Value, path[1:], f)
+		if err != nil {
+			return nil, err
+		}
+		cpy := copyObject(v)
+		cpy.Insert(key, ast.NewTerm(updated))
+		return cpy, nil
+	case ast.Array:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i >= len(v) {
+			return nil, errJSONPatch(fmt.Sprintf("path %q not found", path[0]))
+		}
+		updated, err := jsonPatchUpdate(v[i].Value, path[1:], f)
+		if err != nil {
+			return nil, err
+		}
+		cpy := make(ast.Array, len(v))
+		copy(cpy, v)
+		cpy[i] = ast.NewTerm(updated)
+		return cpy, nil
+	}
+
+	return nil, errJSONPatch(fmt.Sprintf("path %q not found", path[0]))
+}
+
+func jsonPatchAdd(doc ast.Value, path []string, value ast.Value) (ast.Value, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return jsonPatchUpdate(doc, path, func(parent ast.Value, last string) (ast.Value, error) {
+		switch v := parent.(type) {
+		case ast.Object:
+			cpy := copyObject(v)
+			cpy.Insert(ast.StringTerm(last), ast.NewTerm(value))
+			return cpy, nil
+		case ast.Array:
+			i := len(v)
+			if last != "-" {
+				var err error
+				i, err = strconv.Atoi(last)
+				if err != nil || i < 0 || i > len(v) {
+					return nil, errJSONPatch(fmt.Sprintf("invalid array index %q", last))
+				}
+			}
+			cpy := make(ast.Array, 0, len(v)+1)
+			cpy = append(cpy, v[:i]...)
+			cpy = append(cpy, ast.NewTerm(value))
+			cpy = append(cpy, v[i:]...)
+			return cpy, nil
+		}
+		return nil, errJSONPatch(fmt.Sprintf("path %q not found", last))
+	})
+}
+
+func jsonPatchRemove(doc ast.Value, path []string) (ast.Value, error) {
+	if len(path) == 0 {
+		return nil, errJSONPatch("cannot remove root document")
+	}
+	return jsonPatchUpdate(doc, path, func(parent ast.Value, last string) (ast.Value, error) {
+		switch v := parent.(type) {
+		case ast.Object:
+			key := ast.StringTerm(last)
+			if v.Get(key) == nil {
+				return nil, errJSONPatch(fmt.Sprintf("path %q not found", last))
+			}
+			cpy := ast.NewObject()
+			v.Foreach(func(k, x *ast.Term) {
+				if !k.Equal(key) {
+					cpy.Insert(k, x)
+				}
+			})
+			return cpy, nil
+		case ast.Array:
+			i, err := strconv.Atoi(last)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, errJSONPatch(fmt.Sprintf("invalid array index %q", last))
+			}
+			cpy := make(ast.Array, 0, len(v)-1)
+			cpy = append(cpy, v[:i]...)
+			cpy = append(cpy, v[i+1:]...)
+			return cpy, nil
+		}
+		return nil, errJSONPatch(fmt.Sprintf("path %q not found", last))
+	})
+}
+
+// copyObject returns a shallow copy of obj.
+func copyObject(obj ast.Object) ast.Object {
+	cpy := ast.NewObject()
+	obj.Foreach(func(k, v *ast.Term) {
+		cpy.Insert(k, v)
+	})
+	return cpy
+}
+
+func init() {
+	RegisterFunctionalBuiltin2(ast.JSONFilter.Name, builtinJSONFilter)
+	RegisterFunctionalBuiltin2(ast.JSONRemove.Name, builtinJSONRemove)
+	RegisterFunctionalBuiltin2(ast.JSONPatch.Name, builtinJSONPatch)
+}
@@ -0,0 +1,20 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"github.com/open-policy-agent/opa/ast"
+)
+
+// builtinRegoMetadataRule is only evaluated outside of rules (e.g., in ad-hoc
+// queries) because the compiler replaces calls inside rules with the rule's
+// annotations.
+func builtinRegoMetadataRule(bctx BuiltinContext, args []*ast.Term, iter func(*ast.Term) error) error {
+	return iter(ast.ObjectTerm())
+}
+
+func init() {
+	RegisterBuiltinFunc(ast.RegoMetadataRule.Name, builtinRegoMetadataRule)
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"math/big"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+)
+
+var one = big.NewInt(1)
+
+// maxNumbersRange bounds the distance between the operands of numbers.range
+// so that the size of the output array is limited.
+const maxNumbersRange = 1000000
+
+var maxNumbersRangeInt = big.NewInt(maxNumbersRange)
+
+func builtinNumbersRange(a, b ast.Value) (ast.Value, error) {
+
+	x, err := builtins.BigIntOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := builtins.BigIntOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	if new(big.Int).Sub(y, x).CmpAbs(maxNumbersRangeInt) > 0 {
+		return nil, builtins.NewOperandErr(2, "must not differ from operand 1 by more than %d", maxNumbersRange)
+	}
+
+	result := ast.Array{}
+	cmp := x.Cmp(y)
+
+	if cmp <= 0 {
+		for i := new(big.Int).Set(x); i.Cmp(y) <= 0; i = new(big.Int).Add(i, one) {
+			result = append(result, ast.NewTerm(builtins.IntToNumber(i)))
+		}
+	} else {
+		for i := new(big.Int).Set(x); i.Cmp(y) >= 0; i = new(big.Int).Sub(i, one) {
+			result = append(result, ast.NewTerm(builtins.IntToNumber(i)))
+		}
+	}
+
+	return result, nil
+}
+
+func init() {
+	RegisterFunctionalBuiltin2(ast.NumbersRange.Name, builtinNumbersRange)
+}
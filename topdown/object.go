@@ -0,0 +1,139 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+)
+
+func builtinObjectGet(a, b, c ast.Value) (ast.Value, error) {
+	object, err := builtins.ObjectOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if value := object.Get(ast.NewTerm(b)); value != nil {
+		return value.Value, nil
+	}
+
+	return c, nil
+}
+
+func builtinObjectRemove(a, b ast.Value) (ast.Value, error) {
+	object, err := builtins.ObjectOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := getObjectKeysParam(b)
+	if err != nil {
+		return nil, err
+	}
+
+	r := ast.NewObject()
+	object.Foreach(func(k, v *ast.Term) {
+		if !keys.Contains(k) {
+			r.Insert(k, v)
+		}
+	})
+
+	return r, nil
+}
+
+func builtinObjectFilter(a, b ast.Value) (ast.Value, error) {
+	object, err := builtins.ObjectOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := getObjectKeysParam(b)
+	if err != nil {
+		return nil, err
+	}
+
+	r := ast.NewObject()
+	object.Foreach(func(k, v *ast.Term) {
+		if keys.Contains(k) {
+			r.Insert(k, v)
+		}
+	})
+
+	return r, nil
+}
+
+func builtinObjectUnion(a, b ast.Value) (ast.Value, error) {
+	objA, err := builtins.ObjectOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	objB, err := builtins.ObjectOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeObjects(objA, objB), nil
+}
+
+// mergeObjects returns a new object containing the keys of both objects. If a
+// key exists in both objects and both values are objects, the values are
+// merged recursively. Otherwise the value from objB is used.
+func mergeObjects(objA, objB ast.Object) ast.Object {
+	r := ast.NewObject()
+
+	objA.Foreach(func(k, v *ast.Term) {
+		v2 := objB.Get(k)
+		if v2 == nil {
+			r.Insert(k, v)
+			return
+		}
+		obj1, ok1 := v.Value.(ast.Object)
+		obj2, ok2 := v2.Value.(ast.Object)
+		if ok1 && ok2 {
+			r.Insert(k, ast.NewTerm(mergeObjects(obj1, obj2)))
+		} else {
+			r.Insert(k, v2)
+		}
+	})
+
+	objB.Foreach(func(k, v *ast.Term) {
+		if objA.Get(k) == nil {
+			r.Insert(k, v)
+		}
+	})
+
+	return r
+}
+
+// getObjectKeysParam returns a set of keys from an array, set, or object
+// operand. For objects, the keys of the object are used.
+func getObjectKeysParam(x ast.Value) (ast.Set, error) {
+	keys := ast.NewSet()
+
+	switch v := x.(type) {
+	case ast.Array:
+		for _, t := range v {
+			keys.Add(t)
+		}
+	case ast.Set:
+		keys = v
+	case ast.Object:
+		for _, k := range v.Keys() {
+			keys.Add(k)
+		}
+	default:
+		return nil, builtins.NewOperandTypeErr(2, x, "object", "set", "array")
+	}
+
+	return keys, nil
+}
+
+func init() {
+	RegisterFunctionalBuiltin3(ast.ObjectGet.Name, builtinObjectGet)
+	RegisterFunctionalBuiltin2(ast.ObjectRemove.Name, builtinObjectRemove)
+	RegisterFunctionalBuiltin2(ast.ObjectFilter.Name, builtinObjectFilter)
+	RegisterFunctionalBuiltin2(ast.ObjectUnion.Name, builtinObjectUnion)
+}
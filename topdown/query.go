@@ -28,9 +28,15 @@ type Query struct {
 	tracer           Tracer
 	unknowns         []*ast.Term
 	partialNamespace string
+	disableInlining  []ast.Ref
+	shallowInlining  bool
+	copyPropagation  bool
 	metrics          metrics.Metrics
 	instr            *Instrumentation
 	genvarprefix     string
+	builtins         map[string]*Builtin
+	earlyExit        bool
+	queryEarlyExit   bool
 }
 
 // NewQuery returns a new Query object that can be run.
@@ -74,9 +80,37 @@ func (q *Query) WithInput(input *ast.Term) *Query {
 	return q
 }
 
-// WithTracer sets the query tracer to use during evaluation. This is optional.
+// WithTracer adds a query tracer to use during evaluation. This is optional.
+// If multiple tracers are added, events are sent to each of them.
 func (q *Query) WithTracer(tracer Tracer) *Query {
-	q.tracer = tracer
+	if tracer == nil {
+		return q
+	}
+	switch t := q.tracer.(type) {
+	case nil:
+		q.tracer = tracer
+	case multiTracer:
+		q.tracer = append(t, tracer)
+	default:
+		q.tracer = multiTracer{t, tracer}
+	}
+	return q
+}
+
+// WithEarlyExit enables or disables early exit. When enabled, evaluation of
+// rules and functions that produce constant values stops after the first
+// successful body. Early exit is disabled by default.
+func (q *Query) WithEarlyExit(enabled bool) *Query {
+	q.earlyExit = enabled
+	return q
+}
+
+// WithQueryEarlyExit enables or disables early exit for queries that only
+// contain wildcards. When enabled, evaluation of such queries stops after the
+// first result. Query early exit is disabled by default because callers may
+// observe the number of results.
+func (q *Query) WithQueryEarlyExit(enabled bool) *Query {
+	q.queryEarlyExit = enabled
 	return q
 }
 
@@ -109,6 +143,42 @@ func (q *Query) WithPartialNamespace(ns string) *Query {
 	return q
 }
 
+// WithDisableInlining sets the paths of virtual documents that should not be
+// inlined during partial evaluation. Rules under the paths are partially
+// evaluated into support rules that are referred to by the partially evaluated
+// queries.
+func (q *Query) WithDisableInlining(paths []ast.Ref) *Query {
+	q.disableInlining = paths
+	return q
+}
+
+// WithShallowInlining enables or disables shallow inlining during partial
+// evaluation. When enabled, rules that depend on unknown values are partially
+// evaluated into support rules instead of being inlined. Rules that only depend
+// on known values are still evaluated.
+func (q *Query) WithShallowInlining(enabled bool) *Query {
+	q.shallowInlining = enabled
+	return q
+}
+
+// WithCopyPropagation enables or disables copy propagation of the partially
+// evaluated queries and support rules. When enabled, variables that are not
+// needed by the caller are replaced by the values bound to them and redundant
+// expressions and duplicate queries are removed.
+func (q *Query) WithCopyPropagation(enabled bool) *Query {
+	q.copyPropagation = enabled
+	return q
+}
+
+// WithBuiltins sets the set of built-in functions that are available to the
+// query in addition to the globally registered built-in functions. The
+// builtins map is keyed by the built-in function name. The compiler must be
+// made aware of the same built-in functions (see ast.Compiler#WithBuiltins.)
+func (q *Query) WithBuiltins(builtins map[string]*Builtin) *Query {
+	q.builtins = builtins
+	return q
+}
+
 // PartialRun executes partial evaluation on the query with respect to unknown
 // values. Partial evaluation attempts to evaluate as much of the query as
 // possible without requiring values for the unknowns set on the query. The
@@ -122,25 +192,30 @@ func (q *Query) PartialRun(ctx context.Context) (partials []ast.Body, support []
 	}
 	f := &queryIDFactory{}
 	e := &eval{
-		ctx:           ctx,
-		cancel:        q.cancel,
-		query:         q.query,
-		queryIDFact:   f,
-		queryID:       f.Next(),
-		bindings:      newBindings(0, q.instr),
-		compiler:      q.compiler,
-		store:         q.store,
-		txn:           q.txn,
-		input:         q.input,
-		tracer:        q.tracer,
-		instr:         q.instr,
-		builtinCache:  builtins.Cache{},
-		virtualCache:  newVirtualCache(),
-		saveSet:       newSaveSet(q.unknowns),
-		saveStack:     newSaveStack(),
-		saveSupport:   newSaveSupport(),
-		saveNamespace: ast.StringTerm(q.partialNamespace),
-		genvarprefix:  q.genvarprefix,
+		ctx:             ctx,
+		cancel:          q.cancel,
+		query:           q.query,
+		queryIDFact:     f,
+		queryID:         f.Next(),
+		bindings:        newBindings(0, q.instr),
+		compiler:        q.compiler,
+		store:           q.store,
+		txn:             q.txn,
+		input:           q.input,
+		tracer:          q.tracer,
+		instr:           q.instr,
+		builtinCache:    builtins.Cache{},
+		virtualCache:    newVirtualCache(),
+		compCache:       newComprehensionCache(),
+		funcCache:       newFunctionCache(),
+		saveSet:         newSaveSet(q.unknowns),
+		saveStack:       newSaveStack(),
+		saveSupport:     newSaveSupport(),
+		saveNamespace:   ast.StringTerm(q.partialNamespace),
+		disableInlining: q.disableInlining,
+		shallowInlining: q.shallowInlining,
+		genvarprefix:    q.genvarprefix,
+		builtins:        q.builtins,
 	}
 	q.startTimer(metrics.RegoPartialEval)
 	defer q.stopTimer(metrics.RegoPartialEval)
@@ -167,7 +242,14 @@ func (q *Query) PartialRun(ctx context.Context) (partials []ast.Body, support []
 		partials = append(partials, body)
 		return nil
 	})
-	return partials, e.saveSupport.List(), err
+	support = e.saveSupport.List()
+	if q.copyPropagation {
+		partials = copyPropagateQueries(partials, queryVars(q.query))
+		for i := range support {
+			copyPropagateModule(support[i])
+		}
+	}
+	return partials, support, err
 }
 
 // Run is a wrapper around Iter that accumulates query results and returns them
@@ -199,18 +281,75 @@ func (q *Query) Iter(ctx context.Context, iter func(QueryResult) error) error {
 		instr:        q.instr,
 		builtinCache: builtins.Cache{},
 		virtualCache: newVirtualCache(),
+		compCache:    newComprehensionCache(),
+		funcCache:    newFunctionCache(),
 		genvarprefix: q.genvarprefix,
+		builtins:     q.builtins,
+		earlyExit:    q.earlyExit,
 	}
 	q.startTimer(metrics.RegoQueryEval)
 	defer q.stopTimer(metrics.RegoQueryEval)
-	return e.Run(func(e *eval) error {
+	root := e
+	exit := &earlyExitError{e: root}
+	existence := q.queryEarlyExit && existenceOnly(q.query)
+	err := e.Run(func(e *eval) error {
 		qr := QueryResult{}
 		e.bindings.Iter(nil, func(k, v *ast.Term) error {
 			qr[k.Value.(ast.Var)] = v
 			return nil
 		})
-		return iter(qr)
+		if err := iter(qr); err != nil {
+			return err
+		}
+		if existence {
+			return exit
+		}
+		return nil
+	})
+	if isEarlyExit(err, root) {
+		return nil
+	}
+	return err
+}
+
+// existenceOnly returns true if the only variables in the query are anonymous
+// wildcards (i.e., `_`). The bindings for such variables are not meaningful so
+// the results only differ in the witnesses chosen for the wildcards and
+// evaluation can stop after the first result.
+func existenceOnly(query ast.Body) bool {
+	vis := ast.NewVarVisitor().WithParams(ast.VarVisitorParams{
+		SkipRefHead:     true,
+		SkipRefCallHead: true,
 	})
+	ast.Walk(vis, query)
+	for v := range vis.Vars() {
+		if !isAnonymousWildcard(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// isAnonymousWildcard returns true if v is `_` or was generated by the parser
+// for `_`. Other wildcard-prefixed variables (e.g., variables generated by
+// callers to capture expression values) may be observed by the caller.
+func isAnonymousWildcard(v ast.Var) bool {
+	if v.Equal(ast.Wildcard.Value) {
+		return true
+	}
+	if !v.IsWildcard() {
+		return false
+	}
+	s := string(v)[len(ast.WildcardPrefix):]
+	if len(s) == 0 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
 }
 
 func (q *Query) startTimer(name string) {
@@ -5,7 +5,9 @@
 package topdown
 
 import (
+	"fmt"
 	"regexp"
+	"strings"
 	"sync"
 
 	"github.com/yashtewari/glob-intersection"
@@ -14,8 +16,54 @@ import (
 	"github.com/open-policy-agent/opa/topdown/builtins"
 )
 
-var regexpCacheLock = sync.Mutex{}
-var regexpCache map[string]*regexp.Regexp
+// regexpCacheMaxSize bounds the number of compiled patterns kept by each of
+// the caches below. When the limit is reached, an arbitrary entry is evicted.
+const regexpCacheMaxSize = 100
+
+var regexpCache = newCompiledCache(regexpCacheMaxSize)
+var templateCache = newCompiledCache(regexpCacheMaxSize)
+
+// compiledCache is a bounded, concurrency-safe cache of compiled regular
+// expressions. The cache is shared across queries.
+type compiledCache struct {
+	mtx     sync.Mutex
+	maxSize int
+	entries map[string]*regexp.Regexp
+}
+
+func newCompiledCache(maxSize int) *compiledCache {
+	return &compiledCache{
+		maxSize: maxSize,
+		entries: map[string]*regexp.Regexp{},
+	}
+}
+
+// Get returns the compiled expression for key. If key is not cached, compile
+// is called and the result is cached if compilation succeeds.
+func (c *compiledCache) Get(key string, compile func() (*regexp.Regexp, error)) (*regexp.Regexp, error) {
+	c.mtx.Lock()
+	re, ok := c.entries[key]
+	c.mtx.Unlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := compile()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if len(c.entries) >= c.maxSize {
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	c.entries[key] = re
+	return re, nil
+}
 
 func builtinRegexMatch(a, b ast.Value) (ast.Value, error) {
 	s1, err := builtins.StringOperand(a, 1)
@@ -33,19 +81,139 @@ func builtinRegexMatch(a, b ast.Value) (ast.Value, error) {
 	return ast.Boolean(re.Match([]byte(s2))), nil
 }
 
-func getRegexp(pat string) (*regexp.Regexp, error) {
-	regexpCacheLock.Lock()
-	defer regexpCacheLock.Unlock()
-	re, ok := regexpCache[pat]
-	if !ok {
-		var err error
-		re, err = regexp.Compile(string(pat))
-		if err != nil {
-			return nil, err
+func builtinRegexSplit(a, b ast.Value) (ast.Value, error) {
+	s1, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+	s2, err := builtins.StringOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+	re, err := getRegexp(string(s1))
+	if err != nil {
+		return nil, err
+	}
+
+	elems := re.Split(string(s2), -1)
+	arr := make(ast.Array, len(elems))
+	for i := range elems {
+		arr[i] = ast.StringTerm(elems[i])
+	}
+	return arr, nil
+}
+
+func builtinRegexFindN(a, b, c ast.Value) (ast.Value, error) {
+	s1, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+	s2, err := builtins.StringOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+	n, err := builtins.IntOperand(c, 3)
+	if err != nil {
+		return nil, err
+	}
+	re, err := getRegexp(string(s1))
+	if err != nil {
+		return nil, err
+	}
+
+	elems := re.FindAllString(string(s2), n)
+	arr := make(ast.Array, len(elems))
+	for i := range elems {
+		arr[i] = ast.StringTerm(elems[i])
+	}
+	return arr, nil
+}
+
+func builtinRegexTemplateMatch(bctx BuiltinContext, operands []*ast.Term, iter func(*ast.Term) error) error {
+	template, err := builtins.StringOperand(operands[0].Value, 1)
+	if err != nil {
+		return handleBuiltinErr(ast.RegexTemplateMatch.Name, bctx.Location, err)
+	}
+	match, err := builtins.StringOperand(operands[1].Value, 2)
+	if err != nil {
+		return handleBuiltinErr(ast.RegexTemplateMatch.Name, bctx.Location, err)
+	}
+	start, err := builtins.StringOperand(operands[2].Value, 3)
+	if err != nil {
+		return handleBuiltinErr(ast.RegexTemplateMatch.Name, bctx.Location, err)
+	}
+	end, err := builtins.StringOperand(operands[3].Value, 4)
+	if err != nil {
+		return handleBuiltinErr(ast.RegexTemplateMatch.Name, bctx.Location, err)
+	}
+	if len(start) != 1 {
+		return handleBuiltinErr(ast.RegexTemplateMatch.Name, bctx.Location, builtins.NewOperandErr(3, "must be a single character delimiter but got %v", start))
+	}
+	if len(end) != 1 {
+		return handleBuiltinErr(ast.RegexTemplateMatch.Name, bctx.Location, builtins.NewOperandErr(4, "must be a single character delimiter but got %v", end))
+	}
+
+	key := string(template) + "\x00" + string(start) + string(end)
+	re, err := templateCache.Get(key, func() (*regexp.Regexp, error) {
+		return compileRegexTemplate(string(template), start[0], end[0])
+	})
+	if err != nil {
+		return handleBuiltinErr(ast.RegexTemplateMatch.Name, bctx.Location, err)
+	}
+
+	return iter(ast.BooleanTerm(re.MatchString(string(match))))
+}
+
+// compileRegexTemplate compiles a template such as "urn:foo:{[a-z]+}" where
+// the sections enclosed by the start and end delimiters are regular
+// expressions and the remaining sections are matched literally. Delimiters may
+// be nested inside the regular expressions as long as they are balanced.
+func compileRegexTemplate(template string, start, end byte) (*regexp.Regexp, error) {
+
+	var buf strings.Builder
+	buf.WriteString("^")
+
+	depth := 0
+	offset := 0
+
+	for i := 0; i < len(template); i++ {
+		switch template[i] {
+		case start:
+			if depth == 0 {
+				buf.WriteString(regexp.QuoteMeta(template[offset:i]))
+				offset = i + 1
+			}
+			depth++
+		case end:
+			if depth == 0 {
+				return nil, fmt.Errorf("unbalanced braces in template %q", template)
+			}
+			depth--
+			if depth == 0 {
+				pattern := template[offset:i]
+				if _, err := regexp.Compile(pattern); err != nil {
+					return nil, err
+				}
+				buf.WriteString("(?:" + pattern + ")")
+				offset = i + 1
+			}
 		}
-		regexpCache[pat] = re
 	}
-	return re, nil
+
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced braces in template %q", template)
+	}
+
+	buf.WriteString(regexp.QuoteMeta(template[offset:]))
+	buf.WriteString("$")
+
+	return regexp.Compile(buf.String())
+}
+
+func getRegexp(pat string) (*regexp.Regexp, error) {
+	return regexpCache.Get(pat, func() (*regexp.Regexp, error) {
+		return regexp.Compile(pat)
+	})
 }
 
 func builtinGlobsMatch(a, b ast.Value) (ast.Value, error) {
@@ -65,7 +233,9 @@ func builtinGlobsMatch(a, b ast.Value) (ast.Value, error) {
 }
 
 func init() {
-	regexpCache = map[string]*regexp.Regexp{}
 	RegisterFunctionalBuiltin2(ast.RegexMatch.Name, builtinRegexMatch)
+	RegisterFunctionalBuiltin2(ast.RegexSplit.Name, builtinRegexSplit)
+	RegisterFunctionalBuiltin3(ast.RegexFindN.Name, builtinRegexFindN)
+	RegisterBuiltinFunc(ast.RegexTemplateMatch.Name, builtinRegexTemplateMatch)
 	RegisterFunctionalBuiltin2(ast.GlobsMatch.Name, builtinGlobsMatch)
 }
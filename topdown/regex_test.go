@@ -0,0 +1,74 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+func TestCompiledCacheBounded(t *testing.T) {
+
+	cache := newCompiledCache(10)
+	compiles := 0
+
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				pat := fmt.Sprintf("^%d$", j)
+				re, err := cache.Get(pat, func() (*regexp.Regexp, error) {
+					mtx.Lock()
+					compiles++
+					mtx.Unlock()
+					return regexp.Compile(pat)
+				})
+				if err != nil || re.String() != pat {
+					t.Errorf("Unexpected result for %v: %v %v", pat, re, err)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if len(cache.entries) > 10 {
+		t.Fatalf("Expected at most 10 entries but got %d", len(cache.entries))
+	}
+
+	if compiles < 100 {
+		t.Fatalf("Expected at least 100 compilations but got %d", compiles)
+	}
+
+	re, err := cache.Get("^99$", func() (*regexp.Regexp, error) {
+		return nil, fmt.Errorf("expected cached value")
+	})
+	if err != nil || re.String() != "^99$" {
+		t.Fatalf("Expected cached value but got: %v %v", re, err)
+	}
+}
+
+func TestCompiledCacheError(t *testing.T) {
+
+	cache := newCompiledCache(10)
+
+	_, err := cache.Get("][", func() (*regexp.Regexp, error) {
+		return regexp.Compile("][")
+	})
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+
+	if len(cache.entries) != 0 {
+		t.Fatalf("Expected errors not to be cached but got %d entries", len(cache.entries))
+	}
+}
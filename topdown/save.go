@@ -1,6 +1,8 @@
 package topdown
 
 import (
+	"sort"
+
 	"github.com/open-policy-agent/opa/ast"
 )
 
@@ -253,9 +255,14 @@ func newSaveSupport() *saveSupport {
 }
 
 func (s *saveSupport) List() []*ast.Module {
-	result := []*ast.Module{}
-	for _, module := range s.modules {
-		result = append(result, module)
+	keys := make([]string, 0, len(s.modules))
+	for k := range s.modules {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	result := make([]*ast.Module, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, s.modules[k])
 	}
 	return result
 }
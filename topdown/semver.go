@@ -0,0 +1,145 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+)
+
+// semverRegexp matches versions as defined by Semantic Versioning 2.0.0.
+var semverRegexp = regexp.MustCompile(`^(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)` +
+	`(?:-((?:0|[1-9][0-9]*|[0-9]*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9][0-9]*|[0-9]*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+type semver struct {
+	major, minor, patch string
+	prerelease          []string
+}
+
+func parseSemver(s string) (semver, bool) {
+	m := semverRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return semver{}, false
+	}
+	v := semver{major: m[1], minor: m[2], patch: m[3]}
+	if m[4] != "" {
+		v.prerelease = strings.Split(m[4], ".")
+	}
+	return v, true
+}
+
+// Compare returns -1, 0, or 1 if v is less than, equal to, or greater than
+// other according to semantic version precedence. Build metadata is ignored.
+func (v semver) Compare(other semver) int {
+	for _, pair := range [][2]string{{v.major, other.major}, {v.minor, other.minor}, {v.patch, other.patch}} {
+		if c := compareNumericIdentifiers(pair[0], pair[1]); c != 0 {
+			return c
+		}
+	}
+
+	// A version without a pre-release has higher precedence than one with.
+	switch {
+	case len(v.prerelease) == 0 && len(other.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(other.prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.prerelease) && i < len(other.prerelease); i++ {
+		if c := comparePrereleaseIdentifiers(v.prerelease[i], other.prerelease[i]); c != 0 {
+			return c
+		}
+	}
+
+	return compareInts(len(v.prerelease), len(other.prerelease))
+}
+
+// comparePrereleaseIdentifiers compares pre-release identifiers. Numeric
+// identifiers are compared numerically and have lower precedence than
+// alphanumeric identifiers which are compared lexically.
+func comparePrereleaseIdentifiers(a, b string) int {
+	aNum, bNum := isNumericIdentifier(a), isNumericIdentifier(b)
+	switch {
+	case aNum && bNum:
+		return compareNumericIdentifiers(a, b)
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// compareNumericIdentifiers compares numeric identifiers of arbitrary size.
+// Identifiers do not contain leading zeroes so longer identifiers are larger.
+func compareNumericIdentifiers(a, b string) int {
+	if c := compareInts(len(a), len(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+func isNumericIdentifier(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func builtinSemverIsValid(a ast.Value) (ast.Value, error) {
+	s, ok := a.(ast.String)
+	if !ok {
+		return ast.Boolean(false), nil
+	}
+	_, ok = parseSemver(string(s))
+	return ast.Boolean(ok), nil
+}
+
+func builtinSemverCompare(a, b ast.Value) (ast.Value, error) {
+	s1, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	s2, err := builtins.StringOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	v1, ok := parseSemver(string(s1))
+	if !ok {
+		return nil, builtins.NewOperandErr(1, "must be a valid semantic version but got %v", s1)
+	}
+
+	v2, ok := parseSemver(string(s2))
+	if !ok {
+		return nil, builtins.NewOperandErr(2, "must be a valid semantic version but got %v", s2)
+	}
+
+	return ast.IntNumberTerm(v1.Compare(v2)).Value, nil
+}
+
+func init() {
+	RegisterFunctionalBuiltin1(ast.SemverIsValid.Name, builtinSemverIsValid)
+	RegisterFunctionalBuiltin2(ast.SemverCompare.Name, builtinSemverCompare)
+}
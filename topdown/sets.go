@@ -28,7 +28,7 @@ func builtinSetDiff(a, b ast.Value) (ast.Value, error) {
 // builtinSetIntersection returns the intersection of the given input sets
 func builtinSetIntersection(a ast.Value) (ast.Value, error) {
 
-	inputSet, err := builtins.SetOperand(a, 1)
+	inputSet, err := setsOperand(a)
 	if err != nil {
 		return nil, err
 	}
@@ -41,9 +41,9 @@ func builtinSetIntersection(a ast.Value) (ast.Value, error) {
 	var result ast.Set
 
 	err = inputSet.Iter(func(x *ast.Term) error {
-		n, err := builtins.SetOperand(x.Value, 1)
-		if err != nil {
-			return err
+		n, ok := x.Value.(ast.Set)
+		if !ok {
+			return builtins.NewOperandElementErr(1, a, x.Value, "set")
 		}
 
 		if result == nil {
@@ -59,7 +59,7 @@ func builtinSetIntersection(a ast.Value) (ast.Value, error) {
 // builtinSetUnion returns the union of the given input sets
 func builtinSetUnion(a ast.Value) (ast.Value, error) {
 
-	inputSet, err := builtins.SetOperand(a, 1)
+	inputSet, err := setsOperand(a)
 	if err != nil {
 		return nil, err
 	}
@@ -67,9 +67,9 @@ func builtinSetUnion(a ast.Value) (ast.Value, error) {
 	result := ast.NewSet()
 
 	err = inputSet.Iter(func(x *ast.Term) error {
-		n, err := builtins.SetOperand(x.Value, 1)
-		if err != nil {
-			return err
+		n, ok := x.Value.(ast.Set)
+		if !ok {
+			return builtins.NewOperandElementErr(1, a, x.Value, "set")
 		}
 		result = result.Union(n)
 		return nil
@@ -77,6 +77,18 @@ func builtinSetUnion(a ast.Value) (ast.Value, error) {
 	return result, err
 }
 
+// setsOperand returns the collection of sets given to the union and
+// intersection built-ins. The sets may be given as a set or an array.
+func setsOperand(a ast.Value) (ast.Set, error) {
+	switch a := a.(type) {
+	case ast.Set:
+		return a, nil
+	case ast.Array:
+		return ast.NewSet(a...), nil
+	}
+	return nil, builtins.NewOperandTypeErr(1, a, "set", "array")
+}
+
 func init() {
 	RegisterFunctionalBuiltin2(ast.SetDiff.Name, builtinSetDiff)
 	RegisterFunctionalBuiltin1(ast.Intersection.Name, builtinSetIntersection)
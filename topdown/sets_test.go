@@ -20,6 +20,8 @@ func TestIntersection(t *testing.T) {
 		{"intersection_2_sets", []string{`p = x { s1 = {1, 2, 3}; s2 = {2}; intersection({s1, s2}, x) }`}, "[2]"},
 		{"intersection_3_sets", []string{`p = x { s1 = {1, 2, 3}; s2 = {2, 3, 4}; s3 = {4, 5, 6}; intersection({s1, s2, s3}, x) }`}, "[]"},
 		{"intersection_4_sets", []string{`p = x { s1 = {"a", "b", "c", "d"}; s2 = {"b", "c", "d"}; s3 = {"c", "d"}; s4 = {"d"}; intersection({s1, s2, s3, s4}, x) }`}, "[\"d\"]"},
+		{"intersection_array", []string{`p = x { intersection([{1, 2, 3}, {2, 3, 4}, {3, 2}], x) }`}, "[2, 3]"},
+		{"intersection_array_empty", []string{`p = x { intersection([], x) }`}, "[]"},
 	}
 
 	data := loadSmallTestData()
@@ -41,6 +43,8 @@ func TestUnion(t *testing.T) {
 		{"union_2_sets", []string{`p = x { s1 = {1, 2, 3}; s2 = {2}; union({s1, s2}, x) }`}, "[1, 2, 3]"},
 		{"union_3_sets", []string{`p = x { s1 = {1, 2, 3}; s2 = {2, 3, 4}; s3 = {4, 5, 6}; union({s1, s2, s3}, x) }`}, "[1, 2, 3, 4, 5, 6]"},
 		{"union_4_sets", []string{`p = x { s1 = {"a", "b", "c", "d"}; s2 = {"b", "c", "d"}; s3 = {"c", "d"}; s4 = {"d"}; union({s1, s2, s3, s4}, x) }`}, "[\"a\", \"b\", \"c\", \"d\"]"},
+		{"union_array", []string{`p = x { union([{1, 2}, {2, 3}, {1, 2}], x) }`}, "[1, 2, 3]"},
+		{"union_comprehension", []string{`p = x { union([s | s = {a[i]}], x) }`}, "[1, 2, 3, 4]"},
 	}
 
 	data := loadSmallTestData()
@@ -6,6 +6,8 @@ package topdown
 
 import (
 	"fmt"
+	"math/big"
+	"sort"
 	"strings"
 
 	"github.com/open-policy-agent/opa/ast"
@@ -220,6 +222,34 @@ func builtinReplace(a, b, c ast.Value) (ast.Value, error) {
 	return ast.String(strings.Replace(string(s), string(old), string(new), -1)), nil
 }
 
+func builtinReplaceN(a, b ast.Value) (ast.Value, error) {
+	patterns, err := builtins.ObjectOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := builtins.StringOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := patterns.Keys()
+	oldnew := make([]string, 0, len(keys)*2)
+	for _, k := range sortedTerms(keys) {
+		old, ok := k.Value.(ast.String)
+		if !ok {
+			return nil, builtins.NewOperandErr(1, "must be object with string keys but got %v key", ast.TypeName(k.Value))
+		}
+		new, ok := patterns.Get(k).Value.(ast.String)
+		if !ok {
+			return nil, builtins.NewOperandErr(1, "must be object with string values but got %v value", ast.TypeName(patterns.Get(k).Value))
+		}
+		oldnew = append(oldnew, string(old), string(new))
+	}
+
+	return ast.String(strings.NewReplacer(oldnew...).Replace(string(s))), nil
+}
+
 func builtinTrim(a, b ast.Value) (ast.Value, error) {
 	s, err := builtins.StringOperand(a, 1)
 	if err != nil {
@@ -247,9 +277,12 @@ func builtinSprintf(a, b ast.Value) (ast.Value, error) {
 
 	strArr := []interface{}{}
 	for i := range astArr {
-		if str, ok := astArr[i].Value.(ast.String); ok {
-			strArr = append(strArr, string(str))
-		} else {
+		switch v := astArr[i].Value.(type) {
+		case ast.String:
+			strArr = append(strArr, string(v))
+		case ast.Number:
+			strArr = append(strArr, sprintfNumber(v))
+		default:
 			strArr = append(strArr, astArr[i].Value.String())
 		}
 	}
@@ -258,6 +291,64 @@ func builtinSprintf(a, b ast.Value) (ast.Value, error) {
 	return ast.String(fmtStr), nil
 }
 
+// sprintfNumber formats numbers according to the verb given in the format
+// string. Integer verbs (e.g., %d, %x) and floating-point verbs (e.g., %f, %e)
+// are applied to the exact value whereas all other verbs treat the number as a
+// string so that existing "%v" and "%s" formats are unchanged.
+type sprintfNumber ast.Number
+
+func (n sprintfNumber) Format(f fmt.State, verb rune) {
+	format := sprintfVerb(f, verb)
+	switch verb {
+	case 'b', 'd', 'o', 'x', 'X':
+		if i, ok := new(big.Int).SetString(string(n), 10); ok {
+			fmt.Fprintf(f, format, i)
+			return
+		}
+		if x, ok := new(big.Float).SetString(string(n)); ok && x.IsInt() {
+			i, _ := x.Int(nil)
+			fmt.Fprintf(f, format, i)
+			return
+		}
+		fmt.Fprintf(f, "%%!%c(number=%v)", verb, string(n))
+	case 'e', 'E', 'f', 'F', 'g', 'G':
+		if x, ok := new(big.Float).SetString(string(n)); ok {
+			fmt.Fprintf(f, format, x)
+			return
+		}
+		fmt.Fprintf(f, "%%!%c(number=%v)", verb, string(n))
+	default:
+		fmt.Fprintf(f, format, string(n))
+	}
+}
+
+// sprintfVerb reconstructs the formatting directive from the state so that
+// flags, width, and precision are preserved.
+func sprintfVerb(f fmt.State, verb rune) string {
+	format := "%"
+	for _, flag := range "+-# 0" {
+		if f.Flag(int(flag)) {
+			format += string(flag)
+		}
+	}
+	if w, ok := f.Width(); ok {
+		format += fmt.Sprint(w)
+	}
+	if p, ok := f.Precision(); ok {
+		format += "." + fmt.Sprint(p)
+	}
+	return format + string(verb)
+}
+
+func sortedTerms(ts []*ast.Term) []*ast.Term {
+	cpy := make([]*ast.Term, len(ts))
+	copy(cpy, ts)
+	sort.Slice(cpy, func(i, j int) bool {
+		return cpy[i].Value.Compare(cpy[j].Value) < 0
+	})
+	return cpy
+}
+
 func init() {
 	RegisterFunctionalBuiltin2(ast.FormatInt.Name, builtinFormatInt)
 	RegisterFunctionalBuiltin2(ast.Concat.Name, builtinConcat)
@@ -270,6 +361,7 @@ func init() {
 	RegisterFunctionalBuiltin1(ast.Lower.Name, builtinLower)
 	RegisterFunctionalBuiltin2(ast.Split.Name, builtinSplit)
 	RegisterFunctionalBuiltin3(ast.Replace.Name, builtinReplace)
+	RegisterFunctionalBuiltin2(ast.ReplaceN.Name, builtinReplaceN)
 	RegisterFunctionalBuiltin2(ast.Trim.Name, builtinTrim)
 	RegisterFunctionalBuiltin2(ast.Sprintf.Name, builtinSprintf)
 }
@@ -83,41 +83,175 @@ func builtinParseDurationNanos(a ast.Value) (ast.Value, error) {
 }
 
 func builtinDate(a ast.Value) (ast.Value, error) {
-
-	value, err := builtins.NumberOperand(a, 1)
+	t, err := tzTime(a, 1)
 	if err != nil {
 		return nil, err
 	}
-
-	f := builtins.NumberToFloat(value)
-	i64, acc := f.Int64()
-	if acc != big.Exact {
-		return nil, fmt.Errorf("timestamp too big")
-	}
-
-	t := time.Unix(0, i64).UTC()
 	year, month, day := t.Date()
 	result := ast.Array{ast.IntNumberTerm(year), ast.IntNumberTerm(int(month)), ast.IntNumberTerm(day)}
 	return result, nil
 }
 
 func builtinClock(a ast.Value) (ast.Value, error) {
+	t, err := tzTime(a, 1)
+	if err != nil {
+		return nil, err
+	}
+	hour, minute, second := t.Clock()
+	result := ast.Array{ast.IntNumberTerm(hour), ast.IntNumberTerm(minute), ast.IntNumberTerm(second)}
+	return result, nil
+}
 
-	value, err := builtins.NumberOperand(a, 1)
+func builtinWeekday(a ast.Value) (ast.Value, error) {
+	t, err := tzTime(a, 1)
 	if err != nil {
 		return nil, err
 	}
+	return ast.String(t.Weekday().String()), nil
+}
+
+func builtinAddDate(bctx BuiltinContext, operands []*ast.Term, iter func(*ast.Term) error) error {
+	t, err := tzTime(operands[0].Value, 1)
+	if err != nil {
+		return handleBuiltinErr(ast.AddDate.Name, bctx.Location, err)
+	}
+
+	years, err := builtins.IntOperand(operands[1].Value, 2)
+	if err != nil {
+		return handleBuiltinErr(ast.AddDate.Name, bctx.Location, err)
+	}
+
+	months, err := builtins.IntOperand(operands[2].Value, 3)
+	if err != nil {
+		return handleBuiltinErr(ast.AddDate.Name, bctx.Location, err)
+	}
+
+	days, err := builtins.IntOperand(operands[3].Value, 4)
+	if err != nil {
+		return handleBuiltinErr(ast.AddDate.Name, bctx.Location, err)
+	}
+
+	result := t.AddDate(years, months, days)
+	if result.Year() < 1678 || result.Year() > 2261 {
+		return handleBuiltinErr(ast.AddDate.Name, bctx.Location, fmt.Errorf("time outside of valid range"))
+	}
+
+	return iter(ast.NewTerm(ast.Number(int64ToJSONNumber(result.UnixNano()))))
+}
+
+func builtinDiff(a, b ast.Value) (ast.Value, error) {
+	t1, err := tzTime(a, 1)
+	if err != nil {
+		return nil, err
+	}
+	t2, err := tzTime(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	// The difference is computed in the location of the first argument so
+	// that calendar units (e.g., days) are counted consistently.
+	t2 = t2.In(t1.Location())
+	if t1.After(t2) {
+		t1, t2 = t2, t1
+	}
+
+	y1, M1, d1 := t1.Date()
+	y2, M2, d2 := t2.Date()
+	h1, m1, s1 := t1.Clock()
+	h2, m2, s2 := t2.Clock()
+
+	year := y2 - y1
+	month := int(M2 - M1)
+	day := d2 - d1
+	hour := h2 - h1
+	min := m2 - m1
+	sec := s2 - s1
+
+	if sec < 0 {
+		sec += 60
+		min--
+	}
+	if min < 0 {
+		min += 60
+		hour--
+	}
+	if hour < 0 {
+		hour += 24
+		day--
+	}
+	if day < 0 {
+		// Borrow the number of days in the month preceding t2.
+		day += time.Date(y2, M2, 0, 0, 0, 0, 0, time.UTC).Day()
+		month--
+	}
+	if month < 0 {
+		month += 12
+		year--
+	}
+
+	return ast.Array{
+		ast.IntNumberTerm(year), ast.IntNumberTerm(month), ast.IntNumberTerm(day),
+		ast.IntNumberTerm(hour), ast.IntNumberTerm(min), ast.IntNumberTerm(sec),
+	}, nil
+}
+
+// tzTime returns the time represented by a which is either a number of
+// nanoseconds since epoch or a [ns, tz] array where tz is an IANA time zone
+// name (e.g., "Europe/Paris"), "Local", or "" (for UTC). Errors refer to a as
+// the operand at position pos.
+func tzTime(a ast.Value, pos int) (t time.Time, err error) {
+
+	var nVal ast.Value
+	loc := time.UTC
+
+	switch va := a.(type) {
+	case ast.Array:
+		if len(va) != 2 {
+			return time.Time{}, builtins.NewOperandErr(pos, "array must have 2 elements but got %d", len(va))
+		}
+
+		nVal, err = builtins.NumberOperand(va[0].Value, pos)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		var tz ast.String
+		tz, err = builtins.StringOperand(va[1].Value, pos)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		switch tz {
+		case "", "UTC":
+		case "Local":
+			loc = time.Local
+		default:
+			loc, err = time.LoadLocation(string(tz))
+			if err != nil {
+				return time.Time{}, err
+			}
+		}
+
+	case ast.Number:
+		nVal = a
+
+	default:
+		return time.Time{}, builtins.NewOperandTypeErr(pos, a, "number", "array")
+	}
+
+	value, err := builtins.NumberOperand(nVal, pos)
+	if err != nil {
+		return time.Time{}, err
+	}
 
 	f := builtins.NumberToFloat(value)
 	i64, acc := f.Int64()
 	if acc != big.Exact {
-		return nil, fmt.Errorf("timestamp too big")
+		return time.Time{}, fmt.Errorf("timestamp too big")
 	}
 
-	t := time.Unix(0, i64).UTC()
-	hour, minute, second := t.Clock()
-	result := ast.Array{ast.IntNumberTerm(hour), ast.IntNumberTerm(minute), ast.IntNumberTerm(second)}
-	return result, nil
+	return time.Unix(0, i64).In(loc), nil
 }
 
 func int64ToJSONNumber(i int64) json.Number {
@@ -131,4 +265,7 @@ func init() {
 	RegisterFunctionalBuiltin1(ast.ParseDurationNanos.Name, builtinParseDurationNanos)
 	RegisterFunctionalBuiltin1(ast.Date.Name, builtinDate)
 	RegisterFunctionalBuiltin1(ast.Clock.Name, builtinClock)
+	RegisterFunctionalBuiltin1(ast.Weekday.Name, builtinWeekday)
+	RegisterBuiltinFunc(ast.AddDate.Name, builtinAddDate)
+	RegisterFunctionalBuiltin2(ast.Diff.Name, builtinDiff)
 }
@@ -21,14 +21,17 @@ import (
 func TestTopDownPartialEval(t *testing.T) {
 
 	tests := []struct {
-		note        string
-		unknowns    []string
-		query       string
-		modules     []string
-		data        string
-		input       string
-		wantQueries []string
-		wantSupport []string
+		note            string
+		unknowns        []string
+		disableInlining []string
+		shallowInlining bool
+		copyPropagation bool
+		query           string
+		modules         []string
+		data            string
+		input           string
+		wantQueries     []string
+		wantSupport     []string
 	}{
 		{
 			note:        "empty",
@@ -433,6 +436,13 @@ func TestTopDownPartialEval(t *testing.T) {
 				`time.now_ns(x)`,
 			},
 		},
+		{
+			note:  "save: ignore x509 verification",
+			query: `crypto.x509.parse_and_verify_certificates("a", "b", {}, x)`,
+			wantQueries: []string{
+				`crypto.x509.parse_and_verify_certificates("a", "b", {}, x)`,
+			},
+		},
 		{
 			note:  "support: default trivial",
 			query: "data.test.p = x",
@@ -671,6 +681,123 @@ func TestTopDownPartialEval(t *testing.T) {
 				__not0_2__(x, y) { 2 = x; 3 = y }`,
 			},
 		},
+		{
+			note:            "disable inlining: partial set",
+			query:           "data.test.p = true",
+			disableInlining: []string{"data.test.q"},
+			modules: []string{
+				`package test
+
+				p { input.x = 1; q[input.y] }
+				q[x] { x = input.z }
+				q["a"]`,
+			},
+			wantQueries: []string{
+				`input.x = 1; __local0__1 = input.y; data.partial.test.q[__local0__1] = x_term_1_21; neq(x_term_1_21, false)`,
+			},
+			wantSupport: []string{
+				`package partial.test
+
+				q[x] { x = input.z }
+				q["a"] { true }`,
+			},
+		},
+		{
+			note:            "disable inlining: package",
+			query:           "data.test.p = x",
+			disableInlining: []string{"data.test"},
+			modules: []string{
+				`package test
+
+				default p = false
+				p { input.x = 1; q }
+				q { input.y = 2 }`,
+			},
+			wantQueries: []string{
+				`data.partial.test.p = x`,
+			},
+			wantSupport: []string{
+				`package partial.test
+
+				q { input.y = 2 }
+				p { input.x = 1; data.partial.test.q = x_term_1_1; neq(x_term_1_1, false) }
+				default p = false`,
+			},
+		},
+		{
+			note:            "shallow inlining",
+			query:           "data.test.p = true",
+			shallowInlining: true,
+			modules: []string{
+				`package test
+
+				p { q; r }
+				q { input.x = 1 }
+				r { data.test.s = 2 }
+				s = 2`,
+			},
+			wantQueries: []string{
+				`data.partial.test.p = true`,
+			},
+			wantSupport: []string{
+				`package partial.test
+
+				q { input.x = 1 }
+				p { data.partial.test.q = x_term_1_0; neq(x_term_1_0, false) }`,
+			},
+		},
+		{
+			note:            "copy propagation",
+			query:           "data.test.p = x",
+			copyPropagation: true,
+			modules: []string{
+				`package test
+
+				p = y { z = input.x; y = z; z > 1; input.y = w; w = w }
+				p = y { z = input.x; y = z; z > 1; input.y = w }`,
+			},
+			wantQueries: []string{
+				`input.x > 1; input.y = w1; input.x = x`,
+			},
+		},
+		{
+			note:            "copy propagation: definedness",
+			query:           "data.test.p = true",
+			copyPropagation: true,
+			modules: []string{
+				`package test
+
+				p { x = input.x; not x = 1 }`,
+			},
+			wantQueries: []string{
+				`x1 = input.x; not data.partial.__not1_1__(x1)`,
+			},
+			wantSupport: []string{
+				`package partial
+
+				__not1_1__(x) = true { x = 1 }`,
+			},
+		},
+		{
+			note:            "copy propagation: support",
+			query:           "data.test.p = x",
+			copyPropagation: true,
+			disableInlining: []string{"data.test.p"},
+			modules: []string{
+				`package test
+
+				p = y { z = input.x; y = z }
+				p = y { y = input.x }`,
+			},
+			wantQueries: []string{
+				`data.partial.test.p = x`,
+			},
+			wantSupport: []string{
+				`package partial.test
+
+				p = y { y = input.x }`,
+			},
+		},
 	}
 
 	ctx := context.Background()
@@ -708,6 +835,17 @@ func TestTopDownPartialEval(t *testing.T) {
 				WithTracer(&buf).
 				WithUnknowns(unknowns)
 
+			if len(tc.disableInlining) > 0 {
+				paths := make([]ast.Ref, len(tc.disableInlining))
+				for i := range tc.disableInlining {
+					paths[i] = ast.MustParseRef(tc.disableInlining[i])
+				}
+				query = query.WithDisableInlining(paths)
+			}
+
+			query = query.WithShallowInlining(tc.shallowInlining).
+				WithCopyPropagation(tc.copyPropagation)
+
 			// Set genvarprefix so that tests can refer to vars in generated
 			// expressions.
 			query.genvarprefix = "x"
@@ -1024,6 +1024,61 @@ func TestTopDownAggregates(t *testing.T) {
 	}
 }
 
+func TestTopDownArrays(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"concat", []string{`p = x { x = array.concat([1, 2], [3, 4]) }`}, "[1, 2, 3, 4]"},
+		{"concat: empty", []string{`p = x { x = array.concat([], []) }`}, "[]"},
+		{"slice", []string{`p = x { x = array.slice([1, 2, 3, 4, 5], 1, 3) }`}, "[2, 3]"},
+		{"slice: clamped", []string{`p = x { x = array.slice([1, 2, 3], -10, 10) }`}, "[1, 2, 3]"},
+		{"slice: empty", []string{`p = x { x = array.slice([1, 2, 3], 2, 1) }`}, "[]"},
+		{"slice: float index", []string{`p = x { x = array.slice([1, 2, 3], 0.5, 1) }`}, fmt.Errorf("operand 2 must be integer number but got floating-point number")},
+		{"reverse", []string{`p = x { x = array.reverse([1, [2], "3"]) }`}, `["3", [2], 1]`},
+		{"reverse: empty", []string{`p = x { x = array.reverse([]) }`}, "[]"},
+		{"any: array", []string{`p = x { x = any([false, true]) }`}, "true"},
+		{"any: set", []string{`p = x { x = any({false}) }`}, "false"},
+		{"any: empty", []string{`p = x { x = any([]) }`}, "false"},
+		{"any: non-boolean", []string{`p = x { x = any([1, "true"]) }`}, "false"},
+		{"all: array", []string{`p = x { x = all([true, true]) }`}, "true"},
+		{"all: set", []string{`p = x { x = all({true, false}) }`}, "false"},
+		{"all: empty", []string{`p = x { x = all(set()) }`}, "true"},
+		{"all: refs", []string{`p { all([x | x = a[_] > 0]) }`}, "true"},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestTopDownNumbersRange(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"ascending", []string{`p = x { x = numbers.range(1, 4) }`}, "[1, 2, 3, 4]"},
+		{"descending", []string{`p = x { x = numbers.range(2, -1) }`}, "[2, 1, 0, -1]"},
+		{"single", []string{`p = x { x = numbers.range(3, 3) }`}, "[3]"},
+		{"max", []string{`p = x { x = count(numbers.range(0, 1000000)) }`}, "1000001"},
+		{"too large", []string{`p = x { x = numbers.range(1, 100000000) }`}, fmt.Errorf("operand 2 must not differ from operand 1 by more than 1000000")},
+		{"too large descending", []string{`p = x { x = numbers.range(1000000, -1) }`}, fmt.Errorf("operand 2 must not differ from operand 1 by more than 1000000")},
+		{"float", []string{`p = x { x = numbers.range(1, 2.5) }`}, fmt.Errorf("operand 2 must be integer number but got floating-point number")},
+	}
+
+	// The small test data contains a "numbers" document that would shadow
+	// the built-in namespace.
+	data := map[string]interface{}{}
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
 func TestTopDownArithmetic(t *testing.T) {
 	tests := []struct {
 		note     string
@@ -1064,6 +1119,16 @@ func TestTopDownCasts(t *testing.T) {
 		{"to_number ref dest", []string{`p = true { to_number("3", a[2]) }`}, "true"},
 		{"to_number ref dest", []string{`p = true { not to_number("-1", a[2]) }`}, "true"},
 		{"to_number: bad input", []string{`p { to_number("broken", x) }`}, fmt.Errorf("invalid syntax")},
+		{"cast_array", []string{`p = [x, y] { x := cast_array([3, 1, 3]); y := cast_array({3, 1, 2}) }`}, "[[3, 1, 3], [1, 2, 3]]"},
+		{"cast_array: bad input", []string{`p = x { x := cast_array(data.b) }`}, fmt.Errorf("operand 1 must be one of {array, set} but got object")},
+		{"cast_set", []string{`p = [x, y] { x := cast_set([3, 1, 3]) == {1, 3}; y := cast_set({2}) }`}, "[true, [2]]"},
+		{"cast_set: bad input", []string{`p = x { x := cast_set(data.b.v1) }`}, fmt.Errorf("operand 1 must be one of {array, set} but got string")},
+		{"cast_string", []string{`p = x { x := cast_string(data.b.v1) }`}, `"hello"`},
+		{"cast_string: bad input", []string{`p = x { x := cast_string(data.a[0]) }`}, fmt.Errorf("operand 1 must be string but got number")},
+		{"cast_boolean", []string{`p = x { x := cast_boolean(data.c[0].z.p) }`}, "true"},
+		{"cast_boolean: bad input", []string{`p = x { x := cast_boolean(data.c[0].y[0]) }`}, fmt.Errorf("operand 1 must be boolean but got null")},
+		{"cast_object", []string{`p = x { x := cast_object(data.d) }`}, `{"e": ["bar", "baz"]}`},
+		{"cast_object: bad input", []string{`p = x { x := cast_object(data.a) }`}, fmt.Errorf("operand 1 must be object but got array")},
 	}
 
 	data := loadSmallTestData()
@@ -1210,6 +1275,18 @@ func TestTopDownRegexMatch(t *testing.T) {
 
 		{"re_match: raw", []string{fmt.Sprintf(`p = true { re_match(%s, "foo[1]") }`, "`^[a-z]+\\[[0-9]+\\]$`")}, "true"},
 		{"re_match: raw: undefined", []string{fmt.Sprintf(`p = true { re_match(%s, "foo[\"bar\"]") }`, "`^[a-z]+\\[[0-9]+\\]$`")}, ""},
+
+		{"regex.split", []string{`p = x { regex.split("[,;]\\s*", "a, b;c", x) }`}, `["a", "b", "c"]`},
+		{"regex.split: no match", []string{`p = x { regex.split("-", "abc", x) }`}, `["abc"]`},
+		{"regex.find_n", []string{`p = x { regex.find_n("[0-9]+", "a1b22c333", 2, x) }`}, `["1", "22"]`},
+		{"regex.find_n: all", []string{`p = x { regex.find_n("[0-9]+", "a1b22c333", -1, x) }`}, `["1", "22", "333"]`},
+		{"regex.find_n: bad pattern err", []string{`p = x { regex.find_n("][", "a", -1, x) }`}, fmt.Errorf("regex.find_n: error parsing regexp: missing closing ]: `[`")},
+		{"regex.template_match", []string{`p = true { regex.template_match("urn:foo:{[a-z]+}:bar", "urn:foo:baz:bar", "{", "}") }`}, "true"},
+		{"regex.template_match: literal", []string{`p = true { regex.template_match("urn.foo:{[a-z]+}", "urnxfoo:baz", "{", "}") }`}, ""},
+		{"regex.template_match: nested", []string{`p = true { regex.template_match("urn:foo:<[0-9]{2}>", "urn:foo:42", "{", "}") }`}, ""},
+		{"regex.template_match: nested delimiters", []string{`p = true { regex.template_match("urn:foo:{[0-9]{2}}", "urn:foo:42", "{", "}") }`}, "true"},
+		{"regex.template_match: other delimiters", []string{`p = true { regex.template_match("urn:foo:<[0-9]{2}>", "urn:foo:42", "<", ">") }`}, "true"},
+		{"regex.template_match: unbalanced", []string{`p = true { regex.template_match("urn:foo:{[a-z]+", "urn:foo:baz", "{", "}") }`}, fmt.Errorf("unbalanced braces in template")},
 	}
 
 	data := loadSmallTestData()
@@ -1241,6 +1318,37 @@ func TestTopDownGlobsMatch(t *testing.T) {
 	}
 }
 
+func TestTopDownGlobMatch(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"star", []string{`p = true { glob.match("repo/*/branch", ["/"], "repo/opa/branch") }`}, "true"},
+		{"star: delimiter", []string{`p = true { glob.match("repo/*/branch", ["/"], "repo/opa/x/branch") }`}, ""},
+		{"super star", []string{`p = true { glob.match("repo/*/branch/**", ["/"], "repo/opa/branch/feature/x") }`}, "true"},
+		{"question mark", []string{`p = true { glob.match("?at", [], "cat") }`}, "true"},
+		{"question mark: delimiter", []string{`p = true { glob.match("a?b", [], "a.b") }`}, ""},
+		{"default delimiter", []string{`p = true { glob.match("*.example.com", [], "api.example.com") }`}, "true"},
+		{"default delimiter: undefined", []string{`p = true { glob.match("*.example.com", [], "a.b.example.com") }`}, ""},
+		{"multiple delimiters", []string{`p = true { glob.match("*:*", [".", ":"], "a.b:c") }`}, ""},
+		{"character class", []string{`p = true { glob.match("[a-c]at", [], "bat") }`}, "true"},
+		{"character class: negated", []string{`p = true { glob.match("[!a-c]at", [], "bat") }`}, ""},
+		{"alternatives", []string{`p = true { glob.match("{api,www}.example.com", [], "www.example.com") }`}, "true"},
+		{"escape", []string{`p = true { glob.match("a\\*", [], "a*") }`}, "true"},
+		{"escape: undefined", []string{`p = true { glob.match("a\\*", [], "ab") }`}, ""},
+		{"ref", []string{`p[x] { glob.match("b*", [], d.e[x]) }`}, "[0,1]"},
+		{"bad pattern", []string{`p = true { glob.match("[a-c", [], "a") }`}, fmt.Errorf("glob.match: unterminated character class in pattern")},
+		{"bad delimiter", []string{`p = true { glob.match("*", ["ab"], "a") }`}, fmt.Errorf("operand 2 must contain single character delimiters but got \"ab\"")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
 func TestTopDownSets(t *testing.T) {
 	tests := []struct {
 		note     string
@@ -1310,6 +1418,93 @@ func TestTopDownStrings(t *testing.T) {
 		{"sprintf: float", []string{`p = x { sprintf("hi %s", [3.14], x) }`}, `"hi 3.14"`},
 		{"sprintf: bool", []string{`p = x { sprintf("hi %s", [true], x) }`}, `"hi true"`},
 		{"sprintf: composite", []string{`p = x { sprintf("hi %s", [["there", 5, 3.14]], x) }`}, `"hi [\"there\", 5, 3.14]"`},
+		{"sprintf: int verbs", []string{`p = x { sprintf("%d %03d %x", [5, 7, 255], x) }`}, `"5 007 ff"`},
+		{"sprintf: exponent int", []string{`p = x { sprintf("%d", [1e3], x) }`}, `"1000"`},
+		{"sprintf: float verbs", []string{`p = x { sprintf("%.2f", [3.14159], x) }`}, `"3.14"`},
+		{"sprintf: int verb with float", []string{`p = x { sprintf("%d", [3.5], x) }`}, `"%!d(number=3.5)"`},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestTopDownStringsReplaceN(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"strings.replace_n", []string{`p = x { strings.replace_n({"<": "&lt;", ">": "&gt;"}, "<a>", x) }`}, `"&lt;a&gt;"`},
+		{"strings.replace_n: no overlap", []string{`p = x { strings.replace_n({"a": "b", "b": "c"}, "ab", x) }`}, `"bc"`},
+	}
+
+	// The small test data contains a "strings" document that would shadow
+	// the built-in namespace.
+	data := map[string]interface{}{}
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestTopDownObjectBuiltins(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"get", []string{`p = x { x := object.get({"a": 1}, "a", 0) }`}, "1"},
+		{"get: default", []string{`p = x { x := object.get({"a": 1}, "b", 0) }`}, "0"},
+		{"get: composite key", []string{`p = x { x := object.get({[1, 2]: "a"}, [1, 2], "b") }`}, `"a"`},
+		{"get: false value", []string{`p = x { x := object.get({"a": false}, "a", true) }`}, "false"},
+		{"remove: array", []string{`p = x { x := object.remove({"a": 1, "b": 2, "c": 3}, ["a", "c"]) }`}, `{"b": 2}`},
+		{"remove: set", []string{`p = x { x := object.remove({"a": 1, "b": 2}, {"b", "d"}) }`}, `{"a": 1}`},
+		{"remove: object", []string{`p = x { x := object.remove({"a": 1, "b": 2}, {"a": "ignored"}) }`}, `{"b": 2}`},
+		{"filter", []string{`p = x { x := object.filter({"a": 1, "b": 2, "c": 3}, ["a", "c"]) }`}, `{"a": 1, "c": 3}`},
+		{"filter: missing", []string{`p = x { x := object.filter({"a": 1}, {"b"}) }`}, `{}`},
+		{"union", []string{`p = x { x := object.union({"a": 1, "b": 2}, {"b": 3, "c": 4}) }`}, `{"a": 1, "b": 3, "c": 4}`},
+		{"union: deep", []string{`p = x { x := object.union({"a": {"b": 1, "c": [1]}}, {"a": {"c": [2], "d": 3}}) }`}, `{"a": {"b": 1, "c": [2], "d": 3}}`},
+		{"union: replace object", []string{`p = x { x := object.union({"a": {"b": 1}}, {"a": 1}) }`}, `{"a": 1}`},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestTopDownJSONFilterRemovePatch(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"filter", []string{`p = x { x := json.filter({"a": {"b": 1, "c": 2}, "d": 3}, ["a/b", "d"]) }`}, `{"a": {"b": 1}, "d": 3}`},
+		{"filter: array path", []string{`p = x { x := json.filter({"a": {"b/c": 1, "d": 2}}, [["a", "b/c"]]) }`}, `{"a": {"b/c": 1}}`},
+		{"filter: array index", []string{`p = x { x := json.filter({"a": [{"b": 1, "c": 2}, {"b": 3}, 4]}, {"a/0/b", "a/2"}) }`}, `{"a": [{"b": 1}, 4]}`},
+		{"filter: prefix", []string{`p = x { x := json.filter({"a": {"b": 1, "c": 2}}, ["a/b", "a"]) }`}, `{"a": {"b": 1, "c": 2}}`},
+		{"filter: missing", []string{`p = x { x := json.filter({"a": 1}, ["a/b/c", "e"]) }`}, `{}`},
+		{"remove", []string{`p = x { x := json.remove({"a": {"b": 1, "c": 2}, "d": 3}, ["a/b", "d"]) }`}, `{"a": {"c": 2}}`},
+		{"remove: array index", []string{`p = x { x := json.remove({"a": [1, 2, 3]}, [["a", 1]]) }`}, `{"a": [1, 3]}`},
+		{"remove: missing", []string{`p = x { x := json.remove({"a": 1}, ["b/c"]) }`}, `{"a": 1}`},
+		{"patch: add", []string{`p = x { x := json.patch({"a": {}}, [{"op": "add", "path": "/a/b", "value": 1}]) }`}, `{"a": {"b": 1}}`},
+		{"patch: add array", []string{`p = x { x := json.patch({"a": [1, 3]}, [{"op": "add", "path": "/a/1", "value": 2}, {"op": "add", "path": "/a/-", "value": 4}]) }`}, `{"a": [1, 2, 3, 4]}`},
+		{"patch: remove", []string{`p = x { x := json.patch({"a": {"b": 1, "c": 2}}, [{"op": "remove", "path": "/a/b"}]) }`}, `{"a": {"c": 2}}`},
+		{"patch: replace", []string{`p = x { x := json.patch({"a": [1, 2]}, [{"op": "replace", "path": "/a/0", "value": 3}]) }`}, `{"a": [3, 2]}`},
+		{"patch: move", []string{`p = x { x := json.patch({"a": {"b": 1}}, [{"op": "move", "from": "/a/b", "path": "/c"}]) }`}, `{"a": {}, "c": 1}`},
+		{"patch: copy", []string{`p = x { x := json.patch({"a": {"b": 1}}, [{"op": "copy", "from": "/a", "path": "/c"}]) }`}, `{"a": {"b": 1}, "c": {"b": 1}}`},
+		{"patch: test", []string{`p = x { x := json.patch({"a": 1}, [{"op": "test", "path": "/a", "value": 1}, {"op": "add", "path": "/b", "value": 2}]) }`}, `{"a": 1, "b": 2}`},
+		{"patch: test failed", []string{`p = x { x := json.patch({"a": 1}, [{"op": "test", "path": "/a", "value": 2}]) }`}, ``},
+		{"patch: missing path", []string{`p = x { x := json.patch({"a": 1}, [{"op": "remove", "path": "/b"}]) }`}, ``},
+		{"patch: escaped pointer", []string{`p = x { x := json.patch({"a/b": {"c~d": 1}}, [{"op": "replace", "path": "/a~1b/c~0d", "value": 2}]) }`}, `{"a/b": {"c~d": 2}}`},
+		{"patch: array path", []string{`p = x { x := json.patch({"a": [{"b": 1}]}, [{"op": "add", "path": ["a", 0, "c"], "value": 2}]) }`}, `{"a": [{"b": 1, "c": 2}]}`},
+		{"patch: root", []string{`p = x { x := json.patch({"a": 1}, [{"op": "replace", "path": "", "value": [1]}]) }`}, `[1]`},
+		{"patch: bad op", []string{`p = x { x := json.patch({"a": 1}, [{"op": "frobnicate", "path": "/a"}]) }`}, fmt.Errorf(`operand 2 must contain operations with "op" one of {add, remove, replace, move, copy, test} but got "frobnicate"`)},
+		{"patch: bad pointer", []string{`p = x { x := json.patch({"a": 1}, [{"op": "remove", "path": "a"}]) }`}, fmt.Errorf(`operand 2 must contain a valid JSON pointer for "path" but got "a"`)},
 	}
 
 	data := loadSmallTestData()
@@ -1372,6 +1567,142 @@ func TestTopDownBase64UrlBuiltins(t *testing.T) {
 		{"encode-2", []string{`p = x { base64url.encode("there", x) }`}, `"dGhlcmU="`},
 		{"decode-1", []string{`p = x { base64url.decode("aGVsbG8=", x) }`}, `"hello"`},
 		{"decode-2", []string{`p = x { base64url.decode("dGhlcmU=", x) }`}, `"there"`},
+		{"encode no pad", []string{`p = x { base64url.encode_no_pad("hello", x) }`}, `"aGVsbG8"`},
+		{"encode no pad round trip", []string{`p = x { base64url.decode(base64url.encode_no_pad("there"), x) }`}, `"there"`},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestTopDownURLQueryBuiltins(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"encode", []string{`p = x { urlquery.encode("a=b&c d/?", x) }`}, `"a%3Db%26c+d%2F%3F"`},
+		{"decode", []string{`p = x { urlquery.decode("a%3Db%26c+d%2F%3F", x) }`}, `"a=b&c d/?"`},
+		{"decode: bad escape", []string{`p = x { urlquery.decode("%ZZ", x) }`}, fmt.Errorf("invalid URL escape")},
+		{"encode_object", []string{`p = x { urlquery.encode_object({"b": "x y", "a": ["1", "2"], "c": {"3"}}, x) }`}, `"a=1&a=2&b=x+y&c=3"`},
+		{"encode_object: empty", []string{`p = x { urlquery.encode_object({}, x) }`}, `""`},
+		{"decode_object", []string{`p = x { urlquery.decode_object("a=1&b=x+y&a=2", x) }`}, `{"a": ["1", "2"], "b": ["x y"]}`},
+		{"decode_object: empty", []string{`p = x { urlquery.decode_object("", x) }`}, `{}`},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestTopDownHexBuiltins(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"encode", []string{`p = x { hex.encode("hello", x) }`}, `"68656c6c6f"`},
+		{"decode", []string{`p = x { hex.decode("68656c6c6f", x) }`}, `"hello"`},
+		{"decode: uppercase", []string{`p = x { hex.decode("68656C6C6F", x) }`}, `"hello"`},
+		{"decode: bad", []string{`p = x { hex.decode("6", x) }`}, fmt.Errorf("encoding/hex")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestTopDownParseURL(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"full", []string{`p = x { parse_url("https://example.com:8443/a/b%20c?x=1&y=2&x=3#frag", x) }`}, `{
+			"scheme": "https",
+			"host": "example.com",
+			"port": "8443",
+			"path": "/a/b c",
+			"raw_query": "x=1&y=2&x=3",
+			"query": {"x": ["1", "3"], "y": ["2"]},
+			"fragment": "frag"
+		}`},
+		{"path only", []string{`p = x { parse_url("/v1/data?q", x) }`}, `{
+			"scheme": "",
+			"host": "",
+			"port": "",
+			"path": "/v1/data",
+			"raw_query": "q",
+			"query": {"q": [""]},
+			"fragment": ""
+		}`},
+		{"ipv6", []string{`p = [h, p] { x := parse_url("http://[::1]:80/"); h := x.host; p := x.port }`}, `["::1", "80"]`},
+		{"bad", []string{`p = x { parse_url("http://[::1", x) }`}, fmt.Errorf("missing ']' in host")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestTopDownSemver(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"is_valid", []string{`p = x { vs := ["1.0.0", "0.1.2-rc.1+build.5", "1.0.0-alpha-a.b-c", "v1.0.0", "1.0", "01.0.0", "1.0.0-01", "1.0.0+", 1]; x := [v | v := vs[_]; semver.is_valid(v)] }`}, `["1.0.0", "0.1.2-rc.1+build.5", "1.0.0-alpha-a.b-c"]`},
+		{"compare: equal", []string{`p = x { x := semver.compare("1.2.3", "1.2.3+build") }`}, `0`},
+		{"compare: less", []string{`p = x { x := semver.compare("1.2.3", "1.10.0") }`}, `-1`},
+		{"compare: greater", []string{`p = x { x := semver.compare("2.0.0", "1.99.99") }`}, `1`},
+		{"compare: big", []string{`p = x { x := semver.compare("1.0.18446744073709551616", "1.0.18446744073709551615") }`}, `1`},
+		{"compare: precedence", []string{`p = x {
+			vs := ["1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0"]
+			x := [c | vs[i]; i > 0; c := semver.compare(vs[i-1], vs[i])]
+		}`}, `[-1, -1, -1, -1, -1, -1, -1]`},
+		{"compare: invalid", []string{`p = x { x := semver.compare("1.0.0", "1.0") }`}, fmt.Errorf("operand 2 must be a valid semantic version but got \"1.0\"")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestTopDownUnits(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"parse: plain", []string{`p = x { x := units.parse("42") }`}, `42`},
+		{"parse: milli", []string{`p = x { x := units.parse("100m") }`}, `0.1`},
+		{"parse: si", []string{`p = x { x := units.parse("1.5G") }`}, `1500000000`},
+		{"parse: iec", []string{`p = x { x := units.parse("512Mi") }`}, `536870912`},
+		{"parse: case-sensitive", []string{`p = x { x := [units.parse("1M"), units.parse("1m")] }`}, `[1000000, 0.001]`},
+		{"parse: exponent", []string{`p = x { x := units.parse("2.5e-1k") }`}, `250`},
+		{"parse: negative", []string{`p = x { x := units.parse("-0.5") }`}, `-0.5`},
+		{"parse: exact", []string{`p { units.parse("1E") == 1000000000000000000 }`}, `true`},
+		{"parse: bad suffix", []string{`p = x { x := units.parse("10MB") }`}, fmt.Errorf("operand 1 must be a number with an optional unit suffix but got \"10MB\"")},
+		{"parse: large exponent", []string{`p = x { x := units.parse("1e300000000") }`}, fmt.Errorf("operand 1 exponent must be between -1000 and 1000 but got \"1e300000000\"")},
+		{"parse: small exponent", []string{`p = x { x := units.parse("1e-1001") }`}, fmt.Errorf("operand 1 exponent must be between -1000 and 1000 but got \"1e-1001\"")},
+		{"parse: max exponent", []string{`p { units.parse("1e1000") > 0 }`}, `true`},
+		{"parse_bytes: plain", []string{`p = x { x := units.parse_bytes("42") }`}, `42`},
+		{"parse_bytes: si", []string{`p = x { x := [units.parse_bytes("10KB"), units.parse_bytes("1.5g"), units.parse_bytes("2 M")] }`}, `[10000, 1500000000, 2000000]`},
+		{"parse_bytes: iec", []string{`p = x { x := [units.parse_bytes("512Mi"), units.parse_bytes("1KiB"), units.parse_bytes("1.5gib")] }`}, `[536870912, 1024, 1610612736]`},
+		{"parse_bytes: truncate", []string{`p = x { x := units.parse_bytes("1.5") }`}, `1`},
+		{"parse_bytes: bad", []string{`p = x { x := units.parse_bytes("12 bytes") }`}, fmt.Errorf("operand 1 must be a number with an optional byte unit suffix but got \"12 bytes\"")},
+		{"parse_bytes: large exponent", []string{`p = x { x := units.parse_bytes("1e99999999999999999999") }`}, fmt.Errorf("operand 1 exponent must be between -1000 and 1000 but got \"1e99999999999999999999\"")},
 	}
 
 	data := loadSmallTestData()
@@ -1632,6 +1963,75 @@ func TestTopDownTime(t *testing.T) {
 
 	runTopDownTestCase(t, data, "clock too big", []string{`
 		p = [hour, minute, second] { [hour, minute, second] := time.clock(1582977600*1000*1000*1000*1000) }`}, fmt.Errorf("timestamp too big"))
+
+	runTopDownTestCase(t, data, "date tz", []string{`
+		p = [year, month, day] { [year, month, day] := time.date([1517869800*1000*1000*1000, "America/New_York"]) }`}, "[2018, 2, 5]")
+
+	runTopDownTestCase(t, data, "date tz utc", []string{`
+		p = [year, month, day] { [year, month, day] := time.date([1517869800*1000*1000*1000, ""]) }`}, "[2018, 2, 5]")
+
+	runTopDownTestCase(t, data, "clock tz", []string{`
+		p = [hour, minute, second] { [hour, minute, second] := time.clock([1517832000*1000*1000*1000, "Europe/Paris"]) }`}, "[13, 0, 0]")
+
+	runTopDownTestCase(t, data, "clock bad tz", []string{`
+		p = [hour, minute, second] { [hour, minute, second] := time.clock([1517832000*1000*1000*1000, "Mars/Olympus"]) }`}, fmt.Errorf("unknown time zone Mars/Olympus"))
+
+	runTopDownTestCase(t, data, "weekday", []string{`
+		p = weekday { weekday := time.weekday(1517832000*1000*1000*1000) }`}, `"Monday"`)
+
+	runTopDownTestCase(t, data, "weekday tz", []string{`
+		p = weekday { weekday := time.weekday([1517790000*1000*1000*1000, "Asia/Tokyo"]) }`}, `"Monday"`)
+
+	runTopDownTestCase(t, data, "add_date", []string{`
+		p = ns { ns := time.add_date(1517832000*1000*1000*1000, 1, 1, 1) }`}, "1551873600000000000")
+
+	runTopDownTestCase(t, data, "add_date negative", []string{`
+		p = [year, month, day] { ns := time.add_date(1517832000*1000*1000*1000, 0, -3, 0); [year, month, day] := time.date(ns) }`}, "[2017, 11, 5]")
+
+	runTopDownTestCase(t, data, "add_date tz", []string{`
+		p = [hour, minute, second] { ns := time.add_date([1521288000*1000*1000*1000, "Europe/Paris"], 0, 0, 14); [hour, minute, second] := time.clock([ns, "Europe/Paris"]) }`}, "[13, 0, 0]")
+
+	runTopDownTestCase(t, data, "add_date out of range", []string{`
+		p = ns { ns := time.add_date(1517832000*1000*1000*1000, 1000, 0, 0) }`}, fmt.Errorf("time outside of valid range"))
+
+	runTopDownTestCase(t, data, "diff", []string{`
+		p = diff { diff := time.diff(1517832000*1000*1000*1000, 1551873600*1000*1000*1000) }`}, "[1, 1, 1, 0, 0, 0]")
+
+	runTopDownTestCase(t, data, "diff reversed with borrow", []string{`
+		p = diff { diff := time.diff(1520000000*1000*1000*1000, 1517832000*1000*1000*1000) }`}, "[0, 0, 25, 2, 13, 20]")
+
+	runTopDownTestCase(t, data, "diff bad second operand", []string{`
+		p = diff { diff := time.diff(1517832000*1000*1000*1000, data.b) }`}, fmt.Errorf("operand 2 must be one of {number, array} but got object"))
+}
+
+func TestTopDownGraphBuiltins(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"reachable", []string{`p = x { x := graph.reachable(g, {"admin"}) }`}, `["admin", "editor", "viewer", "guest"]`},
+		{"reachable: array", []string{`p = x { x := graph.reachable(g, ["editor"]) }`}, `["editor", "viewer", "guest"]`},
+		{"reachable: cycle", []string{`p = x { x := graph.reachable(c, {"a"}) }`}, `["a", "b", "c"]`},
+		{"reachable: unknown node", []string{`p = x { x := graph.reachable(g, {"nobody"}) }`}, `["nobody"]`},
+		{"reachable: empty", []string{`p = x { x := graph.reachable(g, set()) }`}, `[]`},
+		{"reachable: bad graph", []string{`p = x { x := graph.reachable(data.b, {"v1"}) }`}, fmt.Errorf("operand 1 must be object with set or array values but got string value")},
+		{"reachable_paths", []string{`p = x { x := graph.reachable_paths(g, {"admin"}) }`}, `[["admin", "editor"], ["admin", "viewer", "guest"]]`},
+		{"reachable_paths: cycle", []string{`p = x { x := graph.reachable_paths(c, {"a"}) }`}, `[["a", "b", "c"]]`},
+		{"reachable_paths: leaf", []string{`p = x { x := graph.reachable_paths(g, ["guest"]) }`}, `[["guest"]]`},
+		{"reachable_paths: multiple", []string{`p = x { x := graph.reachable_paths(g, ["editor", "admin"]) }`}, `[["admin"], ["editor", "viewer", "guest"]]`},
+		{"reachable_paths: dense", []string{`k[n] = ns { ns = [0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11]; n = ns[_] }`, `p = x { x := count(graph.reachable_paths(k, {0})) }`}, `11`},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		rules := append([]string{
+			`g = {"admin": {"editor", "viewer"}, "editor": ["viewer"], "viewer": {"guest"}, "guest": set()} { true }`,
+			`c = {"a": ["b"], "b": ["c"], "c": ["a"]} { true }`,
+		}, tc.rules...)
+		runTopDownTestCase(t, data, tc.note, rules, tc.expected)
+	}
 }
 
 func TestTopDownWalkBuiltin(t *testing.T) {
@@ -2155,6 +2555,7 @@ composite[x] { ex.composite[x] with input.foo as [1, 2, 3, 4] }
 vars = x { foo = "hello"; bar = "world"; x = ex.vars with input.foo as foo with input.bar as bar }
 conflict = true { ex.loopback with input.foo as "x" with input.foo.bar as "y" }
 negation_invalidate[x] { data.a[_] = x; not data.ex.input_eq with input.x as x }
+scoped { ex.loopback = 1 with input as 1; not ex.loopback }
 `,
 	})
 
@@ -2166,6 +2567,368 @@ negation_invalidate[x] { data.a[_] = x; not data.ex.input_eq with input.x as x }
 	assertTopDownWithPath(t, compiler, store, "with vars", []string{"test", "vars"}, "", `{"foo": "hello", "bar": "world"}`)
 	assertTopDownWithPath(t, compiler, store, "with conflict", []string{"test", "conflict"}, "", fmt.Errorf("conflicting input documents"))
 	assertTopDownWithPath(t, compiler, store, "With invalidate", []string{"test", "negation_invalidate"}, "", "[2,3,4]")
+	assertTopDownWithPath(t, compiler, store, "with scoped to expression", []string{"test", "scoped"}, "", "true")
+}
+
+func TestTopDownRegoMetadataRule(t *testing.T) {
+
+	compiler := compileModules([]string{
+		`# METADATA
+# title: Test package
+package test
+
+# METADATA
+# title: Deny
+# custom:
+#   severity: high
+deny[msg] {
+	x := rego.metadata.rule()
+	msg := sprintf("%v (%v)", [x.title, x.custom.severity])
+}
+
+# METADATA
+# title: First
+p = x { false; x := 1 } else = y { y := rego.metadata.rule() }
+
+q = rego.metadata.rule()
+
+r[t] { y := rego.metadata.rule(); t := [x | x := y.title] }
+`})
+
+	store := inmem.New()
+
+	assertTopDownWithPath(t, compiler, store, "rule body", []string{"test", "deny"}, "", `["Deny (high)"]`)
+	assertTopDownWithPath(t, compiler, store, "else", []string{"test", "p"}, "", `{"scope": "rule", "title": "First"}`)
+	assertTopDownWithPath(t, compiler, store, "no metadata", []string{"test", "q"}, "", `{}`)
+	assertTopDownWithPath(t, compiler, store, "no metadata closure", []string{"test", "r"}, "", `[[]]`)
+
+	runTopDownTestCase(t, map[string]interface{}{}, "query", []string{`p = x { x = rego.metadata.rule() }`}, `{}`)
+}
+
+func TestTopDownIndexedConditions(t *testing.T) {
+
+	compiler := compileModules([]string{
+		`package test
+
+routes["users"] { glob.match("/api/*/users", ["/"], input.path) }
+routes["admin"] { glob.match("/admin/**", ["/"], input.path) }
+routes["api"] { re_match("^/api/v[0-9]+/", input.path) }
+routes["read"] { methods := {"GET", "HEAD"}; methods[input.method] }
+routes["write"] { methods := ["POST", "PUT"]; input.method == methods[_] }
+routes["not_get"] { input.method != "GET" }
+routes["one"] { input.x == 1 }
+routes["small"] { s := {1, 2}; s[input.x] }
+routes["pair"] { input.pair = [1, 2] }
+routes["not_one"] { input.x != 1 }
+`})
+
+	store := inmem.New()
+
+	assertTopDownWithPath(t, compiler, store, "glob and regex", []string{"test", "routes"}, `{"path": "/api/v1/users", "method": "GET"}`, `["users", "api", "read"]`)
+	assertTopDownWithPath(t, compiler, store, "super star", []string{"test", "routes"}, `{"path": "/admin/a/b", "method": "PUT"}`, `["admin", "write", "not_get"]`)
+	assertTopDownWithPath(t, compiler, store, "miss", []string{"test", "routes"}, `{"path": "/other", "method": "GET"}`, `["read"]`)
+	assertTopDownWithPath(t, compiler, store, "undefined", []string{"test", "routes"}, `{}`, `[]`)
+	assertTopDownWithPath(t, compiler, store, "non-string", []string{"test", "routes"}, `{"path": 1}`, fmt.Errorf("operand 3 must be string"))
+	assertTopDownWithPath(t, compiler, store, "non-scalar", []string{"test", "routes"}, `{"method": ["GET"]}`, `["not_get"]`)
+	assertTopDownWithPath(t, compiler, store, "non-scalar element", []string{"test", "routes"}, `{"method": {"GET": true}}`, `["not_get"]`)
+	assertTopDownWithPath(t, compiler, store, "integer", []string{"test", "routes"}, `{"x": 1, "pair": [1, 2]}`, `["one", "small", "pair"]`)
+	assertTopDownWithPath(t, compiler, store, "float", []string{"test", "routes"}, `{"x": 1.0, "pair": [1.0, 2.0]}`, `["one", "small", "pair"]`)
+	assertTopDownWithPath(t, compiler, store, "exponent", []string{"test", "routes"}, `{"x": 2e0}`, `["small", "not_one"]`)
+}
+
+func TestTopDownComprehensionIndexing(t *testing.T) {
+
+	compiler := compileModules([]string{
+		`package test
+
+arr[x] = ys { data.a[x]; ys := sort([y | data.b[y].ref == x]) }
+set[x] = n { data.a[x]; ys := {y | data.b[y].ref = x}; n := count(ys) }
+obj[x] = ys { x := "r2"; ys := {k: v | data.c[i].ref = x; data.c[i].k = k; data.c[i].v = v} }
+conflict[x] = ys { x := "r1"; ys := {k: v | data.c[i].ref = x; data.c[i].k = k; data.c[i].v = v} }
+
+f(x) = ys { ys := {y | data.b[y].ref == x} }
+fn = [f("r2"), f("r3")]
+
+wx = ys { x := input.x; ys := [y | input.b[y] == x] }
+with_input = [a, b] { a := wx with input as {"x": "r1", "b": {"q": "r1"}}; b := wx with input as {"x": "r1", "b": {"q": "r2"}} }
+`})
+
+	store := inmem.NewFromObject(util.MustUnmarshalJSON([]byte(`{
+		"a": {"r1": true, "r2": true, "r3": true},
+		"b": {"b1": {"ref": "r1"}, "b2": {"ref": "r2"}, "b3": {"ref": "r1"}},
+		"c": [
+			{"ref": "r1", "k": "a", "v": 1},
+			{"ref": "r1", "k": "a", "v": 2},
+			{"ref": "r2", "k": "a", "v": 1},
+			{"ref": "r2", "k": "b", "v": 2}
+		]
+	}`)).(map[string]interface{}))
+
+	assertTopDownWithPath(t, compiler, store, "array", []string{"test", "arr"}, "", `{"r1": ["b1", "b3"], "r2": ["b2"], "r3": []}`)
+	assertTopDownWithPath(t, compiler, store, "set", []string{"test", "set"}, "", `{"r1": 2, "r2": 1, "r3": 0}`)
+	assertTopDownWithPath(t, compiler, store, "object", []string{"test", "obj"}, "", `{"r2": {"a": 1, "b": 2}}`)
+	assertTopDownWithPath(t, compiler, store, "object conflict", []string{"test", "conflict"}, "", fmt.Errorf("object keys must be unique"))
+	assertTopDownWithPath(t, compiler, store, "function", []string{"test", "fn"}, "", `[["b2"], []]`)
+	assertTopDownWithPath(t, compiler, store, "with", []string{"test", "with_input"}, "", `[["q"], []]`)
+}
+
+func TestTopDownFunctionCache(t *testing.T) {
+
+	var calls int
+
+	counter := func(_ BuiltinContext, operands []*ast.Term, iter func(*ast.Term) error) error {
+		calls++
+		return iter(operands[0])
+	}
+
+	decls := map[string]*ast.Builtin{
+		"test.count": {
+			Name: "test.count",
+			Decl: types.NewFunction(types.Args(types.A), types.A),
+		},
+		"test.random": {
+			Name:             "test.random",
+			Decl:             types.NewFunction(types.Args(types.A), types.A),
+			Nondeterministic: true,
+		},
+	}
+
+	funcs := map[string]*Builtin{
+		"test.count":  {Decl: decls["test.count"], Func: counter},
+		"test.random": {Decl: decls["test.random"], Func: counter},
+	}
+
+	compiler := ast.NewCompiler().WithBuiltins(decls)
+	compiler.Compile(map[string]*ast.Module{"test": ast.MustParseModule(`package test
+
+f(x) = y { y := test.count(x) }
+g(x) = y { y := test.random(x) }
+h(x) = y { y := f(x) }
+r(x) = y { y := g(x) }
+b(x) { test.count(x) > 1 }
+u(x) = y { x > 1; y := test.count(x) }
+in(x) = y { y := test.count(x + input) }
+
+det = [f(1), f(1), f(2), f(1), h(1)]
+nondet = [g(1), g(1)]
+transitive = [r(1), r(1)]
+boolean { b(2); b(2); not b(1); not b(1) }
+undefined { not u(1); not u(1) }
+with_input = [a, b, c] { a := in(1) with input as 1; b := in(1) with input as 2; c := in(1) with input as 1 }
+`)})
+
+	if compiler.Failed() {
+		t.Fatalf("Unexpected compiler errors: %v", compiler.Errors)
+	}
+
+	tests := []struct {
+		note     string
+		path     string
+		expected string
+		calls    int
+	}{
+		{"deterministic", "det", `[1, 1, 2, 1, 1]`, 2},
+		{"non-deterministic", "nondet", `[1, 1]`, 2},
+		{"transitive non-deterministic", "transitive", `[1, 1]`, 2},
+		{"boolean", "boolean", `true`, 2},
+		{"undefined", "undefined", `true`, 0},
+		{"with", "with_input", `[2, 3, 2]`, 3},
+	}
+
+	ctx := context.Background()
+	store := inmem.New()
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			calls = 0
+			txn := storage.NewTransactionOrDie(ctx, store)
+			defer store.Abort(ctx, txn)
+
+			qrs, err := NewQuery(ast.MustParseBody("data.test."+tc.path+" = x")).
+				WithCompiler(compiler).
+				WithStore(store).
+				WithTransaction(txn).
+				WithBuiltins(funcs).
+				Run(ctx)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(qrs) != 1 || !qrs[0][ast.Var("x")].Equal(ast.MustParseTerm(tc.expected)) {
+				t.Fatalf("Expected %v but got: %v", tc.expected, qrs)
+			}
+
+			if calls != tc.calls {
+				t.Fatalf("Expected %d calls but got %d", tc.calls, calls)
+			}
+		})
+	}
+}
+
+func TestTopDownEarlyExit(t *testing.T) {
+
+	var calls int
+
+	counter := func(_ BuiltinContext, operands []*ast.Term, iter func(*ast.Term) error) error {
+		calls++
+		return iter(operands[0])
+	}
+
+	decls := map[string]*ast.Builtin{
+		"test.count": {
+			Name: "test.count",
+			Decl: types.NewFunction(types.Args(types.A), types.A),
+		},
+	}
+
+	funcs := map[string]*Builtin{
+		"test.count": {Decl: decls["test.count"], Func: counter},
+	}
+
+	compiler := ast.NewCompiler().WithBuiltins(decls)
+	compiler.Compile(map[string]*ast.Module{"test": ast.MustParseModule(`package test
+
+allow { test.count(input.roles[_]) == "admin" }
+allow { test.count(input.users[_]) == "alice" }
+
+f(x) { test.count(x[_]) == "admin" }
+fn { f(input.roles) }
+
+role = x { x := test.count(input.roles[_]); x == "admin" }
+
+with_else { test.count(input.roles[_]) == "admin" } else = false { true }
+`)})
+
+	if compiler.Failed() {
+		t.Fatalf("Unexpected compiler errors: %v", compiler.Errors)
+	}
+
+	tests := []struct {
+		note      string
+		query     string
+		earlyExit bool
+		expected  int
+		calls     int
+	}{
+		{"complete", "data.test.allow = x", true, 1, 1},
+		{"complete disabled", "data.test.allow = x", false, 1, 5},
+		{"function", "data.test.fn = x", true, 1, 1},
+		{"non-ground value", "data.test.role = x", true, 1, 4},
+		{"else", "data.test.with_else = x", true, 1, 4},
+		{"existence", `input.roles[_] = "admin"`, true, 1, 0},
+		{"existence disabled", `input.roles[_] = "admin"`, false, 3, 0},
+		{"non-wildcard", `input.roles[i] = "admin"`, true, 3, 0},
+	}
+
+	ctx := context.Background()
+	store := inmem.New()
+	input := ast.MustParseTerm(`{"roles": ["admin", "admin", "dev", "admin"], "users": ["alice"]}`)
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			calls = 0
+			txn := storage.NewTransactionOrDie(ctx, store)
+			defer store.Abort(ctx, txn)
+
+			qrs, err := NewQuery(ast.MustParseBody(tc.query)).
+				WithCompiler(compiler).
+				WithStore(store).
+				WithTransaction(txn).
+				WithInput(input).
+				WithBuiltins(funcs).
+				WithEarlyExit(tc.earlyExit).
+				WithQueryEarlyExit(tc.earlyExit).
+				Run(ctx)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(qrs) != tc.expected {
+				t.Fatalf("Expected %d results but got: %v", tc.expected, qrs)
+			}
+
+			if calls != tc.calls {
+				t.Fatalf("Expected %d calls but got %d", tc.calls, calls)
+			}
+		})
+	}
+}
+
+func TestTopDownWithKeywordFunctions(t *testing.T) {
+
+	compiler := compileModules([]string{
+		`package ex
+
+now = time.now_ns() { true }
+fetch = x { r := http.send({"method": "get", "url": "http://example.com"}); x := r.body }
+double(x) = y { y := x * 2 }
+doubled = y { y := double(3) }
+big(x) { x > 100 }
+is_big { big(1) }
+size = count([1, 2, 3]) { true }
+`,
+
+		`package test
+
+import data.ex
+
+mock_send(req) = {"status_code": 200, "body": req.url} { true }
+triple(x) = y { y := x * 3 }
+
+builtin_value = x { x := time.now_ns() with time.now_ns as 42 }
+builtin_value_transitive = x { x := ex.now with time.now_ns as 42 }
+builtin_function = x { x := ex.fetch with http.send as mock_send }
+builtin_by_name = x { x := ex.size with count as sum }
+function_value = x { x := ex.doubled with ex.double as 7 }
+function_function = x { x := ex.doubled with ex.double as triple }
+function_boolean = x { x := ex.is_big with ex.big as true }
+function_boolean_false { not ex.is_big with ex.big as false }
+operator_value = x { x := ex.is_big with gt as true }
+var_value = x { y = 10; x := ex.doubled with ex.double as y }
+scoped = [x, y] { x := ex.now with time.now_ns as 1; y := ex.now; y != 1 }
+nested = [x, y] { x := ex.doubled with ex.double as triple with ex.double as 1; y := ex.doubled }
+`,
+	})
+
+	store := inmem.NewFromObject(loadSmallTestData())
+
+	tests := []struct {
+		note     string
+		path     string
+		expected string
+	}{
+		{"builtin value", "builtin_value", "42"},
+		{"builtin value transitive", "builtin_value_transitive", "42"},
+		{"builtin function", "builtin_function", `"http://example.com"`},
+		{"builtin by name", "builtin_by_name", "6"},
+		{"function value", "function_value", "7"},
+		{"function function", "function_function", "9"},
+		{"function boolean", "function_boolean", "true"},
+		{"function boolean false", "function_boolean_false", "true"},
+		{"operator value", "operator_value", "true"},
+		{"var value", "var_value", "10"},
+		{"nested", "nested", "[1, 6]"},
+	}
+
+	for _, tc := range tests {
+		assertTopDownWithPath(t, compiler, store, tc.note, []string{"test", tc.path}, "", tc.expected)
+	}
+
+	qrs, err := NewQuery(ast.MustParseBody("data.test.scoped = x")).
+		WithCompiler(compiler).
+		WithStore(store).
+		WithTransaction(storage.NewTransactionOrDie(context.Background(), store)).
+		Run(context.Background())
+
+	if err != nil || len(qrs) != 1 {
+		t.Fatalf("Expected one result but got %v (err: %v)", qrs, err)
+	}
+
+	if result := qrs[0][ast.Var("x")].Value.(ast.Array); !result[0].Equal(ast.IntNumberTerm(1)) || result[1].Equal(ast.IntNumberTerm(1)) {
+		t.Fatalf("Expected replacement to be scoped to expression but got: %v", result)
+	}
 }
 
 func TestTopDownElseKeyword(t *testing.T) {
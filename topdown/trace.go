@@ -190,6 +190,26 @@ func (ds depths) GetOrSet(qid uint64, pqid uint64) int {
 	return depth
 }
 
+// multiTracer sends events to each of the tracers that are enabled.
+type multiTracer []Tracer
+
+func (m multiTracer) Enabled() bool {
+	for _, t := range m {
+		if t.Enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiTracer) Trace(evt *Event) {
+	for _, t := range m {
+		if t.Enabled() {
+			t.Trace(evt)
+		}
+	}
+}
+
 func builtinTrace(bctx BuiltinContext, args []*ast.Term, iter func(*ast.Term) error) error {
 
 	str, err := builtins.StringOperand(args[0].Value, 1)
@@ -7,6 +7,7 @@ package topdown
 import (
 	"bytes"
 	"context"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -252,3 +253,51 @@ Redo data.test.p = _
 		t.Fatalf("Missing lines in trace:\n%v", strings.Join(a[min:], "\n"))
 	}
 }
+
+func TestMultipleTracers(t *testing.T) {
+
+	ctx := context.Background()
+
+	var disabled *BufferTracer
+	tracer1 := NewBufferTracer()
+	tracer2 := NewBufferTracer()
+
+	query := NewQuery(ast.MustParseBody(`x = 1; trace("hello")`)).
+		WithCompiler(ast.NewCompiler()).
+		WithStore(inmem.New()).
+		WithTracer(nil).
+		WithTracer(tracer1).
+		WithTracer(disabled).
+		WithTracer(tracer2)
+
+	if _, err := query.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*tracer1) == 0 || !reflect.DeepEqual(*tracer1, *tracer2) {
+		t.Fatalf("Expected tracers to receive same events but got:\n%v\n\n%v", *tracer1, *tracer2)
+	}
+
+	var found bool
+	for _, evt := range *tracer1 {
+		if evt.Op == NoteOp && evt.Message == "hello" {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatal("Expected note in trace")
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+
+	query := NewQuery(ast.MustParseBody(`x = 1`)).
+		WithCompiler(ast.NewCompiler()).
+		WithStore(inmem.New()).
+		WithTracer(nil)
+
+	if _, err := query.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
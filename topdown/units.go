@@ -0,0 +1,219 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"errors"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+)
+
+// quantityRegexp matches a decimal number followed by an optional unit
+// suffix, e.g., "512Mi", "1.5G" or "100m".
+var quantityRegexp = regexp.MustCompile(`^\s*([+-]?(?:[0-9]+(?:\.[0-9]*)?|\.[0-9]+)(?:[eE][+-]?[0-9]+)?)\s*([a-zA-Z]*)\s*$`)
+
+// unitMultiplier represents a multiplier of 2^pow2 * 10^pow10.
+type unitMultiplier struct {
+	pow2  uint
+	pow10 int
+}
+
+// unitMultipliers contains the SI and IEC suffixes accepted by units.parse.
+// Suffixes are case-sensitive so that "m" (milli) and "M" (mega) differ.
+var unitMultipliers = map[string]unitMultiplier{
+	"":   {},
+	"n":  {pow10: -9},
+	"u":  {pow10: -6},
+	"m":  {pow10: -3},
+	"k":  {pow10: 3},
+	"K":  {pow10: 3},
+	"M":  {pow10: 6},
+	"G":  {pow10: 9},
+	"T":  {pow10: 12},
+	"P":  {pow10: 15},
+	"E":  {pow10: 18},
+	"Ki": {pow2: 10},
+	"Mi": {pow2: 20},
+	"Gi": {pow2: 30},
+	"Ti": {pow2: 40},
+	"Pi": {pow2: 50},
+	"Ei": {pow2: 60},
+}
+
+// byteMultipliers contains the SI and IEC suffixes accepted by
+// units.parse_bytes. Suffixes are matched case-insensitively.
+var byteMultipliers = map[string]unitMultiplier{
+	"":    {},
+	"b":   {},
+	"k":   {pow10: 3},
+	"kb":  {pow10: 3},
+	"m":   {pow10: 6},
+	"mb":  {pow10: 6},
+	"g":   {pow10: 9},
+	"gb":  {pow10: 9},
+	"t":   {pow10: 12},
+	"tb":  {pow10: 12},
+	"p":   {pow10: 15},
+	"pb":  {pow10: 15},
+	"e":   {pow10: 18},
+	"eb":  {pow10: 18},
+	"ki":  {pow2: 10},
+	"kib": {pow2: 10},
+	"mi":  {pow2: 20},
+	"mib": {pow2: 20},
+	"gi":  {pow2: 30},
+	"gib": {pow2: 30},
+	"ti":  {pow2: 40},
+	"tib": {pow2: 40},
+	"pi":  {pow2: 50},
+	"pib": {pow2: 50},
+	"ei":  {pow2: 60},
+	"eib": {pow2: 60},
+}
+
+var ten = big.NewInt(10)
+
+// maxQuantityScale bounds the exponent and the number of fractional digits of
+// quantities. Larger values would take unbounded time and memory to expand.
+const maxQuantityScale = 1000
+
+var (
+	errQuantityInvalid = errors.New("invalid quantity")
+	errQuantityScale   = errors.New("quantity scale out of range")
+)
+
+// parseQuantity returns the value of the quantity as mantissa * 10^-scale.
+// The suffix is normalized with fold before it is looked up in multipliers.
+func parseQuantity(s string, multipliers map[string]unitMultiplier, fold func(string) string) (*big.Int, int, error) {
+
+	m := quantityRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return nil, 0, errQuantityInvalid
+	}
+
+	mult, ok := multipliers[fold(m[2])]
+	if !ok {
+		return nil, 0, errQuantityInvalid
+	}
+
+	num := m[1]
+	scale := 0
+
+	if i := strings.IndexAny(num, "eE"); i != -1 {
+		exp, err := strconv.Atoi(num[i+1:])
+		if err != nil {
+			return nil, 0, errQuantityScale
+		}
+		if exp > maxQuantityScale || exp < -maxQuantityScale {
+			return nil, 0, errQuantityScale
+		}
+		num = num[:i]
+		scale -= exp
+	}
+
+	if i := strings.Index(num, "."); i != -1 {
+		scale += len(num) - i - 1
+		num = num[:i] + num[i+1:]
+	}
+
+	scale -= mult.pow10
+
+	if scale > maxQuantityScale || scale < -maxQuantityScale {
+		return nil, 0, errQuantityScale
+	}
+
+	mantissa, ok := new(big.Int).SetString(num, 10)
+	if !ok {
+		return nil, 0, errQuantityInvalid
+	}
+
+	mantissa.Lsh(mantissa, mult.pow2)
+
+	if scale < 0 {
+		mantissa.Mul(mantissa, new(big.Int).Exp(ten, big.NewInt(int64(-scale)), nil))
+		scale = 0
+	}
+
+	return mantissa, scale, nil
+}
+
+// decimalToNumber returns the exact number mantissa * 10^-scale.
+func decimalToNumber(mantissa *big.Int, scale int) ast.Number {
+
+	mantissa = new(big.Int).Set(mantissa)
+	rem := new(big.Int)
+
+	for scale > 0 {
+		q, r := new(big.Int).QuoRem(mantissa, ten, rem)
+		if r.Sign() != 0 {
+			break
+		}
+		mantissa = q
+		scale--
+	}
+
+	if scale == 0 {
+		return builtins.IntToNumber(mantissa)
+	}
+
+	digits := new(big.Int).Abs(mantissa).String()
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+
+	s := digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	if mantissa.Sign() < 0 {
+		s = "-" + s
+	}
+
+	return ast.Number(s)
+}
+
+func builtinUnitsParse(a ast.Value) (ast.Value, error) {
+	str, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	mantissa, scale, err := parseQuantity(string(str), unitMultipliers, func(s string) string { return s })
+	if err == errQuantityScale {
+		return nil, builtins.NewOperandErr(1, "exponent must be between -%d and %d but got %v", maxQuantityScale, maxQuantityScale, str)
+	} else if err != nil {
+		return nil, builtins.NewOperandErr(1, "must be a number with an optional unit suffix but got %v", str)
+	}
+
+	return decimalToNumber(mantissa, scale), nil
+}
+
+func builtinUnitsParseBytes(a ast.Value) (ast.Value, error) {
+	str, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	mantissa, scale, err := parseQuantity(string(str), byteMultipliers, strings.ToLower)
+	if err == errQuantityScale {
+		return nil, builtins.NewOperandErr(1, "exponent must be between -%d and %d but got %v", maxQuantityScale, maxQuantityScale, str)
+	} else if err != nil {
+		return nil, builtins.NewOperandErr(1, "must be a number with an optional byte unit suffix but got %v", str)
+	}
+
+	// Fractions of bytes are truncated.
+	if scale > 0 {
+		mantissa.Quo(mantissa, new(big.Int).Exp(ten, big.NewInt(int64(scale)), nil))
+	}
+
+	return builtins.IntToNumber(mantissa), nil
+}
+
+func init() {
+	RegisterFunctionalBuiltin1(ast.UnitsParse.Name, builtinUnitsParse)
+	RegisterFunctionalBuiltin1(ast.UnitsParseBytes.Name, builtinUnitsParseBytes)
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+)
+
+type uuidCachingKey string
+
+func builtinUUIDRFC4122(bctx BuiltinContext, operands []*ast.Term, iter func(*ast.Term) error) error {
+
+	seed, err := builtins.StringOperand(operands[0].Value, 1)
+	if err != nil {
+		return handleBuiltinErr(ast.UUIDRFC4122.Name, bctx.Location, err)
+	}
+
+	// The same seed yields the same UUID for the duration of the query so that
+	// results are reproducible.
+	key := uuidCachingKey(seed)
+
+	if val, ok := bctx.Cache.Get(key); ok {
+		return iter(val.(*ast.Term))
+	}
+
+	s, err := uuid4(rand.Reader)
+	if err != nil {
+		return handleBuiltinErr(ast.UUIDRFC4122.Name, bctx.Location, err)
+	}
+
+	result := ast.StringTerm(s)
+	bctx.Cache.Put(key, result)
+
+	return iter(result)
+}
+
+// uuid4 returns a random (version 4) UUID as defined by RFC 4122.
+func uuid4(r io.Reader) (string, error) {
+	bs := make([]byte, 16)
+	if _, err := io.ReadFull(r, bs); err != nil {
+		return "", err
+	}
+	bs[6] = (bs[6] & 0x0f) | 0x40 // version 4
+	bs[8] = (bs[8] & 0x3f) | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", bs[0:4], bs[4:6], bs[6:8], bs[8:10], bs[10:]), nil
+}
+
+func init() {
+	RegisterBuiltinFunc(ast.UUIDRFC4122.Name, builtinUUIDRFC4122)
+}